@@ -0,0 +1,117 @@
+// Package audit records who did what to which file. Entries go to the Default recorder,
+// which appends them to the audit table, where admins can query them per user or per file.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Actions recorded in Entry.Action
+const (
+	ActionUpload    = "upload"
+	ActionDownload  = "download" // a download URL was issued
+	ActionOverwrite = "overwrite"
+	ActionRename    = "rename"
+	ActionCopy      = "copy"
+	ActionDelete    = "delete"
+)
+
+// TimestampFormat is RFC3339 in UTC with all nine fractional digits, so timestamps sort as strings
+const TimestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Entry is one audited operation
+type Entry struct {
+	EntryID    string            `json:"EntryID"`
+	Action     string            `json:"Action"`
+	Actor      string            `json:"Actor"`      // sub of the caller
+	TargetUser string            `json:"TargetUser"` // owner of the file acted on
+	FileID     string            `json:"FileID"`
+	Timestamp  string            `json:"Timestamp"` // TimestampFormat
+	SourceIP   string            `json:"SourceIP,omitempty"`
+	UserAgent  string            `json:"UserAgent,omitempty"`
+	Details    map[string]string `json:"Details,omitempty"` // action specific, e.g. OldName and NewName
+}
+
+// Recorder stores audit entries
+type Recorder interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+// LogRecorder writes each entry as a JSON line {"audit": entry}
+type LogRecorder struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+func (l *LogRecorder) Record(ctx context.Context, entry Entry) error {
+	js, err := json.Marshal(map[string]Entry{"audit": entry})
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = fmt.Fprintf(l.W, "%s\n", js)
+	return err
+}
+
+// Default receives entries passed to Record; tests swap it out
+var Default Recorder = NewDynamoDBRecorder(TableName)
+
+// NewEntry starts an entry for principal acting on fileID of targetUser, taking the
+// caller's address and user agent from the request
+func NewEntry(action string, principal *auth.Principal, request events.APIGatewayProxyRequest, targetUser string, fileID string) Entry {
+	entry := Entry{
+		EntryID:    uuid.New().String(),
+		Action:     action,
+		TargetUser: targetUser,
+		FileID:     fileID,
+		Timestamp:  time.Now().UTC().Format(TimestampFormat),
+		SourceIP:   request.RequestContext.Identity.SourceIP,
+		UserAgent:  request.RequestContext.Identity.UserAgent,
+	}
+	if principal != nil {
+		entry.Actor = principal.Subject
+	}
+
+	// payload 2.0 events carry neither in the fields events.APIGatewayProxyRequest maps
+	if entry.SourceIP == "" {
+		forwarded := header(request, "X-Forwarded-For")
+		entry.SourceIP = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if entry.UserAgent == "" {
+		entry.UserAgent = header(request, "User-Agent")
+	}
+
+	return entry
+}
+
+// Record stores entry with the Default recorder. A failure is logged rather than
+// returned: the operation has already happened by the time it is audited.
+func Record(ctx context.Context, entry Entry) {
+	if err := Default.Record(ctx, entry); err != nil {
+		logging.FromContext(ctx).Error("failed to record audit entry", "entry", entry, "error", err)
+	}
+}
+
+func header(request events.APIGatewayProxyRequest, name string) string {
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
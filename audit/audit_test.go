@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNewEntry(t *testing.T) {
+	principal := &auth.Principal{Subject: "admin-1"}
+
+	request := events.APIGatewayProxyRequest{}
+	request.RequestContext.Identity.SourceIP = "203.0.113.7"
+	request.RequestContext.Identity.UserAgent = "fmctl"
+	entry := NewEntry(ActionRename, principal, request, "user-1", "file-1")
+	if entry.Actor != "admin-1" || entry.TargetUser != "user-1" || entry.FileID != "file-1" ||
+		entry.SourceIP != "203.0.113.7" || entry.UserAgent != "fmctl" || entry.Timestamp == "" {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	// payload 2.0 leaves Identity empty
+	request = events.APIGatewayProxyRequest{Headers: map[string]string{
+		"x-forwarded-for": "198.51.100.1, 10.0.0.1",
+		"user-agent":      "curl/7.0",
+	}}
+	entry = NewEntry(ActionRename, principal, request, "user-1", "file-1")
+	if entry.SourceIP != "198.51.100.1" || entry.UserAgent != "curl/7.0" {
+		t.Errorf("entry from headers = %+v", entry)
+	}
+}
+
+func TestLogRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	l := &LogRecorder{W: &buf}
+
+	entry := Entry{Action: ActionRename, FileID: "f", Details: map[string]string{"OldName": "a", "NewName": "b"}}
+	if err := l.Record(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	var line struct {
+		Audit Entry `json:"audit"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line.Audit.Details["NewName"] != "b" {
+		t.Errorf("line %q: %+v %v", buf.String(), line, err)
+	}
+}
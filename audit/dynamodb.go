@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+)
+
+// TableName is the audit table. It is append-only: entries are only ever put, conditioned on a
+// new EntryID, and the functions' role is allowed to put and query it but not to update or delete.
+const TableName = "dev-audit"
+
+// ErrInvalidPageToken is returned by Query for a pageToken it did not issue
+var ErrInvalidPageToken = aws_usages.ErrInvalidPageToken
+
+// Filter picks the entries Query returns: those about TargetUser's files, or about FileID.
+// Exactly one is set.
+type Filter struct {
+	TargetUser string
+	FileID     string
+}
+
+// DynamoDBRecorder appends entries to an audit table with the ByTargetUser and ByFile indexes
+type DynamoDBRecorder struct {
+	TableName string
+}
+
+// NewDynamoDBRecorder returns a recorder over tableName
+func NewDynamoDBRecorder(tableName string) *DynamoDBRecorder {
+	return &DynamoDBRecorder{TableName: tableName}
+}
+
+func (r *DynamoDBRecorder) Record(ctx context.Context, entry Entry) error {
+	return aws_usages.PutAuditDynamoDB(ctx, r.TableName, aws_usages.AuditTableItem(entry))
+}
+
+// Query returns a page of the entries matching filter, oldest first, and the token for the
+// next page, "" after the last. limit is 0 for DynamoDB's 1MB default page.
+func (r *DynamoDBRecorder) Query(ctx context.Context, filter Filter, limit int64, pageToken string) ([]Entry, string, error) {
+	index, value := aws_usages.AuditIndexByTargetUser, filter.TargetUser
+	if filter.FileID != "" {
+		index, value = aws_usages.AuditIndexByFile, filter.FileID
+	}
+	if value == "" || (filter.TargetUser != "" && filter.FileID != "") {
+		return nil, "", errors.New("filter by exactly one of TargetUser and FileID")
+	}
+
+	items, next, err := aws_usages.QueryAuditDynamoDB(ctx, r.TableName, index, value, limit, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, Entry(item))
+	}
+
+	return entries, next, nil
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// AdminGroup is the Cognito group whose members may act on any user's files
+const AdminGroup = "Admin"
+
+// Principal is the authenticated caller as described by the JWT authorizer
+type Principal struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// IsAdmin reports whether the caller belongs to the admin group
+func (p *Principal) IsAdmin() bool {
+	return p.InGroup(AdminGroup)
+}
+
+// InGroup reports whether the caller belongs to the given Cognito group
+func (p *Principal) InGroup(group string) bool {
+	for _, g := range p.Groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanActAs reports whether the caller may read or modify files owned by userID
+func (p *Principal) CanActAs(userID string) bool {
+	return p.Subject == userID || p.IsAdmin()
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal injected by Middleware, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticate returns the caller for a handler invocation, preferring a principal
+// injected into ctx by Middleware over the API Gateway authorizer context.
+func Authenticate(ctx context.Context, request events.APIGatewayProxyRequest) (*Principal, error) {
+	if p, ok := FromContext(ctx); ok {
+		return p, nil
+	}
+
+	return FromRequest(request)
+}
+
+// FromRequest reads the caller from the JWT authorizer context API Gateway attaches to the request.
+// HTTP APIs place the claims under authorizer.jwt.claims for payload 2.0 and authorizer.claims for 1.0.
+func FromRequest(request events.APIGatewayProxyRequest) (*Principal, error) {
+	claims, err := claimsFromAuthorizer(request.RequestContext.Authorizer)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromClaims(claims)
+}
+
+// FromClaims builds a Principal from a decoded set of Cognito JWT claims
+func FromClaims(claims map[string]interface{}) (*Principal, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("jwt claims missing sub")
+	}
+
+	username, _ := claims["cognito:username"].(string)
+	if username == "" {
+		username, _ = claims["username"].(string)
+	}
+
+	return &Principal{
+		Subject:  sub,
+		Username: username,
+		Groups:   parseGroups(claims["cognito:groups"]),
+	}, nil
+}
+
+func claimsFromAuthorizer(authorizer map[string]interface{}) (map[string]interface{}, error) {
+	if authorizer == nil {
+		return nil, fmt.Errorf("request has no authorizer context")
+	}
+
+	if jwt, ok := authorizer["jwt"].(map[string]interface{}); ok {
+		if claims, ok := jwt["claims"].(map[string]interface{}); ok {
+			return claims, nil
+		}
+	}
+
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("authorizer context has no jwt claims")
+}
+
+// parseGroups accepts the group claim either as a JSON array or as the flattened
+// string API Gateway produces for array claims, e.g. "[Admin User]".
+func parseGroups(raw interface{}) []string {
+	var groups []string
+
+	switch v := raw.(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok && s != "" {
+				groups = append(groups, s)
+			}
+		}
+	case []string:
+		groups = append(groups, v...)
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "[\"") {
+			if err := json.Unmarshal([]byte(s), &groups); err == nil {
+				return groups
+			}
+		}
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		for _, g := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+			groups = append(groups, g)
+		}
+	}
+
+	return groups
+}
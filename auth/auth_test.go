@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func requestWithClaims(claims map[string]interface{}) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"jwt": map[string]interface{}{
+					"claims": claims,
+				},
+			},
+		},
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	p, err := FromRequest(requestWithClaims(map[string]interface{}{
+		"sub":              "user-1",
+		"cognito:username": "alice",
+		"cognito:groups":   "[Admin User]",
+	}))
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	if p.Subject != "user-1" || p.Username != "alice" {
+		t.Errorf("got %+v", p)
+	}
+	if !reflect.DeepEqual(p.Groups, []string{"Admin", "User"}) {
+		t.Errorf("groups = %v", p.Groups)
+	}
+}
+
+func TestFromRequestPayloadV1(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"claims": map[string]interface{}{"sub": "user-1"},
+			},
+		},
+	}
+	p, err := FromRequest(request)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	if p.Subject != "user-1" {
+		t.Errorf("Subject = %q", p.Subject)
+	}
+}
+
+func TestFromRequestMissingClaims(t *testing.T) {
+	if _, err := FromRequest(events.APIGatewayProxyRequest{}); err == nil {
+		t.Error("expected error for request without authorizer")
+	}
+	if _, err := FromRequest(requestWithClaims(map[string]interface{}{})); err == nil {
+		t.Error("expected error for claims without sub")
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want []string
+	}{
+		{nil, nil},
+		{"", nil},
+		{"[Admin]", []string{"Admin"}},
+		{"[Admin User]", []string{"Admin", "User"}},
+		{"Admin,User", []string{"Admin", "User"}},
+		{`["Admin","User"]`, []string{"Admin", "User"}},
+		{[]interface{}{"Admin", "User"}, []string{"Admin", "User"}},
+	}
+	for _, tt := range tests {
+		if got := parseGroups(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseGroups(%#v) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCanActAs(t *testing.T) {
+	user := &Principal{Subject: "user-1"}
+	admin := &Principal{Subject: "admin-1", Groups: []string{AdminGroup}}
+
+	if !user.CanActAs("user-1") {
+		t.Error("user should act as self")
+	}
+	if user.CanActAs("user-2") {
+		t.Error("user should not act as another user")
+	}
+	if !admin.CanActAs("user-2") {
+		t.Error("admin should act as another user")
+	}
+}
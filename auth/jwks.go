@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK is a single RSA JSON Web Key as published by Cognito
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKey decodes the RSA public key described by the JWK
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %v for kid %v", k.Kty, k.Kid)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus for kid %v: %v", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent for kid %v: %v", k.Kid, err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// ParseJWKS decodes a JWKS document into RSA public keys indexed by kid
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jwks: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// KeySet caches the signing keys from a JWKS URL or file.
+// Keys are reloaded once MaxAge has passed, and early when a token names a kid the
+// cache has not seen (the issuer rotated keys), at most once per MinRefresh.
+type KeySet struct {
+	URL        string
+	File       string
+	MaxAge     time.Duration
+	MinRefresh time.Duration
+	Client     *http.Client
+	Now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// Key returns the public key for kid, refreshing the cached set when needed
+func (s *KeySet) Key(kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.keys == nil || now.Sub(s.fetchedAt) > s.maxAge() {
+		if err := s.refresh(now); err != nil && s.keys == nil {
+			return nil, err
+		}
+	}
+
+	if key, found := s.keys[kid]; found {
+		return key, nil
+	}
+
+	if now.Sub(s.attemptedAt) >= s.minRefresh() {
+		if err := s.refresh(now); err != nil {
+			return nil, err
+		}
+		if key, found := s.keys[kid]; found {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no signing key for kid %v", kid)
+}
+
+func (s *KeySet) refresh(now time.Time) error {
+	s.attemptedAt = now
+
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.keys = keys
+	s.fetchedAt = now
+	return nil
+}
+
+func (s *KeySet) load() ([]byte, error) {
+	if s.File != "" {
+		data, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwks file %v: %v", s.File, err)
+		}
+		return data, nil
+	}
+
+	if s.URL == "" {
+		return nil, fmt.Errorf("no jwks url or file configured")
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks %v: %v", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks %v: status %v", s.URL, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks %v: %v", s.URL, err)
+	}
+
+	return data, nil
+}
+
+func (s *KeySet) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *KeySet) maxAge() time.Duration {
+	if s.MaxAge > 0 {
+		return s.MaxAge
+	}
+	return time.Hour
+}
+
+func (s *KeySet) minRefresh() time.Duration {
+	if s.MinRefresh > 0 {
+		return s.MinRefresh
+	}
+	return time.Minute
+}
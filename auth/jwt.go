@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Verifier checks RS256 JWTs the same way the API Gateway cognitoJwt authorizer does:
+// signature against the issuer's JWKS, iss, aud or client_id, and exp.
+type Verifier struct {
+	Issuer   string
+	Audience []string
+	Keys     *KeySet
+	Leeway   time.Duration
+	Now      func() time.Time
+}
+
+// NewVerifierFromEnv builds a Verifier from
+// JWT_ISSUER, JWT_AUDIENCE (comma separated), and JWKS_FILE or JWKS_URL.
+// JWKS_URL defaults to the issuer's /.well-known/jwks.json as served by Cognito.
+func NewVerifierFromEnv() (*Verifier, error) {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		return nil, fmt.Errorf("JWT_ISSUER is not set")
+	}
+
+	var audience []string
+	for _, a := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			audience = append(audience, a)
+		}
+	}
+
+	keys := &KeySet{
+		File: os.Getenv("JWKS_FILE"),
+		URL:  os.Getenv("JWKS_URL"),
+	}
+	if keys.File == "" && keys.URL == "" {
+		keys.URL = strings.TrimSuffix(issuer, "/") + "/.well-known/jwks.json"
+	}
+
+	return &Verifier{
+		Issuer:   issuer,
+		Audience: audience,
+		Keys:     keys,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token and returns its claims
+func (v *Verifier) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported jwt alg %v", header.Alg)
+	}
+
+	key, err := v.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid jwt signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %v", err)
+	}
+
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("jwt missing exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return fmt.Errorf("jwt expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("jwt not valid yet")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return fmt.Errorf("jwt issuer %v does not match %v", iss, v.Issuer)
+	}
+
+	if len(v.Audience) == 0 {
+		return nil
+	}
+	for _, aud := range audiences(claims) {
+		for _, want := range v.Audience {
+			if aud == want {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("jwt audience not accepted")
+}
+
+// audiences collects aud (Cognito id tokens) and client_id (Cognito access tokens)
+func audiences(claims map[string]interface{}) []string {
+	var out []string
+
+	switch aud := claims["aud"].(type) {
+	case string:
+		out = append(out, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+	if clientID, ok := claims["client_id"].(string); ok {
+		out = append(out, clientID)
+	}
+
+	return out
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
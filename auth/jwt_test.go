@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth/authtest"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	testIssuer   = "https://cognito-idp.us-west-2.amazonaws.com/us-west-2_test"
+	testClientID = "test-client"
+)
+
+func newTestIssuer(t *testing.T) *authtest.Issuer {
+	iss, err := authtest.NewIssuer(testIssuer, testClientID)
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	return iss
+}
+
+func TestVerifyFromFile(t *testing.T) {
+	iss := newTestIssuer(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := iss.WriteJWKS(path); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Verifier{Issuer: testIssuer, Audience: []string{testClientID}, Keys: &KeySet{File: path}}
+	claims, err := v.Verify(iss.Token("user-1", AdminGroup))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	p, err := FromClaims(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "user-1" || !p.IsAdmin() {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	iss := newTestIssuer(t)
+	other := newTestIssuer(t)
+	srv := iss.Server()
+	defer srv.Close()
+
+	v := &Verifier{Issuer: testIssuer, Audience: []string{testClientID}, Keys: &KeySet{URL: srv.URL}}
+
+	sign := func(mutate func(map[string]interface{})) string {
+		claims := iss.Claims("user-1")
+		mutate(claims)
+		token, err := iss.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := map[string]string{
+		"expired":      sign(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }),
+		"wrong issuer": sign(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }),
+		"wrong aud":    sign(func(c map[string]interface{}) { c["aud"] = "other-client" }),
+		"no exp":       sign(func(c map[string]interface{}) { delete(c, "exp") }),
+		"unknown key":  other.Token("user-1"),
+		"garbage":      "not.a.jwt",
+	}
+	for name, token := range tests {
+		if _, err := v.Verify(token); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestVerifyAccessTokenClientID(t *testing.T) {
+	iss := newTestIssuer(t)
+	srv := iss.Server()
+	defer srv.Close()
+
+	claims := iss.Claims("user-1")
+	delete(claims, "aud")
+	claims["client_id"] = testClientID
+	claims["token_use"] = "access"
+	token, err := iss.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Verifier{Issuer: testIssuer, Audience: []string{testClientID}, Keys: &KeySet{URL: srv.URL}}
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(iss.JWKS())
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	keys := &KeySet{URL: srv.URL, MinRefresh: time.Minute, Now: func() time.Time { return now }}
+	v := &Verifier{Issuer: testIssuer, Audience: []string{testClientID}, Keys: keys}
+
+	if _, err := v.Verify(iss.Token("user-1")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := v.Verify(iss.Token("user-1")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetches = %d, want 1 (cached)", n)
+	}
+
+	if err := iss.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated := iss.Token("user-1")
+
+	// Unknown kid inside MinRefresh of the last fetch is not refetched
+	if _, err := v.Verify(rotated); err == nil {
+		t.Error("expected unknown kid to fail inside MinRefresh")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := v.Verify(rotated); err != nil {
+		t.Errorf("Verify after rotation: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	iss := newTestIssuer(t)
+	srv := iss.Server()
+	defer srv.Close()
+
+	v := &Verifier{Issuer: testIssuer, Audience: []string{testClientID}, Keys: &KeySet{URL: srv.URL}}
+
+	var got *Principal
+	h := v.Middleware(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		p, err := Authenticate(ctx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = p
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	})
+
+	resp, _ := h(context.Background(), events.APIGatewayProxyRequest{})
+	if resp.StatusCode != 401 {
+		t.Errorf("no token: status %d, want 401", resp.StatusCode)
+	}
+
+	resp, _ = h(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"authorization": "Bearer " + iss.Token("user-1")},
+	})
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	if got == nil || got.Subject != "user-1" {
+		t.Errorf("principal = %+v", got)
+	}
+}
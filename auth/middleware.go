@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerFunc is the shape of every API handler once its package Response type is converted back
+type HandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Middleware verifies the request's bearer token before calling next, for running handlers
+// outside API Gateway. Unauthenticated requests get a 401 and never reach next.
+// The principal is injected into the context and the claims into the request's authorizer
+// context, so handlers see the same thing they would behind the cognitoJwt authorizer.
+func (v *Verifier) Middleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		token := bearerToken(request.Headers)
+		if token == "" {
+			return events.APIGatewayProxyResponse{StatusCode: 401}, nil
+		}
+
+		claims, err := v.Verify(token)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 401}, nil
+		}
+
+		principal, err := FromClaims(claims)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 401}, nil
+		}
+
+		request.RequestContext.Authorizer = map[string]interface{}{
+			"jwt": map[string]interface{}{
+				"claims": claims,
+			},
+		}
+
+		return next(NewContext(ctx, principal), request)
+	}
+}
+
+// bearerToken reads the Authorization header, with or without the Bearer prefix as API Gateway allows
+func bearerToken(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "Authorization") {
+			v = strings.TrimSpace(v)
+			if len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+				v = strings.TrimSpace(v[7:])
+			}
+			return v
+		}
+	}
+
+	return ""
+}
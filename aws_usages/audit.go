@@ -0,0 +1,153 @@
+package aws_usages
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Global secondary indexes of the audit table, both with Timestamp as their range key
+const (
+	AuditIndexByTargetUser = "ByTargetUser"
+	AuditIndexByFile       = "ByFile"
+)
+
+// AuditTableItem is one entry of the append-only audit table, keyed by EntryID
+type AuditTableItem struct {
+	EntryID    string            `json:"EntryID"`
+	Action     string            `json:"Action"`
+	Actor      string            `json:"Actor"`
+	TargetUser string            `json:"TargetUser"`
+	FileID     string            `json:"FileID,omitempty"`
+	Timestamp  string            `json:"Timestamp"`
+	SourceIP   string            `json:"SourceIP,omitempty"`
+	UserAgent  string            `json:"UserAgent,omitempty"`
+	Details    map[string]string `json:"Details,omitempty"`
+}
+
+// ErrAuditEntryExists is returned by PutAuditDynamoDB for an EntryID already in the table
+var ErrAuditEntryExists = errors.New("audit entry already exists")
+
+// PutAuditDynamoDB appends an entry. Entries are never overwritten, so a reused EntryID fails.
+func PutAuditDynamoDB(ctx context.Context, tableName string, entry AuditTableItem) error {
+	svc := dynamoDBClient()
+
+	item, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry %v", entry.EntryID)
+	}
+
+	_, err = svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(EntryID)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrAuditEntryExists
+	}
+	if err != nil {
+		return fmt.Errorf("PutItem error: %v", err)
+	}
+
+	return nil
+}
+
+// QueryAuditDynamoDB returns one page of the entries whose index hash key is value, oldest
+// first: AuditIndexByTargetUser for the entries about a user's files, AuditIndexByFile for one
+// file's. limit and pageToken work as in ListFilesPageDynamoDB, except that every item DynamoDB
+// evaluates matches, so only the last page is short.
+func QueryAuditDynamoDB(ctx context.Context, tableName string, index string, value string, limit int64, pageToken string) ([]AuditTableItem, string, error) {
+	svc := dynamoDBClient()
+
+	hashKey := "TargetUser"
+	if index == AuditIndexByFile {
+		hashKey = "FileID"
+	}
+
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		IndexName:              aws.String(index),
+		KeyConditionExpression: aws.String("#k = :v"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k": aws.String(hashKey),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":v": {S: aws.String(value)},
+		},
+	}
+	if limit > 0 {
+		params.Limit = aws.Int64(limit)
+	}
+	if pageToken != "" {
+		start, err := decodeKeyToken(pageToken, "EntryID")
+		if err != nil {
+			return nil, "", ErrInvalidPageToken
+		}
+		params.ExclusiveStartKey = start
+	}
+
+	result, err := svc.QueryWithContext(ctx, params)
+	if err != nil {
+		return nil, "", fmt.Errorf("query api call failed: %s", err)
+	}
+
+	entries := []AuditTableItem{}
+	for _, i := range result.Items {
+		entry := AuditTableItem{}
+		if err := dynamodbattribute.UnmarshalMap(i, &entry); err != nil {
+			return nil, "", fmt.Errorf("Got error unmarshalling: %s", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	next := ""
+	if len(result.LastEvaluatedKey) > 0 {
+		next = encodeKeyToken(result.LastEvaluatedKey)
+	}
+
+	return entries, next, nil
+}
+
+// encodeKeyToken packs a table or index position whose key attributes are all strings
+func encodeKeyToken(key map[string]*dynamodb.AttributeValue) string {
+	flat := map[string]string{}
+	for name, value := range key {
+		flat[name] = aws.StringValue(value.S)
+	}
+
+	js, _ := json.Marshal(flat)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeKeyToken unpacks a token from encodeKeyToken, which must hold every attribute in required
+func decodeKeyToken(token string, required ...string) (map[string]*dynamodb.AttributeValue, error) {
+	js, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var flat map[string]string
+	if err := json.Unmarshal(js, &flat); err != nil {
+		return nil, err
+	}
+	for _, name := range required {
+		if flat[name] == "" {
+			return nil, ErrInvalidPageToken
+		}
+	}
+
+	key := map[string]*dynamodb.AttributeValue{}
+	for name, value := range flat {
+		key[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+
+	return key, nil
+}
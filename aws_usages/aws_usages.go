@@ -1,20 +1,47 @@
 package aws_usages
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 )
 
+// File lifecycle states stored in FileTableItem.Status.
+// Items written before Status existed have an empty status and are treated as active.
+const (
+	FileStatusActive  = "active"
+	FileStatusPending = "pending"
+	FileStatusTrashed = "trashed"
+)
+
+// Virus scan states stored in FileTableItem.ScanStatus. Files are unscanned until their
+// content arrives; files stored before scanning existed have an empty status (see ScanState).
+// Content the upload policy refuses is rejected without being scanned, and content bigger
+// than the scanner accepts is too_large, which is not served either.
+const (
+	ScanStatusUnscanned   = "unscanned"
+	ScanStatusScanning    = "scanning"
+	ScanStatusClean       = "clean"
+	ScanStatusQuarantined = "quarantined"
+	ScanStatusRejected    = "rejected"
+	ScanStatusTooLarge    = "too_large"
+)
+
 type FileTableItem struct {
 	FileID    string `json:"FileID"`
 	UserID    string `json:"UserID"`
@@ -23,119 +50,133 @@ type FileTableItem struct {
 	FileName  string `json:"FileName"`
 	Modified  string `json:"Modified"`
 	Uploaded  string `json:"Uploaded"`
+	Status    string `json:"Status,omitempty"`
+	FileSize  int64  `json:"FileSize,omitempty"`
+	// QuotaCharged marks items counted in the owner's usage, so deletes of items
+	// created before quotas existed do not drive the counters negative
+	QuotaCharged bool `json:"QuotaCharged,omitempty"`
+
+	// ScanSignature names what the virus scan found in a quarantined file, or why a rejected
+	// file's content was refused; Scanned is when the scan or rejection happened
+	ScanStatus    string `json:"ScanStatus,omitempty"`
+	ScanSignature string `json:"ScanSignature,omitempty"`
+	Scanned       string `json:"Scanned,omitempty"`
+
+	// ContentType is sniffed from the content once it is stored, whatever the name says
+	ContentType string `json:"ContentType,omitempty"`
+
+	// Thumbnails lists the renditions generated for image files
+	Thumbnails []Thumbnail `json:"Thumbnails,omitempty"`
+
+	// SHA256 is the hex digest the uploader declared for the content. BlobKey is set when the
+	// content is a blob shared with the owner's other files of that digest (see BlobTableItem).
+	SHA256  string `json:"SHA256,omitempty"`
+	BlobKey string `json:"BlobKey,omitempty"`
 }
 
-type OverwriteTableItem struct {
-	Modified string `json:"Modified"`
-	FileName string `json:"FileName"`
+// Thumbnail is one stored rendition of an image file
+type Thumbnail struct {
+	Size        string `json:"Size"`
+	Width       int    `json:"Width"`
+	Height      int    `json:"Height"`
+	ContentType string `json:"ContentType"`
 }
 
-type OverwriteKey struct {
-	FileID string `json:"FileID"`
-}
-
-func OverwriteDynamoDB(tableName string, fileData OverwriteTableItem, fileID string) error {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
-
-	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":m": {
-				S: aws.String(fileData.Modified),
-			},
-			":f": {
-				S: aws.String(fileData.FileName),
-			},
-		},
-		TableName: aws.String(tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"FileID": {
-				S: aws.String(fileID),
-			},
-		},
-		ReturnValues:     aws.String("UPDATED_NEW"),
-		UpdateExpression: aws.String("SET Modified = :m, FileName = :f"),
-	}
-
-	_, err := svc.UpdateItem(input)
-	if err != nil {
-		return fmt.Errorf("UpdateItem error: %v\n", err)
+// FileStatus returns the item's lifecycle state, defaulting to active for legacy items
+func (f FileTableItem) FileStatus() string {
+	if f.Status == "" {
+		return FileStatusActive
 	}
 
-	return nil
+	return f.Status
 }
 
-func ListAllFilesDynamoDB(tableName string) (*[]FileTableItem, error) {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
-
-	params := &dynamodb.ScanInput{
-		TableName: aws.String(tableName),
+// ScanState returns the item's virus scan state. Files are created unscanned, so one without
+// a ScanStatus was stored before scanning existed and is grandfathered as clean.
+func (f FileTableItem) ScanState() string {
+	if f.ScanStatus == "" {
+		return ScanStatusClean
 	}
 
-	result, err := svc.Scan(params)
-	if err != nil {
-		return nil, fmt.Errorf("query api call failed: %s", err)
+	return f.ScanStatus
+}
+
+// ContentKey is where the file's content is stored: its shared blob, or else its own FileID
+func (f FileTableItem) ContentKey() string {
+	if f.BlobKey != "" {
+		return f.BlobKey
 	}
 
-	var files []FileTableItem
+	return f.FileID
+}
 
-	for _, i := range result.Items {
-		f := FileTableItem{}
-		err = dynamodbattribute.UnmarshalMap(i, &f)
-		if err != nil {
-			return nil, fmt.Errorf("Got error unmarshalling: %s", err)
-		}
+// ErrFileNotFound is returned, possibly wrapped, for a FileID with no item
+var ErrFileNotFound = errors.New("item not found")
 
-		files = append(files, f)
-	}
+type OverwriteTableItem struct {
+	Modified string `json:"Modified"`
+	FileName string `json:"FileName"`
+}
 
-	return &files, nil
+type OverwriteKey struct {
+	FileID string `json:"FileID"`
 }
 
-func ListFilesDynamoDB(tableName string, userID string) (*[]FileTableItem, error) {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
+var (
+	dynamoDBOnce sync.Once
+	dynamoDBSvc  *dynamodb.DynamoDB
 
-	filt := expression.Name("UserID").Equal(expression.Value(userID))
+	signerMu     sync.Mutex
+	cachedSigner *sign.URLSigner
+)
 
-	expr, err := expression.NewBuilder().WithFilter(filt).Build()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build expression: %s", err)
-	}
+// dynamoDBClient talks to DynamoDB in us-west-2, or to DYNAMODB_ENDPOINT when set
+// (e.g. http://localhost:8000 for DynamoDB Local). The client is created once per
+// process and shared by every handler, which matters when they run in one Lambda.
+func dynamoDBClient() *dynamodb.DynamoDB {
+	dynamoDBOnce.Do(func() {
+		config := aws.NewConfig().WithRegion("us-west-2")
+		if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+			config = config.WithEndpoint(endpoint)
+		}
 
-	params := &dynamodb.ScanInput{
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		FilterExpression:          expr.Filter(),
-		TableName:                 aws.String(tableName),
-	}
+		dynamoDBSvc = dynamodb.New(session.New(), config)
+		dynamoDBSvc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("DynamoDBLatency"))
+		tracing.AWS(&dynamoDBSvc.Handlers)
+	})
 
-	result, err := svc.Scan(params)
-	if err != nil {
-		return nil, fmt.Errorf("query api call failed: %s", err)
-	}
+	return dynamoDBSvc
+}
 
-	var files []FileTableItem
+// OverwriteDynamoDB records new content for file under fileData's name, moving its name claim
+// if the name changed. The scan verdict stays until the new content lands, so an abandoned
+// overwrite leaves the old content servable. It returns ErrFileNotFound if the file was
+// deleted or renamed since it was read, and ErrFileNameTaken if another of the owner's files
+// has the new name.
+func OverwriteDynamoDB(ctx context.Context, filesTable string, namesTable string, file FileTableItem, fileData OverwriteTableItem) error {
+	items := renameItems(filesTable, namesTable, file, fileData.FileName, "SET Modified = :m, FileName = :f", map[string]*dynamodb.AttributeValue{
+		":m": {
+			S: aws.String(fileData.Modified),
+		},
+	})
 
-	for _, i := range result.Items {
-		f := FileTableItem{}
-		err = dynamodbattribute.UnmarshalMap(i, &f)
-		if err != nil {
-			return nil, fmt.Errorf("Got error unmarshalling: %s", err)
-		}
+	return renameFile(ctx, items)
+}
 
-		files = append(files, f)
-	}
+// ListAllFilesDynamoDB returns every file, following Scan pages past the 1MB limit
+func ListAllFilesDynamoDB(ctx context.Context, tableName string) (*[]FileTableItem, error) {
+	return listAllPages(ctx, tableName, "")
+}
 
-	return &files, nil
+// ListFilesDynamoDB returns every file owned by userID
+func ListFilesDynamoDB(ctx context.Context, tableName string, userID string) (*[]FileTableItem, error) {
+	return listAllPages(ctx, tableName, userID)
 }
 
-func DeleteDynamoDB(tableName string, fileID string) error {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
+func DeleteDynamoDB(ctx context.Context, tableName string, fileID string) error {
+	svc := dynamoDBClient()
 
-	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+	_, err := svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
 			"FileID": {
@@ -144,17 +185,16 @@ func DeleteDynamoDB(tableName string, fileID string) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("dynamodb responded with error: %v, error: %v\n", tableName, err)
+		return fmt.Errorf("dynamodb responded with error: %v, error: %v", tableName, err)
 	}
 
 	return nil
 }
 
-func GetFileDynamoDB(tableName string, fileID string) (*FileTableItem, error) {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
+func GetFileDynamoDB(ctx context.Context, tableName string, fileID string) (*FileTableItem, error) {
+	svc := dynamoDBClient()
 
-	result, err := svc.GetItem(&dynamodb.GetItemInput{
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
 		Key: map[string]*dynamodb.AttributeValue{
 			"FileID": {
@@ -163,28 +203,27 @@ func GetFileDynamoDB(tableName string, fileID string) (*FileTableItem, error) {
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v\n", tableName, err)
+		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", tableName, err)
 	}
 	if result.Item == nil {
-		return nil, fmt.Errorf("item not found tableName: %v, fileId: %v\n", fileID)
+		return nil, fmt.Errorf("%w tableName: %v, fileId: %v", ErrFileNotFound, tableName, fileID)
 	}
 	file := FileTableItem{}
 
 	err = dynamodbattribute.UnmarshalMap(result.Item, &file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal\n")
+		return nil, fmt.Errorf("failed to unmarshal")
 	}
 
 	return &file, nil
 }
 
-func PutDynamoDB(tableName string, fileData FileTableItem) error {
-	svc := dynamodb.New(session.New(),
-		aws.NewConfig().WithRegion("us-west-2"))
+func PutDynamoDB(ctx context.Context, tableName string, fileData FileTableItem) error {
+	svc := dynamoDBClient()
 
 	dynamoItem, err := dynamodbattribute.MarshalMap(fileData)
 	if err != nil {
-		return fmt.Errorf("failed to marshal fileData into dynamoItem %v\n", fileData)
+		return fmt.Errorf("failed to marshal fileData into dynamoItem %v", fileData)
 	}
 
 	input := &dynamodb.PutItemInput{
@@ -192,20 +231,22 @@ func PutDynamoDB(tableName string, fileData FileTableItem) error {
 		TableName: aws.String(tableName),
 	}
 
-	_, err = svc.PutItem(input)
+	_, err = svc.PutItemWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("PutItem error: %v\n", err)
+		return fmt.Errorf("PutItem error: %v", err)
 	}
 
 	return nil
 }
 
-func RetrieveSecret(secretName string) (string, error) {
+func RetrieveSecret(ctx context.Context, secretName string) (string, error) {
 	region := "us-west-2"
 
 	//Create a Secrets Manager client
 	svc := secretsmanager.New(session.New(),
 		aws.NewConfig().WithRegion(region))
+	svc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("SecretsManagerLatency"))
+	tracing.AWS(&svc.Handlers)
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId:     aws.String(secretName),
 		VersionStage: aws.String("AWSCURRENT"), // VersionStage defaults to AWSCURRENT if unspecified
@@ -214,35 +255,15 @@ func RetrieveSecret(secretName string) (string, error) {
 	// In this sample we only handle the specific exceptions for the 'GetSecretValue' API.
 	// See https://docs.aws.amazon.com/secretsmanager/latest/apireference/API_GetSecretValue.html
 
-	result, err := svc.GetSecretValue(input)
+	result, err := svc.GetSecretValueWithContext(ctx, input)
 	if err != nil {
+		// the codes worth telling apart are DecryptionFailure (the KMS key cannot decrypt it),
+		// ResourceNotFoundException and the invalid parameter/request exceptions
+		code := ""
 		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case secretsmanager.ErrCodeDecryptionFailure:
-				// Secrets Manager can't decrypt the protected secret text using the provided KMS key.
-				fmt.Println(secretsmanager.ErrCodeDecryptionFailure, aerr.Error())
-
-			case secretsmanager.ErrCodeInternalServiceError:
-				// An error occurred on the server side.
-				fmt.Println(secretsmanager.ErrCodeInternalServiceError, aerr.Error())
-
-			case secretsmanager.ErrCodeInvalidParameterException:
-				// You provided an invalid value for a parameter.
-				fmt.Println(secretsmanager.ErrCodeInvalidParameterException, aerr.Error())
-
-			case secretsmanager.ErrCodeInvalidRequestException:
-				// You provided a parameter value that is not valid for the current state of the resource.
-				fmt.Println(secretsmanager.ErrCodeInvalidRequestException, aerr.Error())
-
-			case secretsmanager.ErrCodeResourceNotFoundException:
-				// We can't find the resource that you asked for.
-				fmt.Println(secretsmanager.ErrCodeResourceNotFoundException, aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+			code = aerr.Code()
 		}
+		logging.FromContext(ctx).Error("failed to retrieve secret", "secret", secretName, "code", code, "error", err)
 		return "", err
 	}
 
@@ -259,29 +280,62 @@ func RetrieveSecret(secretName string) (string, error) {
 	return secretString, nil
 }
 
-func SignURL(rawURL string) (string, error) {
+func SignURL(ctx context.Context, rawURL string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "CloudFront.SignURL")
+	defer span.End()
+
+	signer, err := urlSigner(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	signedURL, err := signer.Sign(rawURL, time.Now().Add(1*time.Hour))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign url")
+	}
+
+	return signedURL, nil
+}
+
+// urlSigner loads the CloudFront key pair from Secrets Manager on first use and keeps the
+// signer for the life of the process. Failures are not cached so the next call retries.
+func urlSigner(ctx context.Context) (*sign.URLSigner, error) {
+	signerMu.Lock()
+	defer signerMu.Unlock()
+
+	if cachedSigner != nil {
+		return cachedSigner, nil
+	}
+
 	privateKeyARN := "arn:aws:secretsmanager:us-west-2:988203901673:secret:dev-file-management-private-key-eZTVru"
-	privateKeyString, err := RetrieveSecret(privateKeyARN)
+	privateKeyString, err := RetrieveSecret(ctx, privateKeyARN)
 	if err != nil {
-		fmt.Printf("failed to retrieve private key %v\n", privateKeyARN)
+		return nil, fmt.Errorf("failed to retrieve private key %v", privateKeyARN)
 	}
 
 	publicIDARN := "arn:aws:secretsmanager:us-west-2:988203901673:secret:dev-file-management-public-id-tyo5xL"
-	publicIDString, err := RetrieveSecret(publicIDARN)
+	publicIDString, err := RetrieveSecret(ctx, publicIDARN)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve publicID %v", publicIDARN)
+		return nil, fmt.Errorf("failed to retrieve publicID %v", publicIDARN)
 	}
 
 	privateKey, err := sign.LoadPEMPrivKey(strings.NewReader(privateKeyString))
 	if err != nil {
-		return "", fmt.Errorf("failed to parse primary key")
+		return nil, fmt.Errorf("failed to parse primary key")
 	}
 
-	signer := sign.NewURLSigner(publicIDString, privateKey)
-	signedURL, err := signer.Sign(rawURL, time.Now().Add(1*time.Hour))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign url")
+	cachedSigner = sign.NewURLSigner(publicIDString, privateKey)
+	return cachedSigner, nil
+}
+
+// RenameFileDynamoDB changes file's FileName and moves its name claim, leaving Modified alone
+// since the content did not change. It returns ErrFileNotFound if the file was deleted or
+// renamed since it was read, and ErrFileNameTaken if another of the owner's files has the name.
+func RenameFileDynamoDB(ctx context.Context, filesTable string, namesTable string, file FileTableItem, fileName string) (*FileTableItem, error) {
+	items := renameItems(filesTable, namesTable, file, fileName, "SET FileName = :f", map[string]*dynamodb.AttributeValue{})
+	if err := renameFile(ctx, items); err != nil {
+		return nil, err
 	}
 
-	return signedURL, nil
+	return GetFileDynamoDB(ctx, filesTable, file.FileID)
 }
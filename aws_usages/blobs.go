@@ -0,0 +1,366 @@
+package aws_usages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// BlobTableItem is content stored once for every one of a user's files with the same SHA-256,
+// keyed by UserID and SHA256. Key is where the content is stored and RefCount how many files
+// point at it. The verdicts reached on the content when it was first uploaded are kept, so
+// files that share it need not be scanned again.
+type BlobTableItem struct {
+	UserID      string      `json:"UserID"`
+	SHA256      string      `json:"SHA256"`
+	Key         string      `json:"Key"`
+	Size        int64       `json:"Size"`
+	RefCount    int64       `json:"RefCount"`
+	ScanStatus  string      `json:"ScanStatus"`
+	Scanned     string      `json:"Scanned,omitempty"`
+	ContentType string      `json:"ContentType,omitempty"`
+	Thumbnails  []Thumbnail `json:"Thumbnails,omitempty"`
+	Created     string      `json:"Created"`
+}
+
+var (
+	// ErrBlobNotFound is returned for a digest the user has no blob of, or one whose last
+	// reference has gone and which is about to be deleted
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrBlobExists is returned by RegisterBlobDynamoDB when the user already has the digest
+	ErrBlobExists = errors.New("blob already exists")
+)
+
+func blobKey(userID string, sha256 string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"UserID": {
+			S: aws.String(userID),
+		},
+		"SHA256": {
+			S: aws.String(sha256),
+		},
+	}
+}
+
+// GetBlobDynamoDB returns the user's blob with the digest, or ErrBlobNotFound
+func GetBlobDynamoDB(ctx context.Context, tableName string, userID string, sha256 string) (*BlobTableItem, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+		Key:            blobKey(userID, sha256),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", tableName, err)
+	}
+	if result.Item == nil {
+		return nil, ErrBlobNotFound
+	}
+
+	blob := BlobTableItem{}
+	if err = dynamodbattribute.UnmarshalMap(result.Item, &blob); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal blob: %v, error: %v", sha256, err)
+	}
+	if blob.RefCount <= 0 {
+		return nil, ErrBlobNotFound
+	}
+
+	return &blob, nil
+}
+
+// RegisterBlobDynamoDB records a new blob with the file whose content it holds as its only
+// reference, pointing the file at it in the same transaction. It returns ErrBlobExists if the
+// user already has a blob of the digest, and ErrFileNotFound if the file is gone.
+func RegisterBlobDynamoDB(ctx context.Context, filesTable string, blobsTable string, fileID string, blob BlobTableItem) error {
+	svc := dynamoDBClient()
+
+	blob.RefCount = 1
+	item, err := dynamodbattribute.MarshalMap(blob)
+	if err != nil {
+		return fmt.Errorf("failed to marshal blob %v", blob.SHA256)
+	}
+
+	_, err = svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(blobsTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(SHA256)"),
+				},
+			},
+			{
+				Update: setBlobKey(filesTable, fileID, blob.Key),
+			},
+		},
+	})
+	if err != nil {
+		if conditionFailed(err, 0) {
+			return ErrBlobExists
+		}
+		if conditionFailed(err, 1) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// AttachBlobDynamoDB points an existing file at the user's blob and counts the reference.
+// It returns ErrBlobNotFound if the blob lost its last reference in the meantime.
+func AttachBlobDynamoDB(ctx context.Context, filesTable string, blobsTable string, fileID string, blob BlobTableItem) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: addBlobReference(blobsTable, blob.UserID, blob.SHA256, 1),
+			},
+			{
+				Update: setBlobKey(filesTable, fileID, blob.Key),
+			},
+		},
+	})
+	if err != nil {
+		if conditionFailed(err, 0) {
+			return ErrBlobNotFound
+		}
+		if conditionFailed(err, 1) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// CommitBlobFileDynamoDB is CommitFileDynamoDB for a file whose content is the blob named by
+// its BlobKey and SHA256, counting the reference in the same transaction. It returns
+// ErrBlobNotFound if the blob lost its last reference in the meantime.
+func CommitBlobFileDynamoDB(ctx context.Context, filesTable string, quotaTable string, blobsTable string, namesTable string, fileData FileTableItem, maxBytes int64, maxFiles int64) error {
+	svc := dynamoDBClient()
+
+	fileData.QuotaCharged = true
+	dynamoItem, err := dynamodbattribute.MarshalMap(fileData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fileData into dynamoItem %v", fileData)
+	}
+
+	_, err = svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(filesTable),
+					Item:                dynamoItem,
+					ConditionExpression: aws.String("attribute_not_exists(FileID)"),
+				},
+			},
+			{
+				Update: chargeQuota(quotaTable, fileData, maxBytes, maxFiles),
+			},
+			{
+				Update: addBlobReference(blobsTable, fileData.UserID, fileData.SHA256, 1),
+			},
+			claimName(namesTable, fileData.UserID, fileData.FileName, fileData.FileID),
+		},
+	})
+	if err != nil {
+		if conditionFailed(err, 1) {
+			return ErrQuotaExceeded
+		}
+		if conditionFailed(err, 2) {
+			return ErrBlobNotFound
+		}
+		if conditionFailed(err, 3) {
+			return ErrFileNameTaken
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteBlobFileDynamoDB is DeleteFileDynamoDB for a file pointing at a blob, giving up its
+// reference in the same transaction. The blob is left for DeleteBlobDynamoDB even when that
+// was its last reference.
+func DeleteBlobFileDynamoDB(ctx context.Context, filesTable string, quotaTable string, blobsTable string, namesTable string, fileData FileTableItem) error {
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String(filesTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"FileID": {
+						S: aws.String(fileData.FileID),
+					},
+				},
+				ConditionExpression: aws.String("attribute_exists(FileID)"),
+			},
+		},
+		{
+			Update: addBlobReference(blobsTable, fileData.UserID, fileData.SHA256, -1),
+		},
+	}
+	if fileData.QuotaCharged {
+		items = append(items, &dynamodb.TransactWriteItem{Update: releaseQuota(quotaTable, fileData)})
+	}
+	items = append(items, releaseName(namesTable, fileData.UserID, fileData.FileName, fileData.FileID))
+
+	if err := transactWithRelease(ctx, items); err != nil {
+		if conditionFailed(err, 0) {
+			return ErrFileNotFound
+		}
+		if conditionFailed(err, 1) {
+			return ErrBlobNotFound
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// DetachBlobDynamoDB stops a file pointing at its blob, giving up the reference, when its own
+// content replaces the blob's. The thumbnails, which were the blob's, go with it.
+func DetachBlobDynamoDB(ctx context.Context, filesTable string, blobsTable string, fileData FileTableItem) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String(filesTable),
+					Key: map[string]*dynamodb.AttributeValue{
+						"FileID": {
+							S: aws.String(fileData.FileID),
+						},
+					},
+					ConditionExpression: aws.String("BlobKey = :k"),
+					UpdateExpression:    aws.String("REMOVE BlobKey, SHA256, Thumbnails"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":k": {
+							S: aws.String(fileData.BlobKey),
+						},
+					},
+				},
+			},
+			{
+				Update: addBlobReference(blobsTable, fileData.UserID, fileData.SHA256, -1),
+			},
+		},
+	})
+	if err != nil {
+		if conditionFailed(err, 0) {
+			return ErrFileNotFound
+		}
+		if conditionFailed(err, 1) {
+			return ErrBlobNotFound
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteBlobDynamoDB removes the user's blob of the digest if no file points at it any more,
+// returning it so its content can be removed, or ErrBlobNotFound if it is still referenced
+// or already gone
+func DeleteBlobDynamoDB(ctx context.Context, tableName string, userID string, sha256 string) (*BlobTableItem, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 blobKey(userID, sha256),
+		ConditionExpression: aws.String("RefCount <= :zero"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":zero": {
+				N: aws.String("0"),
+			},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DeleteItem error: %v", err)
+	}
+
+	blob := BlobTableItem{}
+	if err = dynamodbattribute.UnmarshalMap(result.Attributes, &blob); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal blob: %v, error: %v", sha256, err)
+	}
+
+	return &blob, nil
+}
+
+// addBlobReference counts delta references to a blob. Adding needs a live blob, so one whose
+// last reference went cannot be revived while it is being deleted.
+func addBlobReference(tableName string, userID string, sha256 string, delta int64) *dynamodb.Update {
+	condition := "attribute_exists(SHA256)"
+	values := map[string]*dynamodb.AttributeValue{
+		":delta": {N: aws.String(strconv.FormatInt(delta, 10))},
+	}
+	if delta > 0 {
+		condition += " AND RefCount > :zero"
+		values[":zero"] = &dynamodb.AttributeValue{N: aws.String("0")}
+	}
+
+	return &dynamodb.Update{
+		TableName:                 aws.String(tableName),
+		Key:                       blobKey(userID, sha256),
+		UpdateExpression:          aws.String("ADD RefCount :delta"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}
+}
+
+func setBlobKey(tableName string, fileID string, key string) *dynamodb.Update {
+	return &dynamodb.Update{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID)"),
+		UpdateExpression:    aws.String("SET BlobKey = :k"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":k": {
+				S: aws.String(key),
+			},
+		},
+	}
+}
+
+// ClearSHA256DynamoDB forgets the digest declared for a file's content before it is
+// overwritten, so the new content is not checked against it. A file pointing at a blob keeps
+// its digest until the new content arrives and the blob is detached.
+func ClearSHA256DynamoDB(ctx context.Context, tableName string, fileID string) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID) AND attribute_not_exists(BlobKey)"),
+		UpdateExpression:    aws.String("REMOVE SHA256"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SetContentTypeDynamoDB records the type detected from a file's content. It returns
+// ErrFileNotFound if the item no longer exists.
+func SetContentTypeDynamoDB(ctx context.Context, tableName string, fileID string, contentType string) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID)"),
+		UpdateExpression:    aws.String("SET ContentType = :c"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":c": {
+				S: aws.String(contentType),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,758 @@
+// Package dynamotest is an in-process stand-in for DynamoDB that speaks the DynamoDB JSON
+// protocol, so aws_usages can be exercised end to end by pointing DYNAMODB_ENDPOINT at it.
+//
+// It supports the calls this repo makes (GetItem, PutItem, UpdateItem, DeleteItem, Scan,
+// Query, TransactWriteItems, CreateTable) and the expression syntax they use, and can record a
+// table's changes as stream records with NEW_AND_OLD_IMAGES. It does not model capacity, item
+// size limits or eventual consistency.
+package dynamotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type table struct {
+	hashKey  string
+	rangeKey string
+	indexes  map[string][2]string
+	items    map[string]item
+
+	// streaming tables append a record for each change, until StreamRecords takes them
+	streaming bool
+	sequence  int64
+	records   []events.DynamoDBEventRecord
+}
+
+// Server is a fake DynamoDB endpoint. Callers must Close it.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+// NewServer starts an empty fake DynamoDB
+func NewServer() *Server {
+	s := &Server{tables: map[string]*table{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// CreateTable adds a table keyed by hashKey and, if not empty, rangeKey
+func (s *Server) CreateTable(name string, hashKey string, rangeKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[name] = &table{
+		hashKey:  hashKey,
+		rangeKey: rangeKey,
+		indexes:  map[string][2]string{},
+		items:    map[string]item{},
+	}
+}
+
+// CreateIndex adds a global secondary index over an existing table for Query
+func (s *Server) CreateIndex(tableName string, indexName string, hashKey string, rangeKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[tableName].indexes[indexName] = [2]string{hashKey, rangeKey}
+}
+
+// EnableStream starts recording the table's changes for StreamRecords
+func (s *Server) EnableStream(tableName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[tableName].streaming = true
+}
+
+// StreamRecords returns the table's changes since the last call, oldest first, as a Lambda
+// stream trigger would receive them
+func (s *Server) StreamRecords(tableName string) []events.DynamoDBEventRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tables[tableName]
+	records := t.records
+	t.records = nil
+	return records
+}
+
+// Items returns a snapshot of every item in the table
+func (s *Server) Items(tableName string) []map[string]*dynamodb.AttributeValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, found := s.tables[tableName]
+	if !found {
+		return nil
+	}
+
+	var out []map[string]*dynamodb.AttributeValue
+	for _, k := range sortedKeys(t.items) {
+		out = append(out, t.items[k])
+	}
+	return out
+}
+
+type apiError struct {
+	code    string
+	message string
+	extra   map[string]interface{}
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func validationError(format string, args ...interface{}) *apiError {
+	return &apiError{code: "ValidationException", message: fmt.Sprintf(format, args...)}
+}
+
+var conditionFailed = &apiError{code: "ConditionalCheckFailedException", message: "The conditional request failed"}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, validationError("failed to read body: %v", err))
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	op := target[strings.LastIndex(target, ".")+1:]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out interface{}
+	var aerr *apiError
+	switch op {
+	case "CreateTable":
+		out, aerr = s.createTable(body)
+	case "GetItem":
+		out, aerr = s.getItem(body)
+	case "PutItem":
+		out, aerr = s.putItem(body)
+	case "UpdateItem":
+		out, aerr = s.updateItem(body)
+	case "DeleteItem":
+		out, aerr = s.deleteItem(body)
+	case "Scan":
+		out, aerr = s.scan(body)
+	case "Query":
+		out, aerr = s.query(body)
+	case "TransactWriteItems":
+		out, aerr = s.transactWriteItems(body)
+	default:
+		aerr = &apiError{code: "UnknownOperationException", message: "unsupported operation " + target}
+	}
+
+	if aerr != nil {
+		writeError(w, aerr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(out)
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	payload := map[string]interface{}{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + e.code,
+		"message": e.message,
+	}
+	for k, v := range e.extra {
+		payload[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(payload)
+}
+
+func (s *Server) table(name *string) (*table, *apiError) {
+	if name == nil {
+		return nil, validationError("TableName is required")
+	}
+	t, found := s.tables[*name]
+	if !found {
+		return nil, &apiError{code: "ResourceNotFoundException", message: "Requested resource not found: " + *name}
+	}
+	return t, nil
+}
+
+func (t *table) keyOf(it item) (string, *apiError) {
+	return keyString(it, t.hashKey, t.rangeKey)
+}
+
+// set stores or, for a nil item, deletes the item at key and records the change. As in
+// DynamoDB, writes that change nothing are not recorded.
+func (t *table) set(key string, it item) {
+	old, found := t.items[key]
+	if it == nil {
+		delete(t.items, key)
+	} else {
+		t.items[key] = it
+	}
+
+	if !t.streaming || reflect.DeepEqual(old, it) {
+		return
+	}
+
+	record := events.DynamoDBEventRecord{EventName: "MODIFY", EventSource: "aws:dynamodb", AWSRegion: "us-west-2"}
+	switch {
+	case !found:
+		record.EventName = "INSERT"
+	case it == nil:
+		record.EventName = "REMOVE"
+	}
+
+	image := it
+	if image == nil {
+		image = old
+	}
+	keys := item{t.hashKey: image[t.hashKey]}
+	if t.rangeKey != "" {
+		keys[t.rangeKey] = image[t.rangeKey]
+	}
+
+	t.sequence++
+	record.EventID = strconv.FormatInt(t.sequence, 10)
+	record.Change = events.DynamoDBStreamRecord{
+		ApproximateCreationDateTime: events.SecondsEpochTime{Time: time.Now()},
+		Keys:                        streamImage(keys),
+		SequenceNumber:              fmt.Sprintf("%021d", t.sequence),
+		StreamViewType:              "NEW_AND_OLD_IMAGES",
+	}
+	if found {
+		record.Change.OldImage = streamImage(old)
+	}
+	if it != nil {
+		record.Change.NewImage = streamImage(it)
+	}
+	t.records = append(t.records, record)
+}
+
+// streamImage converts an item to the stream's attribute values through their shared wire form
+func streamImage(it item) map[string]events.DynamoDBAttributeValue {
+	var image map[string]events.DynamoDBAttributeValue
+	js, _ := json.Marshal(encodeItem(it))
+	json.Unmarshal(js, &image)
+	return image
+}
+
+func keyString(it item, hashKey string, rangeKey string) (string, *apiError) {
+	h, found := it[hashKey]
+	if !found || h == nil {
+		return "", validationError("missing key attribute %v", hashKey)
+	}
+	key := attrString(h)
+	if rangeKey != "" {
+		r, found := it[rangeKey]
+		if !found || r == nil {
+			return "", validationError("missing key attribute %v", rangeKey)
+		}
+		key += "\x00" + attrString(r)
+	}
+	return key, nil
+}
+
+func attrString(v *dynamodb.AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return "S" + *v.S
+	case v.N != nil:
+		return "N" + *v.N
+	case v.B != nil:
+		return "B" + string(v.B)
+	}
+	return "?"
+}
+
+func (s *Server) createTable(body []byte) (interface{}, *apiError) {
+	var in dynamodb.CreateTableInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	var hash, rng string
+	for _, k := range in.KeySchema {
+		if *k.KeyType == dynamodb.KeyTypeHash {
+			hash = *k.AttributeName
+		} else {
+			rng = *k.AttributeName
+		}
+	}
+
+	t := &table{hashKey: hash, rangeKey: rng, indexes: map[string][2]string{}, items: map[string]item{}}
+	for _, gsi := range in.GlobalSecondaryIndexes {
+		var ih, ir string
+		for _, k := range gsi.KeySchema {
+			if *k.KeyType == dynamodb.KeyTypeHash {
+				ih = *k.AttributeName
+			} else {
+				ir = *k.AttributeName
+			}
+		}
+		t.indexes[*gsi.IndexName] = [2]string{ih, ir}
+	}
+	s.tables[*in.TableName] = t
+
+	return map[string]interface{}{
+		"TableDescription": map[string]interface{}{"TableName": *in.TableName, "TableStatus": "ACTIVE"},
+	}, nil
+}
+
+func (s *Server) getItem(body []byte) (interface{}, *apiError) {
+	var in dynamodb.GetItemInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, aerr
+	}
+	key, aerr := t.keyOf(in.Key)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	out := map[string]interface{}{}
+	if it, found := t.items[key]; found {
+		out["Item"] = encodeItem(it)
+	}
+	return out, nil
+}
+
+func (s *Server) putItem(body []byte) (interface{}, *apiError) {
+	var in dynamodb.PutItemInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	put := &dynamodb.Put{
+		TableName:                 in.TableName,
+		Item:                      in.Item,
+		ConditionExpression:       in.ConditionExpression,
+		ExpressionAttributeNames:  in.ExpressionAttributeNames,
+		ExpressionAttributeValues: in.ExpressionAttributeValues,
+	}
+	apply, aerr := s.preparePut(put)
+	if aerr != nil {
+		return nil, aerr
+	}
+	apply()
+
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) updateItem(body []byte) (interface{}, *apiError) {
+	var in dynamodb.UpdateItemInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	update := &dynamodb.Update{
+		TableName:                 in.TableName,
+		Key:                       in.Key,
+		UpdateExpression:          in.UpdateExpression,
+		ConditionExpression:       in.ConditionExpression,
+		ExpressionAttributeNames:  in.ExpressionAttributeNames,
+		ExpressionAttributeValues: in.ExpressionAttributeValues,
+	}
+	apply, updated, aerr := s.prepareUpdate(update)
+	if aerr != nil {
+		return nil, aerr
+	}
+	apply()
+
+	out := map[string]interface{}{}
+	if in.ReturnValues != nil && *in.ReturnValues != dynamodb.ReturnValueNone {
+		out["Attributes"] = encodeItem(updated)
+	}
+	return out, nil
+}
+
+func (s *Server) deleteItem(body []byte) (interface{}, *apiError) {
+	var in dynamodb.DeleteItemInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	del := &dynamodb.Delete{
+		TableName:                 in.TableName,
+		Key:                       in.Key,
+		ConditionExpression:       in.ConditionExpression,
+		ExpressionAttributeNames:  in.ExpressionAttributeNames,
+		ExpressionAttributeValues: in.ExpressionAttributeValues,
+	}
+	apply, old, aerr := s.prepareDelete(del)
+	if aerr != nil {
+		return nil, aerr
+	}
+	apply()
+
+	out := map[string]interface{}{}
+	if in.ReturnValues != nil && *in.ReturnValues == dynamodb.ReturnValueAllOld && old != nil {
+		out["Attributes"] = encodeItem(old)
+	}
+	return out, nil
+}
+
+// prepare* check a write's condition and return a closure that performs it, so
+// TransactWriteItems can check every condition before applying anything
+
+func (s *Server) preparePut(in *dynamodb.Put) (func(), *apiError) {
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, aerr
+	}
+	key, aerr := t.keyOf(in.Item)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	if aerr := checkCondition(in.ConditionExpression, ctx, t.items[key]); aerr != nil {
+		return nil, aerr
+	}
+
+	return func() { t.set(key, in.Item) }, nil
+}
+
+func (s *Server) prepareUpdate(in *dynamodb.Update) (func(), item, *apiError) {
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+	key, aerr := t.keyOf(in.Key)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	old := t.items[key]
+	if aerr := checkCondition(in.ConditionExpression, ctx, old); aerr != nil {
+		return nil, nil, aerr
+	}
+
+	base := item{}
+	for k, v := range in.Key {
+		base[k] = v
+	}
+	for k, v := range old {
+		base[k] = v
+	}
+
+	expr := ""
+	if in.UpdateExpression != nil {
+		expr = *in.UpdateExpression
+	}
+	updated, err := applyUpdate(expr, ctx, base)
+	if err != nil {
+		return nil, nil, validationError("%v", err)
+	}
+
+	return func() { t.set(key, updated) }, updated, nil
+}
+
+func (s *Server) prepareDelete(in *dynamodb.Delete) (func(), item, *apiError) {
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+	key, aerr := t.keyOf(in.Key)
+	if aerr != nil {
+		return nil, nil, aerr
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	old := t.items[key]
+	if aerr := checkCondition(in.ConditionExpression, ctx, old); aerr != nil {
+		return nil, nil, aerr
+	}
+
+	return func() { t.set(key, nil) }, old, nil
+}
+
+func (s *Server) prepareConditionCheck(in *dynamodb.ConditionCheck) (func(), *apiError) {
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, aerr
+	}
+	key, aerr := t.keyOf(in.Key)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	if aerr := checkCondition(in.ConditionExpression, ctx, t.items[key]); aerr != nil {
+		return nil, aerr
+	}
+
+	return func() {}, nil
+}
+
+func checkCondition(expr *string, ctx exprContext, it item) *apiError {
+	if expr == nil {
+		return nil
+	}
+	ok, err := evalCondition(*expr, ctx, it)
+	if err != nil {
+		return validationError("%v", err)
+	}
+	if !ok {
+		return conditionFailed
+	}
+	return nil
+}
+
+func (s *Server) transactWriteItems(body []byte) (interface{}, *apiError) {
+	var in dynamodb.TransactWriteItemsInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	var applies []func()
+	var reasons []map[string]interface{}
+	cancelled := false
+	for _, ti := range in.TransactItems {
+		var apply func()
+		var aerr *apiError
+		switch {
+		case ti.Put != nil:
+			apply, aerr = s.preparePut(ti.Put)
+		case ti.Update != nil:
+			apply, _, aerr = s.prepareUpdate(ti.Update)
+		case ti.Delete != nil:
+			apply, _, aerr = s.prepareDelete(ti.Delete)
+		case ti.ConditionCheck != nil:
+			apply, aerr = s.prepareConditionCheck(ti.ConditionCheck)
+		default:
+			aerr = validationError("empty TransactWriteItem")
+		}
+
+		switch {
+		case aerr == conditionFailed:
+			cancelled = true
+			reasons = append(reasons, map[string]interface{}{"Code": "ConditionalCheckFailed", "Message": aerr.message})
+		case aerr != nil:
+			return nil, aerr
+		default:
+			applies = append(applies, apply)
+			reasons = append(reasons, map[string]interface{}{"Code": "None"})
+		}
+	}
+
+	if cancelled {
+		var codes []string
+		for _, r := range reasons {
+			codes = append(codes, r["Code"].(string))
+		}
+		return nil, &apiError{
+			code:    "TransactionCanceledException",
+			message: "Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]",
+			extra:   map[string]interface{}{"CancellationReasons": reasons},
+		}
+	}
+
+	for _, apply := range applies {
+		apply()
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (s *Server) scan(body []byte) (interface{}, *apiError) {
+	var in dynamodb.ScanInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	var items []item
+	for _, k := range sortedKeys(t.items) {
+		items = append(items, t.items[k])
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	return page(items, t.hashKey, t.rangeKey, in.ExclusiveStartKey, in.Limit, in.FilterExpression, ctx)
+}
+
+func (s *Server) query(body []byte) (interface{}, *apiError) {
+	var in dynamodb.QueryInput
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, validationError("%v", err)
+	}
+
+	t, aerr := s.table(in.TableName)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	hash, rng := t.hashKey, t.rangeKey
+	if in.IndexName != nil {
+		idx, found := t.indexes[*in.IndexName]
+		if !found {
+			return nil, validationError("table has no index %v", *in.IndexName)
+		}
+		hash, rng = idx[0], idx[1]
+	}
+	if in.KeyConditionExpression == nil {
+		return nil, validationError("KeyConditionExpression is required")
+	}
+
+	ctx := exprContext{names: in.ExpressionAttributeNames, values: in.ExpressionAttributeValues}
+	var items []item
+	for _, it := range t.items {
+		if _, indexed := it[hash]; !indexed {
+			continue
+		}
+		ok, err := evalCondition(*in.KeyConditionExpression, ctx, it)
+		if err != nil {
+			return nil, validationError("%v", err)
+		}
+		if ok {
+			items = append(items, it)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if rng != "" {
+			if c, ok := compare(items[i][rng], items[j][rng]); ok && c != 0 {
+				return c < 0
+			}
+		}
+		ki, _ := t.keyOf(items[i])
+		kj, _ := t.keyOf(items[j])
+		return ki < kj
+	})
+	if in.ScanIndexForward != nil && !*in.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	return page(items, t.hashKey, t.rangeKey, in.ExclusiveStartKey, in.Limit, in.FilterExpression, ctx)
+}
+
+// page applies ExclusiveStartKey, Limit (counted before filtering, as DynamoDB does) and the filter
+func page(items []item, hashKey string, rangeKey string, start map[string]*dynamodb.AttributeValue,
+	limit *int64, filter *string, ctx exprContext) (interface{}, *apiError) {
+	if start != nil {
+		startKey, aerr := keyString(start, hashKey, rangeKey)
+		if aerr != nil {
+			return nil, aerr
+		}
+		for i, it := range items {
+			if k, _ := keyString(it, hashKey, rangeKey); k == startKey {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+
+	var last item
+	if limit != nil && int64(len(items)) > *limit {
+		items = items[:*limit]
+		last = items[len(items)-1]
+	}
+
+	var matched []interface{}
+	scanned := len(items)
+	for _, it := range items {
+		ok := true
+		if filter != nil {
+			var err error
+			if ok, err = evalCondition(*filter, ctx, it); err != nil {
+				return nil, validationError("%v", err)
+			}
+		}
+		if ok {
+			matched = append(matched, encodeItem(it))
+		}
+	}
+	if matched == nil {
+		matched = []interface{}{}
+	}
+
+	out := map[string]interface{}{
+		"Items":        matched,
+		"Count":        len(matched),
+		"ScannedCount": scanned,
+	}
+	if last != nil {
+		key := item{hashKey: last[hashKey]}
+		if rangeKey != "" {
+			key[rangeKey] = last[rangeKey]
+		}
+		out["LastEvaluatedKey"] = encodeItem(key)
+	}
+	return out, nil
+}
+
+func sortedKeys(items map[string]item) []string {
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeItem writes attribute values in wire form, leaving out the SDK struct's nil fields
+func encodeItem(it item) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range it {
+		out[k] = encodeValue(v)
+	}
+	return out
+}
+
+func encodeValue(v *dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case v.S != nil:
+		return map[string]interface{}{"S": *v.S}
+	case v.N != nil:
+		return map[string]interface{}{"N": *v.N}
+	case v.B != nil:
+		return map[string]interface{}{"B": v.B}
+	case v.BOOL != nil:
+		return map[string]interface{}{"BOOL": *v.BOOL}
+	case v.NULL != nil:
+		return map[string]interface{}{"NULL": *v.NULL}
+	case v.SS != nil:
+		return map[string]interface{}{"SS": v.SS}
+	case v.NS != nil:
+		return map[string]interface{}{"NS": v.NS}
+	case v.BS != nil:
+		return map[string]interface{}{"BS": v.BS}
+	case v.M != nil:
+		return map[string]interface{}{"M": encodeItem(v.M)}
+	case v.L != nil:
+		l := make([]interface{}, len(v.L))
+		for i, e := range v.L {
+			l[i] = encodeValue(e)
+		}
+		return map[string]interface{}{"L": l}
+	}
+	return map[string]interface{}{"NULL": true}
+}
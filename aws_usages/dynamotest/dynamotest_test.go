@@ -0,0 +1,219 @@
+package dynamotest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+func newClient(t *testing.T, s *Server) *dynamodb.DynamoDB {
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	sess, err := session.NewSession(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(s.URL).
+		WithCredentials(credentials.NewStaticCredentials("test", "test", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dynamodb.New(sess)
+}
+
+func str(s string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{S: aws.String(s)} }
+func num(n string) *dynamodb.AttributeValue { return &dynamodb.AttributeValue{N: aws.String(n)} }
+
+func TestPutGetUpdateDelete(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CreateTable("files", "FileID", "")
+	svc := newClient(t, s)
+
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("files"),
+		Item:      map[string]*dynamodb.AttributeValue{"FileID": str("f1"), "UserID": str("u1"), "Size": num("10")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("files"),
+		Key:                       map[string]*dynamodb.AttributeValue{"FileID": str("f1")},
+		UpdateExpression:          aws.String("SET FileName = :n ADD Size :d REMOVE UserID"),
+		ConditionExpression:       aws.String("attribute_exists(FileID) AND Size <= :max"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":n": str("a.txt"), ":d": num("-3"), ":max": num("10")},
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(out.Attributes["Size"].N) != "7" || out.Attributes["UserID"] != nil ||
+		aws.StringValue(out.Attributes["FileName"].S) != "a.txt" {
+		t.Errorf("attributes = %v", out.Attributes)
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("files"),
+		Item:                map[string]*dynamodb.AttributeValue{"FileID": str("f1")},
+		ConditionExpression: aws.String("attribute_not_exists(FileID)"),
+	})
+	if _, ok := err.(*dynamodb.ConditionalCheckFailedException); !ok {
+		t.Errorf("expected ConditionalCheckFailedException, got %v", err)
+	}
+
+	if _, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("files"),
+		Key:       map[string]*dynamodb.AttributeValue{"FileID": str("f1")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("files"),
+		Key:       map[string]*dynamodb.AttributeValue{"FileID": str("f1")},
+	})
+	if err != nil || got.Item != nil {
+		t.Errorf("GetItem after delete = %v, %v", got.Item, err)
+	}
+}
+
+func TestScanFilterAndTransaction(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CreateTable("files", "FileID", "")
+	s.CreateTable("quotas", "UserID", "")
+	svc := newClient(t, s)
+
+	for _, id := range []string{"f1", "f2", "f3"} {
+		user := "u1"
+		if id == "f3" {
+			user = "u2"
+		}
+		svc.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String("files"),
+			Item:      map[string]*dynamodb.AttributeValue{"FileID": str(id), "UserID": str(user)},
+		})
+	}
+
+	expr, _ := expression.NewBuilder().WithFilter(expression.Name("UserID").Equal(expression.Value("u1"))).Build()
+	out, err := svc.Scan(&dynamodb.ScanInput{
+		TableName:                 aws.String("files"),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil || len(out.Items) != 2 {
+		t.Fatalf("Scan = %v items, %v", len(out.Items), err)
+	}
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{
+				TableName: aws.String("files"),
+				Item:      map[string]*dynamodb.AttributeValue{"FileID": str("f4"), "UserID": str("u1")},
+			}},
+			{Update: &dynamodb.Update{
+				TableName:                 aws.String("quotas"),
+				Key:                       map[string]*dynamodb.AttributeValue{"UserID": str("u1")},
+				UpdateExpression:          aws.String("ADD FileCount :one"),
+				ConditionExpression:       aws.String("attribute_exists(FileCount)"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":one": num("1")},
+			}},
+		},
+	})
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		t.Fatalf("expected TransactionCanceledException, got %v", err)
+	}
+	if len(canceled.CancellationReasons) != 2 || aws.StringValue(canceled.CancellationReasons[1].Code) != "ConditionalCheckFailed" {
+		t.Errorf("reasons = %v", canceled.CancellationReasons)
+	}
+	if n := len(s.Items("files")); n != 3 {
+		t.Errorf("cancelled transaction wrote its Put: %d files", n)
+	}
+}
+
+func TestQueryIndex(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CreateTable("audit", "EntryID", "")
+	s.CreateIndex("audit", "ByUser", "UserID", "Timestamp")
+	svc := newClient(t, s)
+
+	for i, ts := range []string{"3", "1", "2"} {
+		svc.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String("audit"),
+			Item:      map[string]*dynamodb.AttributeValue{"EntryID": num(ts), "UserID": str("u1"), "Timestamp": str(ts)},
+		})
+		_ = i
+	}
+
+	out, err := svc.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String("audit"),
+		IndexName:                 aws.String("ByUser"),
+		KeyConditionExpression:    aws.String("UserID = :u AND #ts >= :from"),
+		ExpressionAttributeNames:  map[string]*string{"#ts": aws.String("Timestamp")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":u": str("u1"), ":from": str("2")},
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != 1 || aws.StringValue(out.Items[0]["Timestamp"].S) != "3" || out.LastEvaluatedKey == nil {
+		t.Errorf("Query = %v, last %v", out.Items, out.LastEvaluatedKey)
+	}
+}
+
+func TestStreamRecords(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CreateTable("files", "FileID", "")
+	s.EnableStream("files")
+	svc := newClient(t, s)
+
+	key := map[string]*dynamodb.AttributeValue{"FileID": str("f1")}
+	svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("files"),
+		Item:      map[string]*dynamodb.AttributeValue{"FileID": str("f1"), "Size": num("1")},
+	})
+	for i := 0; i < 2; i++ {
+		// the second update changes nothing, so is not recorded
+		svc.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                 aws.String("files"),
+			Key:                       key,
+			UpdateExpression:          aws.String("SET Size = :s"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":s": num("2")},
+		})
+	}
+	svc.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("files"), Key: key})
+	svc.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("files"), Key: key})
+
+	records := s.StreamRecords("files")
+	if len(records) != 3 {
+		t.Fatalf("%d records, want 3: %+v", len(records), records)
+	}
+	for i, want := range []string{"INSERT", "MODIFY", "REMOVE"} {
+		if records[i].EventName != want || records[i].Change.Keys["FileID"].String() != "f1" {
+			t.Errorf("record %d = %v %v", i, records[i].EventName, records[i].Change.Keys)
+		}
+	}
+	if records[0].Change.OldImage != nil || records[0].Change.NewImage["Size"].Number() != "1" {
+		t.Errorf("INSERT images: %v, %v", records[0].Change.OldImage, records[0].Change.NewImage)
+	}
+	if records[1].Change.OldImage["Size"].Number() != "1" || records[1].Change.NewImage["Size"].Number() != "2" {
+		t.Errorf("MODIFY images: %v, %v", records[1].Change.OldImage, records[1].Change.NewImage)
+	}
+	if records[2].Change.NewImage != nil || records[2].Change.OldImage["Size"].Number() != "2" {
+		t.Errorf("REMOVE images: %v, %v", records[2].Change.OldImage, records[2].Change.NewImage)
+	}
+	if records[0].Change.SequenceNumber >= records[1].Change.SequenceNumber {
+		t.Errorf("sequence numbers out of order: %v, %v", records[0].Change.SequenceNumber, records[1].Change.SequenceNumber)
+	}
+	if len(s.StreamRecords("files")) != 0 {
+		t.Errorf("records returned twice")
+	}
+}
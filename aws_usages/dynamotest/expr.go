@@ -0,0 +1,501 @@
+package dynamotest
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// item is a stored DynamoDB item
+type item map[string]*dynamodb.AttributeValue
+
+// exprContext resolves #name and :value placeholders
+type exprContext struct {
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+}
+
+func (c exprContext) name(tok string) (string, error) {
+	if !strings.HasPrefix(tok, "#") {
+		return tok, nil
+	}
+	n, found := c.names[tok]
+	if !found || n == nil {
+		return "", fmt.Errorf("ExpressionAttributeNames has no %v", tok)
+	}
+	return *n, nil
+}
+
+func (c exprContext) value(tok string) (*dynamodb.AttributeValue, error) {
+	v, found := c.values[tok]
+	if !found {
+		return nil, fmt.Errorf("ExpressionAttributeValues has no %v", tok)
+	}
+	return v, nil
+}
+
+// tokenize splits an expression into names, placeholders, operators and punctuation
+func tokenize(expr string) ([]string, error) {
+	var toks []string
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(),+-", r):
+			toks = append(toks, string(r))
+			i++
+		case r == '=':
+			toks = append(toks, "=")
+			i++
+		case r == '<' || r == '>':
+			if i+1 < len(rs) && (rs[i+1] == '=' || (r == '<' && rs[i+1] == '>')) {
+				toks = append(toks, string(rs[i:i+2]))
+				i += 2
+			} else {
+				toks = append(toks, string(r))
+				i++
+			}
+		case r == '#' || r == ':' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(rs) && (rs[j] == '_' || rs[j] == '.' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression %q", r, expr)
+		}
+	}
+
+	return toks, nil
+}
+
+type parser struct {
+	toks []string
+	pos  int
+	ctx  exprContext
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+// evalCondition evaluates a condition or filter expression against it (which may be nil)
+func evalCondition(expr string, ctx exprContext, it item) (bool, error) {
+	if expr == "" {
+		return true, nil
+	}
+
+	toks, err := tokenize(expr)
+	if err != nil {
+		return false, err
+	}
+
+	p := &parser{toks: toks, ctx: ctx}
+	ok, err := p.or(it)
+	if err != nil {
+		return false, err
+	}
+	if p.pos != len(p.toks) {
+		return false, fmt.Errorf("unexpected %q in condition %q", p.peek(), expr)
+	}
+
+	return ok, nil
+}
+
+func (p *parser) or(it item) (bool, error) {
+	left, err := p.and(it)
+	if err != nil {
+		return false, err
+	}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.next()
+		right, err := p.and(it)
+		if err != nil {
+			return false, err
+		}
+		left = left || right
+	}
+	return left, nil
+}
+
+func (p *parser) and(it item) (bool, error) {
+	left, err := p.not(it)
+	if err != nil {
+		return false, err
+	}
+	for strings.EqualFold(p.peek(), "AND") {
+		p.next()
+		right, err := p.not(it)
+		if err != nil {
+			return false, err
+		}
+		left = left && right
+	}
+	return left, nil
+}
+
+func (p *parser) not(it item) (bool, error) {
+	if strings.EqualFold(p.peek(), "NOT") {
+		p.next()
+		v, err := p.not(it)
+		return !v, err
+	}
+	return p.primary(it)
+}
+
+func (p *parser) primary(it item) (bool, error) {
+	tok := p.peek()
+
+	if tok == "(" {
+		p.next()
+		v, err := p.or(it)
+		if err != nil {
+			return false, err
+		}
+		return v, p.expect(")")
+	}
+
+	switch strings.ToLower(tok) {
+	case "attribute_exists", "attribute_not_exists":
+		p.next()
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+		name, err := p.ctx.name(p.next())
+		if err != nil {
+			return false, err
+		}
+		if err := p.expect(")"); err != nil {
+			return false, err
+		}
+		_, exists := lookup(it, name)
+		return exists == (strings.ToLower(tok) == "attribute_exists"), nil
+	case "begins_with", "contains":
+		p.next()
+		if err := p.expect("("); err != nil {
+			return false, err
+		}
+		a, err := p.operand(it)
+		if err != nil {
+			return false, err
+		}
+		if err := p.expect(","); err != nil {
+			return false, err
+		}
+		b, err := p.operand(it)
+		if err != nil {
+			return false, err
+		}
+		if err := p.expect(")"); err != nil {
+			return false, err
+		}
+		if a == nil || b == nil {
+			return false, nil
+		}
+		if strings.ToLower(tok) == "begins_with" {
+			return a.S != nil && b.S != nil && strings.HasPrefix(*a.S, *b.S), nil
+		}
+		return contains(a, b), nil
+	}
+
+	left, err := p.operand(it)
+	if err != nil {
+		return false, err
+	}
+
+	op := p.next()
+	if strings.EqualFold(op, "BETWEEN") {
+		lo, err := p.operand(it)
+		if err != nil {
+			return false, err
+		}
+		if !strings.EqualFold(p.next(), "AND") {
+			return false, fmt.Errorf("expected AND in BETWEEN")
+		}
+		hi, err := p.operand(it)
+		if err != nil {
+			return false, err
+		}
+		c1, ok1 := compare(left, lo)
+		c2, ok2 := compare(left, hi)
+		return ok1 && ok2 && c1 >= 0 && c2 <= 0, nil
+	}
+
+	right, err := p.operand(it)
+	if err != nil {
+		return false, err
+	}
+
+	c, ok := compare(left, right)
+	switch op {
+	case "=":
+		return ok && c == 0, nil
+	case "<>":
+		return !ok || c != 0, nil
+	case "<":
+		return ok && c < 0, nil
+	case "<=":
+		return ok && c <= 0, nil
+	case ">":
+		return ok && c > 0, nil
+	case ">=":
+		return ok && c >= 0, nil
+	}
+
+	return false, fmt.Errorf("unsupported operator %q", op)
+}
+
+// operand reads a path or :value; a missing attribute yields nil
+func (p *parser) operand(it item) (*dynamodb.AttributeValue, error) {
+	tok := p.next()
+	if strings.HasPrefix(tok, ":") {
+		return p.ctx.value(tok)
+	}
+
+	name, err := p.ctx.name(tok)
+	if err != nil {
+		return nil, err
+	}
+	v, _ := lookup(it, name)
+	return v, nil
+}
+
+func lookup(it item, name string) (*dynamodb.AttributeValue, bool) {
+	if it == nil {
+		return nil, false
+	}
+	v, found := it[name]
+	return v, found && v != nil
+}
+
+// compare orders two values of the same scalar type
+func compare(a, b *dynamodb.AttributeValue) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S), true
+	case a.N != nil && b.N != nil:
+		x, ok1 := new(big.Float).SetString(*a.N)
+		y, ok2 := new(big.Float).SetString(*b.N)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case a.BOOL != nil && b.BOOL != nil:
+		if *a.BOOL == *b.BOOL {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func contains(a, b *dynamodb.AttributeValue) bool {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Contains(*a.S, *b.S)
+	case a.SS != nil && b.S != nil:
+		for _, s := range a.SS {
+			if s != nil && *s == *b.S {
+				return true
+			}
+		}
+	case a.L != nil:
+		for _, v := range a.L {
+			if c, ok := compare(v, b); ok && c == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyUpdate runs an update expression (SET, ADD, REMOVE clauses) against a copy of it
+func applyUpdate(expr string, ctx exprContext, it item) (item, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	out := item{}
+	for k, v := range it {
+		out[k] = v
+	}
+
+	p := &parser{toks: toks, ctx: ctx}
+	for p.peek() != "" {
+		clause := strings.ToUpper(p.next())
+		for {
+			switch clause {
+			case "SET":
+				err = p.set(it, out)
+			case "ADD":
+				err = p.add(out)
+			case "REMOVE":
+				var name string
+				if name, err = p.ctx.name(p.next()); err == nil {
+					delete(out, name)
+				}
+			default:
+				err = fmt.Errorf("unsupported update clause %q", clause)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+
+	return out, nil
+}
+
+func (p *parser) set(old item, out item) error {
+	name, err := p.ctx.name(p.next())
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+
+	v, err := p.setOperand(old)
+	if err != nil {
+		return err
+	}
+	if op := p.peek(); op == "+" || op == "-" {
+		p.next()
+		w, err := p.setOperand(old)
+		if err != nil {
+			return err
+		}
+		if v, err = arith(v, w, op); err != nil {
+			return err
+		}
+	}
+	if v == nil {
+		return fmt.Errorf("SET %v references a missing attribute", name)
+	}
+
+	out[name] = v
+	return nil
+}
+
+func (p *parser) setOperand(old item) (*dynamodb.AttributeValue, error) {
+	if strings.EqualFold(p.peek(), "if_not_exists") {
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		name, err := p.ctx.name(p.next())
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.setOperand(old)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if v, exists := lookup(old, name); exists {
+			return v, nil
+		}
+		return fallback, nil
+	}
+
+	return p.operand(old)
+}
+
+func (p *parser) add(out item) error {
+	name, err := p.ctx.name(p.next())
+	if err != nil {
+		return err
+	}
+	v, err := p.ctx.value(p.next())
+	if err != nil {
+		return err
+	}
+
+	cur, exists := lookup(out, name)
+	switch {
+	case v.N != nil:
+		if !exists {
+			cur = &dynamodb.AttributeValue{N: strPtr("0")}
+		}
+		sum, err := arith(cur, v, "+")
+		if err != nil {
+			return err
+		}
+		out[name] = sum
+	case v.SS != nil:
+		set := map[string]bool{}
+		var merged []*string
+		if exists {
+			for _, s := range cur.SS {
+				set[*s] = true
+				merged = append(merged, s)
+			}
+		}
+		for _, s := range v.SS {
+			if !set[*s] {
+				set[*s] = true
+				merged = append(merged, s)
+			}
+		}
+		out[name] = &dynamodb.AttributeValue{SS: merged}
+	default:
+		return fmt.Errorf("ADD %v needs a number or string set", name)
+	}
+
+	return nil
+}
+
+func arith(a, b *dynamodb.AttributeValue, op string) (*dynamodb.AttributeValue, error) {
+	if a == nil || b == nil || a.N == nil || b.N == nil {
+		return nil, fmt.Errorf("%v needs two numbers", op)
+	}
+	x, ok1 := new(big.Float).SetString(*a.N)
+	y, ok2 := new(big.Float).SetString(*b.N)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("invalid number")
+	}
+	if op == "-" {
+		y.Neg(y)
+	}
+
+	return &dynamodb.AttributeValue{N: strPtr(new(big.Float).Add(x, y).Text('f', -1))}, nil
+}
+
+func strPtr(s string) *string {
+	return &s
+}
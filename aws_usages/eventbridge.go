@@ -0,0 +1,78 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+// MaxEventBridgeEntries is the most entries one PutEvents call takes
+const MaxEventBridgeEntries = 10
+
+// EventBridgeEntry is one event for PutEventsEventBridge; Detail is a JSON object
+type EventBridgeEntry struct {
+	Source     string
+	DetailType string
+	Detail     string
+}
+
+var (
+	eventBridgeOnce sync.Once
+	eventBridgeSvc  *eventbridge.EventBridge
+)
+
+func eventBridgeClient() *eventbridge.EventBridge {
+	eventBridgeOnce.Do(func() {
+		eventBridgeSvc = eventbridge.New(session.New(), aws.NewConfig().WithRegion("us-west-2"))
+		eventBridgeSvc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("EventBridgeLatency"))
+		tracing.AWS(&eventBridgeSvc.Handlers)
+	})
+
+	return eventBridgeSvc
+}
+
+// PutEventsEventBridge sends entries to the bus, MaxEventBridgeEntries per call. PutEvents
+// can accept some entries of a call and not others; any rejection is returned as an error,
+// so callers resend the lot and consumers must tolerate duplicates.
+func PutEventsEventBridge(ctx context.Context, busName string, entries []EventBridgeEntry) error {
+	svc := eventBridgeClient()
+
+	for start := 0; start < len(entries); start += MaxEventBridgeEntries {
+		end := start + MaxEventBridgeEntries
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		var input eventbridge.PutEventsInput
+		for _, e := range entries[start:end] {
+			input.Entries = append(input.Entries, &eventbridge.PutEventsRequestEntry{
+				EventBusName: aws.String(busName),
+				Source:       aws.String(e.Source),
+				DetailType:   aws.String(e.DetailType),
+				Detail:       aws.String(e.Detail),
+			})
+		}
+
+		out, err := svc.PutEventsWithContext(ctx, &input)
+		if err != nil {
+			return fmt.Errorf("PutEvents error: %v", err)
+		}
+		if failed := aws.Int64Value(out.FailedEntryCount); failed > 0 {
+			for _, result := range out.Entries {
+				if result.ErrorCode != nil {
+					return fmt.Errorf("PutEvents rejected %d entries: %v: %v",
+						failed, aws.StringValue(result.ErrorCode), aws.StringValue(result.ErrorMessage))
+				}
+			}
+			return fmt.Errorf("PutEvents rejected %d entries", failed)
+		}
+	}
+
+	return nil
+}
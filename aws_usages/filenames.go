@@ -0,0 +1,156 @@
+package aws_usages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// FileNameTableItem claims a FileName among a user's files for the file holding it. Every
+// write that creates, renames or deletes a file takes or gives up its claim in the same
+// transaction, so two requests cannot both end up with one name.
+type FileNameTableItem struct {
+	UserID   string `json:"UserID"`
+	FileName string `json:"FileName"`
+	FileID   string `json:"FileID"`
+}
+
+// ErrFileNameTaken is returned when another of the user's files already has the name
+var ErrFileNameTaken = errors.New("file name taken")
+
+// FileNameTakenDynamoDB reports whether one of userID's files other than exceptFileID holds
+// fileName. It is a cheap early check; only the claim written with the file is authoritative.
+func FileNameTakenDynamoDB(ctx context.Context, namesTable string, userID string, fileName string, exceptFileID string) (bool, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(namesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID":   {S: aws.String(userID)},
+			"FileName": {S: aws.String(fileName)},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", namesTable, err)
+	}
+	if result.Item == nil {
+		return false, nil
+	}
+
+	claim := FileNameTableItem{}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &claim); err != nil {
+		return false, fmt.Errorf("failed to unmarshal")
+	}
+
+	return claim.FileID != exceptFileID, nil
+}
+
+// claimName takes fileName among userID's files for fileID; taking a name the file already
+// holds succeeds
+func claimName(namesTable string, userID string, fileName string, fileID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String(namesTable),
+			Item: map[string]*dynamodb.AttributeValue{
+				"UserID":   {S: aws.String(userID)},
+				"FileName": {S: aws.String(fileName)},
+				"FileID":   {S: aws.String(fileID)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(FileName) OR FileID = :id"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":id": {S: aws.String(fileID)},
+			},
+		},
+	}
+}
+
+// releaseName gives up fileID's claim on fileName. It fails only if another file holds the
+// name, which happens to files written before claims existed; see transactWithRelease.
+func releaseName(namesTable string, userID string, fileName string, fileID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: aws.String(namesTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"UserID":   {S: aws.String(userID)},
+				"FileName": {S: aws.String(fileName)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(FileName) OR FileID = :id"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":id": {S: aws.String(fileID)},
+			},
+		},
+	}
+}
+
+// transactWithRelease runs items, the last of which is a releaseName. If that release is
+// refused because another file holds the name, the rest is run without it: the claim is the
+// other file's to keep.
+func transactWithRelease(ctx context.Context, items []*dynamodb.TransactWriteItem) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil && conditionFailed(err, len(items)-1) {
+		_, err = svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items[:len(items)-1]})
+	}
+
+	return err
+}
+
+// renameItems update the file's FileName, provided it still has the name the caller read, and
+// move its claim from the old name to the new one. The file update is first, the new claim
+// second and the release last, for transactWithRelease.
+func renameItems(filesTable string, namesTable string, file FileTableItem, fileName string, set string, values map[string]*dynamodb.AttributeValue) []*dynamodb.TransactWriteItem {
+	values[":u"] = &dynamodb.AttributeValue{S: aws.String(file.UserID)}
+	values[":old"] = &dynamodb.AttributeValue{S: aws.String(file.FileName)}
+	values[":f"] = &dynamodb.AttributeValue{S: aws.String(fileName)}
+
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(filesTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"FileID": {
+						S: aws.String(file.FileID),
+					},
+				},
+				ConditionExpression:       aws.String("attribute_exists(FileID) AND UserID = :u AND FileName = :old"),
+				UpdateExpression:          aws.String(set),
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	if fileName == file.FileName {
+		return items
+	}
+
+	return append(items,
+		claimName(namesTable, file.UserID, fileName, file.FileID),
+		releaseName(namesTable, file.UserID, file.FileName, file.FileID),
+	)
+}
+
+// renameFile runs renameItems, mapping their cancellations to ErrFileNotFound and
+// ErrFileNameTaken
+func renameFile(ctx context.Context, items []*dynamodb.TransactWriteItem) error {
+	var err error
+	if len(items) == 1 {
+		_, err = dynamoDBClient().TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	} else {
+		err = transactWithRelease(ctx, items)
+	}
+	if err != nil {
+		if conditionFailed(err, 0) {
+			return ErrFileNotFound
+		}
+		if conditionFailed(err, 1) {
+			return ErrFileNameTaken
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
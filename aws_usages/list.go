@@ -0,0 +1,96 @@
+package aws_usages
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// ErrInvalidPageToken is returned for a nextToken that ListFilesPageDynamoDB did not issue
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ListFilesPageDynamoDB scans one page of the files table, restricted to userID unless it is empty.
+// limit caps how many items DynamoDB evaluates (0 for its 1MB default), so a page can hold
+// fewer matches than limit, or none, and still not be the last. pageToken is "" for the first
+// page and otherwise a token this function returned; the returned token is "" after the last page.
+func ListFilesPageDynamoDB(ctx context.Context, tableName string, userID string, limit int64, pageToken string) ([]FileTableItem, string, error) {
+	svc := dynamoDBClient()
+
+	params := &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}
+
+	if userID != "" {
+		filt := expression.Name("UserID").Equal(expression.Value(userID))
+		expr, err := expression.NewBuilder().WithFilter(filt).Build()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to build expression: %s", err)
+		}
+
+		params.ExpressionAttributeNames = expr.Names()
+		params.ExpressionAttributeValues = expr.Values()
+		params.FilterExpression = expr.Filter()
+	}
+
+	if limit > 0 {
+		params.Limit = aws.Int64(limit)
+	}
+
+	if pageToken != "" {
+		fileID, err := base64.RawURLEncoding.DecodeString(pageToken)
+		if err != nil || len(fileID) == 0 {
+			return nil, "", ErrInvalidPageToken
+		}
+		params.ExclusiveStartKey = map[string]*dynamodb.AttributeValue{
+			"FileID": {S: aws.String(string(fileID))},
+		}
+	}
+
+	result, err := svc.ScanWithContext(ctx, params)
+	if err != nil {
+		return nil, "", fmt.Errorf("query api call failed: %s", err)
+	}
+
+	files := []FileTableItem{}
+	for _, i := range result.Items {
+		f := FileTableItem{}
+		err = dynamodbattribute.UnmarshalMap(i, &f)
+		if err != nil {
+			return nil, "", fmt.Errorf("Got error unmarshalling: %s", err)
+		}
+
+		files = append(files, f)
+	}
+
+	next := ""
+	if key, found := result.LastEvaluatedKey["FileID"]; found && key.S != nil {
+		next = base64.RawURLEncoding.EncodeToString([]byte(*key.S))
+	}
+
+	return files, next, nil
+}
+
+// listAllPages follows ListFilesPageDynamoDB to the end of the table
+func listAllPages(ctx context.Context, tableName string, userID string) (*[]FileTableItem, error) {
+	var files []FileTableItem
+
+	token := ""
+	for {
+		page, next, err := ListFilesPageDynamoDB(ctx, tableName, userID, 0, token)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, page...)
+		if next == "" {
+			return &files, nil
+		}
+		token = next
+	}
+}
@@ -0,0 +1,286 @@
+package aws_usages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// QuotaTableItem is a user's storage counters and any admin override of the default limits.
+// A zero MaxBytes or MaxFiles means the stage default applies.
+type QuotaTableItem struct {
+	UserID    string `json:"UserID"`
+	MaxBytes  int64  `json:"MaxBytes,omitempty"`
+	MaxFiles  int64  `json:"MaxFiles,omitempty"`
+	UsedBytes int64  `json:"UsedBytes"`
+	FileCount int64  `json:"FileCount"`
+}
+
+// ErrQuotaExceeded is returned by CommitFileDynamoDB when the usage counters moved past
+// the limits between the caller's check and the write
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+func GetQuotaDynamoDB(ctx context.Context, tableName string, userID string) (*QuotaTableItem, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(userID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", tableName, err)
+	}
+
+	item := QuotaTableItem{UserID: userID}
+	if result.Item == nil {
+		return &item, nil
+	}
+
+	if err = dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quota for userId: %v, error: %v", userID, err)
+	}
+
+	return &item, nil
+}
+
+// SetQuotaLimitsDynamoDB stores an admin override; passing 0 for a limit clears its override
+func SetQuotaLimitsDynamoDB(ctx context.Context, tableName string, userID string, maxBytes int64, maxFiles int64) error {
+	svc := dynamoDBClient()
+
+	var set, remove []string
+	values := map[string]*dynamodb.AttributeValue{}
+	if maxBytes > 0 {
+		set = append(set, "MaxBytes = :b")
+		values[":b"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(maxBytes, 10))}
+	} else {
+		remove = append(remove, "MaxBytes")
+	}
+	if maxFiles > 0 {
+		set = append(set, "MaxFiles = :f")
+		values[":f"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(maxFiles, 10))}
+	} else {
+		remove = append(remove, "MaxFiles")
+	}
+
+	update := ""
+	if len(set) > 0 {
+		update = "SET " + strings.Join(set, ", ")
+	}
+	if len(remove) > 0 {
+		update += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(userID),
+			},
+		},
+		UpdateExpression: aws.String(strings.TrimSpace(update)),
+	}
+	if len(values) > 0 {
+		input.ExpressionAttributeValues = values
+	}
+
+	if _, err := svc.UpdateItemWithContext(ctx, input); err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
+
+// CommitFileDynamoDB writes a new file item, charges its size and count to the owner's usage
+// counters and claims its name in one transaction. The counter update is conditioned on the
+// limits so concurrent uploads cannot jointly overrun them; losing that race returns
+// ErrQuotaExceeded, and ErrFileNameTaken if another of the owner's files has the name.
+func CommitFileDynamoDB(ctx context.Context, filesTable string, quotaTable string, namesTable string, fileData FileTableItem, maxBytes int64, maxFiles int64) error {
+	svc := dynamoDBClient()
+
+	fileData.QuotaCharged = true
+	dynamoItem, err := dynamodbattribute.MarshalMap(fileData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fileData into dynamoItem %v", fileData)
+	}
+
+	_, err = svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(filesTable),
+					Item:                dynamoItem,
+					ConditionExpression: aws.String("attribute_not_exists(FileID)"),
+				},
+			},
+			{
+				Update: chargeQuota(quotaTable, fileData, maxBytes, maxFiles),
+			},
+			claimName(namesTable, fileData.UserID, fileData.FileName, fileData.FileID),
+		},
+	})
+	if err != nil {
+		if conditionFailed(err, 1) {
+			return ErrQuotaExceeded
+		}
+		if conditionFailed(err, 2) {
+			return ErrFileNameTaken
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteFileDynamoDB removes a file item and gives up its name and, if it was charged to the
+// owner's quota, releases its size and count in the same transaction. It returns
+// ErrFileNotFound if the item is already gone.
+func DeleteFileDynamoDB(ctx context.Context, filesTable string, quotaTable string, namesTable string, fileData FileTableItem) error {
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String(filesTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"FileID": {
+						S: aws.String(fileData.FileID),
+					},
+				},
+				ConditionExpression: aws.String("attribute_exists(FileID)"),
+			},
+		},
+	}
+	if fileData.QuotaCharged {
+		items = append(items, &dynamodb.TransactWriteItem{Update: releaseQuota(quotaTable, fileData)})
+	}
+	items = append(items, releaseName(namesTable, fileData.UserID, fileData.FileName, fileData.FileID))
+
+	if err := transactWithRelease(ctx, items); err != nil {
+		if conditionFailed(err, 0) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// SettleFileSizeDynamoDB replaces the FileSize fileData was read with by size, the size of its
+// stored content, and applies the difference to the owner's UsedBytes in the same transaction.
+// Growth is conditioned on maxBytes and returns ErrQuotaExceeded if it does not fit; files not
+// charged to a quota only have their FileSize corrected. The file update is conditioned on the
+// FileSize read, so a concurrent settlement fails this one rather than charging twice.
+func SettleFileSizeDynamoDB(ctx context.Context, filesTable string, quotaTable string, fileData FileTableItem, size int64, maxBytes int64) error {
+	svc := dynamoDBClient()
+
+	// FileSize is omitted from items while it is zero
+	condition := "attribute_exists(FileID) AND FileSize = :old"
+	if fileData.FileSize == 0 {
+		condition = "attribute_exists(FileID) AND (attribute_not_exists(FileSize) OR FileSize = :old)"
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(filesTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"FileID": {
+						S: aws.String(fileData.FileID),
+					},
+				},
+				ConditionExpression: aws.String(condition),
+				UpdateExpression:    aws.String("SET FileSize = :size"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":old":  {N: aws.String(strconv.FormatInt(fileData.FileSize, 10))},
+					":size": {N: aws.String(strconv.FormatInt(size, 10))},
+				},
+			},
+		},
+	}
+	if fileData.QuotaCharged {
+		delta := size - fileData.FileSize
+		update := &dynamodb.Update{
+			TableName: aws.String(quotaTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"UserID": {
+					S: aws.String(fileData.UserID),
+				},
+			},
+			UpdateExpression: aws.String("ADD UsedBytes :delta"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":delta": {N: aws.String(strconv.FormatInt(delta, 10))},
+			},
+		}
+		if delta > 0 {
+			update.ConditionExpression = aws.String("attribute_not_exists(UsedBytes) OR UsedBytes <= :bytesRoom")
+			update.ExpressionAttributeValues[":bytesRoom"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(maxBytes-delta, 10))}
+		}
+		items = append(items, &dynamodb.TransactWriteItem{Update: update})
+	}
+
+	_, err := svc.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		if conditionFailed(err, 1) {
+			return ErrQuotaExceeded
+		}
+		return fmt.Errorf("TransactWriteItems error: %v", err)
+	}
+
+	return nil
+}
+
+// chargeQuota adds a file's size and count to its owner's usage, conditioned on the limits
+func chargeQuota(quotaTable string, fileData FileTableItem, maxBytes int64, maxFiles int64) *dynamodb.Update {
+	return &dynamodb.Update{
+		TableName: aws.String(quotaTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(fileData.UserID),
+			},
+		},
+		UpdateExpression: aws.String("ADD UsedBytes :size, FileCount :one"),
+		ConditionExpression: aws.String("(attribute_not_exists(UsedBytes) OR UsedBytes <= :bytesRoom) AND " +
+			"(attribute_not_exists(FileCount) OR FileCount <= :filesRoom)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":size":      {N: aws.String(strconv.FormatInt(fileData.FileSize, 10))},
+			":one":       {N: aws.String("1")},
+			":bytesRoom": {N: aws.String(strconv.FormatInt(maxBytes-fileData.FileSize, 10))},
+			":filesRoom": {N: aws.String(strconv.FormatInt(maxFiles-1, 10))},
+		},
+	}
+}
+
+// releaseQuota takes a file's size and count back off its owner's usage
+func releaseQuota(quotaTable string, fileData FileTableItem) *dynamodb.Update {
+	return &dynamodb.Update{
+		TableName: aws.String(quotaTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(fileData.UserID),
+			},
+		},
+		UpdateExpression: aws.String("ADD UsedBytes :size, FileCount :one"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":size": {N: aws.String(strconv.FormatInt(-fileData.FileSize, 10))},
+			":one":  {N: aws.String("-1")},
+		},
+	}
+}
+
+// conditionFailed reports whether a transaction was cancelled by the condition on item index
+func conditionFailed(err error, index int) bool {
+	var canceled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &canceled) || index >= len(canceled.CancellationReasons) {
+		return false
+	}
+
+	return aws.StringValue(canceled.CancellationReasons[index].Code) == "ConditionalCheckFailed"
+}
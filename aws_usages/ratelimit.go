@@ -0,0 +1,93 @@
+package aws_usages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// RateBucketItem is one user's token bucket. Updated is unix milliseconds and doubles as
+// the version for optimistic writes; ExpiresAt is the table's TTL attribute (unix seconds).
+type RateBucketItem struct {
+	UserID    string  `json:"UserID"`
+	Tokens    float64 `json:"Tokens"`
+	Updated   int64   `json:"Updated"`
+	ExpiresAt int64   `json:"ExpiresAt"`
+}
+
+// ErrRateBucketConflict is returned by PutRateBucketDynamoDB when another request
+// updated the bucket after it was read
+var ErrRateBucketConflict = errors.New("rate bucket modified concurrently")
+
+// GetRateBucketDynamoDB returns the user's bucket, or nil if they have none yet
+func GetRateBucketDynamoDB(ctx context.Context, tableName string, userID string) (*RateBucketItem, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(userID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", tableName, err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	bucket := RateBucketItem{}
+	if err = dynamodbattribute.UnmarshalMap(result.Item, &bucket); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rate bucket for userId: %v, error: %v", userID, err)
+	}
+
+	return &bucket, nil
+}
+
+// PutRateBucketDynamoDB writes the bucket only if it still carries prevUpdated
+// (or does not exist when prevUpdated is 0), so concurrent requests cannot both spend the same token
+func PutRateBucketDynamoDB(ctx context.Context, tableName string, bucket RateBucketItem, prevUpdated int64) error {
+	svc := dynamoDBClient()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(bucket.UserID),
+			},
+		},
+		UpdateExpression: aws.String("SET Tokens = :t, Updated = :u, ExpiresAt = :e"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {N: aws.String(strconv.FormatFloat(bucket.Tokens, 'f', -1, 64))},
+			":u": {N: aws.String(strconv.FormatInt(bucket.Updated, 10))},
+			":e": {N: aws.String(strconv.FormatInt(bucket.ExpiresAt, 10))},
+		},
+	}
+	if prevUpdated == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(Updated)")
+	} else {
+		input.ConditionExpression = aws.String("Updated = :prev")
+		input.ExpressionAttributeValues[":prev"] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(prevUpdated, 10)),
+		}
+	}
+
+	_, err := svc.UpdateItemWithContext(ctx, input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrRateBucketConflict
+		}
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package aws_usages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrObjectNotFound is returned when an object to read or copy does not exist, e.g. its upload never completed
+var ErrObjectNotFound = errors.New("object not found")
+
+var (
+	s3Once sync.Once
+	s3Svc  *s3.S3
+)
+
+func s3Client() *s3.S3 {
+	s3Once.Do(func() {
+		s3Svc = s3.New(session.New(), aws.NewConfig().WithRegion("us-west-2"))
+		s3Svc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("S3Latency"))
+		tracing.AWS(&s3Svc.Handlers)
+	})
+
+	return s3Svc
+}
+
+// CopyObjectS3 copies the object at srcKey to dstKey within bucket without the bytes leaving S3
+func CopyObjectS3(ctx context.Context, bucket string, srcKey string, dstKey string) error {
+	svc := s3Client()
+
+	_, err := svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(bucket + "/" + srcKey)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("CopyObject error: %v", err)
+	}
+
+	return nil
+}
+
+// GetObjectS3 opens the object at key for reading; callers must close it
+func GetObjectS3(ctx context.Context, bucket string, key string) (io.ReadCloser, error) {
+	svc := s3Client()
+
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetObject error: %v", err)
+	}
+
+	return out.Body, nil
+}
+
+// PutObjectS3 stores content at key
+func PutObjectS3(ctx context.Context, bucket string, key string, content []byte, contentType string) error {
+	svc := s3Client()
+
+	_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject error: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteObjectS3 deletes the object at key; S3 reports success when there is none
+func DeleteObjectS3(ctx context.Context, bucket string, key string) error {
+	svc := s3Client()
+
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject error: %v", err)
+	}
+
+	return nil
+}
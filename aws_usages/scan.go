@@ -0,0 +1,94 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SetScanStatusDynamoDB records a file's virus scan state. The signature is kept for
+// quarantined files and cleared otherwise; scanned is when the scan finished, or empty while
+// it runs. It returns ErrFileNotFound if the item no longer exists.
+func SetScanStatusDynamoDB(ctx context.Context, tableName string, fileID string, status string, signature string, scanned string) error {
+	svc := dynamoDBClient()
+
+	update := "SET ScanStatus = :s"
+	values := map[string]*dynamodb.AttributeValue{
+		":s": {
+			S: aws.String(status),
+		},
+	}
+	var removed []string
+	if signature != "" {
+		update += ", ScanSignature = :sig"
+		values[":sig"] = &dynamodb.AttributeValue{S: aws.String(signature)}
+	} else {
+		removed = append(removed, "ScanSignature")
+	}
+	if scanned != "" {
+		update += ", Scanned = :t"
+		values[":t"] = &dynamodb.AttributeValue{S: aws.String(scanned)}
+	} else {
+		removed = append(removed, "Scanned")
+	}
+	for i, name := range removed {
+		if i == 0 {
+			update += " REMOVE " + name
+		} else {
+			update += ", " + name
+		}
+	}
+
+	_, err := svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression:       aws.String("attribute_exists(FileID)"),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeValues: values,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
+
+// StartScanDynamoDB marks a file scanning when new content lands, dropping the verdict and
+// ContentType of whatever it replaced. It returns ErrFileNotFound if the item no longer exists.
+func StartScanDynamoDB(ctx context.Context, tableName string, fileID string) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID)"),
+		UpdateExpression:    aws.String("SET ScanStatus = :s REMOVE ScanSignature, Scanned, ContentType"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":s": {
+				S: aws.String(ScanStatusScanning),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
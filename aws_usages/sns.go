@@ -0,0 +1,56 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+var (
+	snsOnce sync.Once
+	snsSvc  *sns.SNS
+)
+
+func snsClient() *sns.SNS {
+	snsOnce.Do(func() {
+		snsSvc = sns.New(session.New(), aws.NewConfig().WithRegion("us-west-2"))
+		snsSvc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("SNSLatency"))
+		tracing.AWS(&snsSvc.Handlers)
+	})
+
+	return snsSvc
+}
+
+// PublishSNS publishes message to the topic with string attributes subscribers can filter on
+func PublishSNS(ctx context.Context, topicARN string, message string, attributes map[string]string) error {
+	svc := snsClient()
+
+	attrs := map[string]*sns.MessageAttributeValue{}
+	for name, value := range attributes {
+		if value == "" {
+			// SNS rejects empty attribute values
+			continue
+		}
+		attrs[name] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	_, err := svc.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(topicARN),
+		Message:           aws.String(message),
+		MessageAttributes: attrs,
+	})
+	if err != nil {
+		return fmt.Errorf("Publish error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// MaxSQSDelaySeconds is the longest SQS lets a message be delayed
+const MaxSQSDelaySeconds = 900
+
+var (
+	sqsOnce sync.Once
+	sqsSvc  *sqs.SQS
+)
+
+func sqsClient() *sqs.SQS {
+	sqsOnce.Do(func() {
+		sqsSvc = sqs.New(session.New(), aws.NewConfig().WithRegion("us-west-2"))
+		sqsSvc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("SQSLatency"))
+		tracing.AWS(&sqsSvc.Handlers)
+	})
+
+	return sqsSvc
+}
+
+// SendMessageSQS queues body, to be received no sooner than delaySeconds from now
+func SendMessageSQS(ctx context.Context, queueURL string, body string, delaySeconds int64) error {
+	svc := sqsClient()
+
+	if delaySeconds > MaxSQSDelaySeconds {
+		delaySeconds = MaxSQSDelaySeconds
+	}
+
+	_, err := svc.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(queueURL),
+		MessageBody:  aws.String(body),
+		DelaySeconds: aws.Int64(delaySeconds),
+	})
+	if err != nil {
+		return fmt.Errorf("SendMessage error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ActivateFileDynamoDB moves a pending file to active once its content has been stored.
+// Files in any other state, or deleted in the meantime, are left alone.
+func ActivateFileDynamoDB(ctx context.Context, tableName string, fileID string) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID) AND #status = :pending"),
+		UpdateExpression:    aws.String("SET #status = :active"),
+		// Status is a DynamoDB reserved word
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending": {
+				S: aws.String(FileStatusPending),
+			},
+			":active": {
+				S: aws.String(FileStatusActive),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
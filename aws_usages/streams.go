@@ -0,0 +1,31 @@
+package aws_usages
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// UnmarshalStreamImage decodes an item image from a DynamoDB Stream record into out, as
+// dynamodbattribute.UnmarshalMap does for items read from a table
+func UnmarshalStreamImage(image map[string]events.DynamoDBAttributeValue, out interface{}) error {
+	// the two attribute value types share DynamoDB's JSON wire form
+	js, err := json.Marshal(image)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream image: %v", err)
+	}
+
+	var item map[string]*dynamodb.AttributeValue
+	if err := json.Unmarshal(js, &item); err != nil {
+		return fmt.Errorf("failed to unmarshal stream image: %v", err)
+	}
+
+	if err := dynamodbattribute.UnmarshalMap(item, out); err != nil {
+		return fmt.Errorf("failed to unmarshal stream image: %v", err)
+	}
+
+	return nil
+}
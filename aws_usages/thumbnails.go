@@ -0,0 +1,46 @@
+package aws_usages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// SetThumbnailsDynamoDB records the renditions generated for a file, removing the attribute
+// when there are none. It returns ErrFileNotFound if the item no longer exists.
+func SetThumbnailsDynamoDB(ctx context.Context, tableName string, fileID string, thumbnails []Thumbnail) error {
+	svc := dynamoDBClient()
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"FileID": {
+				S: aws.String(fileID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(FileID)"),
+		UpdateExpression:    aws.String("REMOVE Thumbnails"),
+	}
+	if len(thumbnails) > 0 {
+		value, err := dynamodbattribute.Marshal(thumbnails)
+		if err != nil {
+			return fmt.Errorf("failed to marshal thumbnails: %v", err)
+		}
+		input.UpdateExpression = aws.String("SET Thumbnails = :t")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":t": value}
+	}
+
+	_, err := svc.UpdateItemWithContext(ctx, input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateItem error: %v", err)
+	}
+
+	return nil
+}
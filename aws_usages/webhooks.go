@@ -0,0 +1,251 @@
+package aws_usages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// WebhookTableItem is an endpoint a user registered, keyed by UserID and WebhookID.
+// Events lists the event types it receives; empty means all of them.
+type WebhookTableItem struct {
+	UserID    string   `json:"UserID"`
+	WebhookID string   `json:"WebhookID"`
+	URL       string   `json:"URL"`
+	Secret    string   `json:"Secret"`
+	Events    []string `json:"Events,omitempty"`
+	Created   string   `json:"Created"`
+}
+
+// WebhookAttemptItem is one attempt to deliver an event to a webhook, keyed by WebhookID and
+// AttemptID, which starts with the attempt's timestamp so a webhook's attempts sort by time.
+// ExpiresAt is the table's TTL attribute (unix seconds).
+type WebhookAttemptItem struct {
+	WebhookID  string `json:"WebhookID"`
+	AttemptID  string `json:"AttemptID"`
+	DeliveryID string `json:"DeliveryID"`
+	EventID    string `json:"EventID"`
+	EventType  string `json:"EventType"`
+	Attempt    int    `json:"Attempt"`
+	Outcome    string `json:"Outcome"`
+	StatusCode int    `json:"StatusCode,omitempty"`
+	Error      string `json:"Error,omitempty"`
+	DurationMs int64  `json:"DurationMs"`
+	Timestamp  string `json:"Timestamp"`
+	NextRetry  string `json:"NextRetry,omitempty"`
+	ExpiresAt  int64  `json:"ExpiresAt"`
+}
+
+// WebhookDeadLetterItem is a delivery that failed every attempt, kept with its payload so it
+// can be inspected and replayed. Keyed by WebhookID and DeliveryID.
+type WebhookDeadLetterItem struct {
+	WebhookID  string `json:"WebhookID"`
+	DeliveryID string `json:"DeliveryID"`
+	UserID     string `json:"UserID"`
+	EventID    string `json:"EventID"`
+	EventType  string `json:"EventType"`
+	Payload    string `json:"Payload"`
+	Attempts   int    `json:"Attempts"`
+	LastError  string `json:"LastError"`
+	Timestamp  string `json:"Timestamp"`
+}
+
+// ErrWebhookNotFound is returned for a WebhookID the user has not registered
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// PutWebhookDynamoDB registers a webhook, failing if its WebhookID is taken
+func PutWebhookDynamoDB(ctx context.Context, tableName string, hook WebhookTableItem) error {
+	svc := dynamoDBClient()
+
+	item, err := dynamodbattribute.MarshalMap(hook)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook %v", hook.WebhookID)
+	}
+
+	_, err = svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(WebhookID)"),
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem error: %v", err)
+	}
+
+	return nil
+}
+
+// GetWebhookDynamoDB returns one of the user's webhooks, or ErrWebhookNotFound
+func GetWebhookDynamoDB(ctx context.Context, tableName string, userID string, webhookID string) (*WebhookTableItem, error) {
+	svc := dynamoDBClient()
+
+	result, err := svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key:       webhookKey(userID, webhookID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dynamodb tableName: %v, error: %v", tableName, err)
+	}
+	if result.Item == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	hook := WebhookTableItem{}
+	if err = dynamodbattribute.UnmarshalMap(result.Item, &hook); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook: %v, error: %v", webhookID, err)
+	}
+
+	return &hook, nil
+}
+
+// ListWebhooksDynamoDB returns every webhook the user registered
+func ListWebhooksDynamoDB(ctx context.Context, tableName string, userID string) ([]WebhookTableItem, error) {
+	svc := dynamoDBClient()
+
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("UserID = :u"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":u": {S: aws.String(userID)},
+		},
+	}
+
+	hooks := []WebhookTableItem{}
+	for {
+		result, err := svc.QueryWithContext(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("query api call failed: %s", err)
+		}
+
+		for _, i := range result.Items {
+			hook := WebhookTableItem{}
+			if err := dynamodbattribute.UnmarshalMap(i, &hook); err != nil {
+				return nil, fmt.Errorf("Got error unmarshalling: %s", err)
+			}
+
+			hooks = append(hooks, hook)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return hooks, nil
+		}
+		params.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// DeleteWebhookDynamoDB removes one of the user's webhooks, or returns ErrWebhookNotFound
+func DeleteWebhookDynamoDB(ctx context.Context, tableName string, userID string, webhookID string) error {
+	svc := dynamoDBClient()
+
+	_, err := svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(tableName),
+		Key:                 webhookKey(userID, webhookID),
+		ConditionExpression: aws.String("attribute_exists(WebhookID)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("DeleteItem error: %v", err)
+	}
+
+	return nil
+}
+
+func webhookKey(userID string, webhookID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"UserID":    {S: aws.String(userID)},
+		"WebhookID": {S: aws.String(webhookID)},
+	}
+}
+
+// PutWebhookAttemptDynamoDB appends an attempt to a webhook's delivery history
+func PutWebhookAttemptDynamoDB(ctx context.Context, tableName string, attempt WebhookAttemptItem) error {
+	svc := dynamoDBClient()
+
+	item, err := dynamodbattribute.MarshalMap(attempt)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook attempt %v", attempt.AttemptID)
+	}
+
+	_, err = svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem error: %v", err)
+	}
+
+	return nil
+}
+
+// QueryWebhookAttemptsDynamoDB returns one page of a webhook's delivery attempts, newest first.
+// limit and pageToken work as in QueryAuditDynamoDB.
+func QueryWebhookAttemptsDynamoDB(ctx context.Context, tableName string, webhookID string, limit int64, pageToken string) ([]WebhookAttemptItem, string, error) {
+	svc := dynamoDBClient()
+
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(tableName),
+		KeyConditionExpression: aws.String("WebhookID = :w"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":w": {S: aws.String(webhookID)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if limit > 0 {
+		params.Limit = aws.Int64(limit)
+	}
+	if pageToken != "" {
+		start, err := decodeKeyToken(pageToken, "WebhookID", "AttemptID")
+		if err != nil || aws.StringValue(start["WebhookID"].S) != webhookID {
+			return nil, "", ErrInvalidPageToken
+		}
+		params.ExclusiveStartKey = start
+	}
+
+	result, err := svc.QueryWithContext(ctx, params)
+	if err != nil {
+		return nil, "", fmt.Errorf("query api call failed: %s", err)
+	}
+
+	attempts := []WebhookAttemptItem{}
+	for _, i := range result.Items {
+		attempt := WebhookAttemptItem{}
+		if err := dynamodbattribute.UnmarshalMap(i, &attempt); err != nil {
+			return nil, "", fmt.Errorf("Got error unmarshalling: %s", err)
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	next := ""
+	if len(result.LastEvaluatedKey) > 0 {
+		next = encodeKeyToken(result.LastEvaluatedKey)
+	}
+
+	return attempts, next, nil
+}
+
+// PutWebhookDeadLetterDynamoDB records a delivery that will not be retried again
+func PutWebhookDeadLetterDynamoDB(ctx context.Context, tableName string, letter WebhookDeadLetterItem) error {
+	svc := dynamoDBClient()
+
+	item, err := dynamodbattribute.MarshalMap(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter %v", letter.DeliveryID)
+	}
+
+	_, err = svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("PutItem error: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,622 @@
+// Package client is a Go client for the file management API. It performs both halves of
+// each operation: the API call, and the upload, download or delete against the signed URL
+// the API returns.
+//
+//	c := client.New("https://<api-id>.execute-api.us-west-2.amazonaws.com", idToken)
+//	fileID, err := c.Upload(ctx, userID, client.UploadRequest{FileName: "a.txt"}, f, size)
+//	body, size, err := c.Download(ctx, userID, fileID)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NextTokenHeader carries the token for the next page of a list response
+const NextTokenHeader = "X-Next-Token"
+
+// TokenSource returns the Cognito id token to send as the bearer token, e.g. refreshing it when expired
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken always returns token
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// Client calls the API at BaseURL. Requests are retried on throttling, on 5xx responses
+// where repeating them is safe, and on network errors for idempotent requests, waiting
+// exponentially longer each time (or as long as Retry-After asks).
+type Client struct {
+	BaseURL    string
+	Token      TokenSource
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a failed request is repeated; 0 disables retries
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the wait between attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PageSize is the limit List and ListAll request per page
+	PageSize int
+}
+
+// New creates a client for the API at baseURL, authenticating with a fixed token
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      StaticToken(token),
+		HTTPClient: http.DefaultClient,
+		MaxRetries: 3,
+		MinBackoff: 200 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+		PageSize:   100,
+	}
+}
+
+// File is a file's metadata as the API lists it
+type File struct {
+	FileID    string `json:"FileID"`
+	UserID    string `json:"UserID"`
+	FirstName string `json:"FirstName"`
+	LastName  string `json:"LastName"`
+	FileName  string `json:"FileName"`
+	Modified  string `json:"Modified"`
+	Uploaded  string `json:"Uploaded"`
+	Status    string `json:"Status,omitempty"`
+	FileSize  int64  `json:"FileSize,omitempty"`
+
+	// ScanStatus is unscanned, scanning, clean, quarantined, rejected by the upload policy or
+	// too_large to scan, with ScanSignature saying why; only clean files download. Files
+	// stored before scanning existed have none and download as clean.
+	ScanStatus    string `json:"ScanStatus,omitempty"`
+	ScanSignature string `json:"ScanSignature,omitempty"`
+	// ContentType is sniffed from the stored content
+	ContentType string `json:"ContentType,omitempty"`
+
+	// Thumbnails lists the renditions of a clean image; other files have none
+	Thumbnails []Thumbnail `json:"Thumbnails,omitempty"`
+	// SHA256 is the digest declared when the file was uploaded, if any
+	SHA256 string `json:"SHA256,omitempty"`
+}
+
+// Thumbnail is a scaled-down rendition of an image file. Size is small, medium or large.
+type Thumbnail struct {
+	Size        string `json:"Size"`
+	Width       int    `json:"Width"`
+	Height      int    `json:"Height"`
+	ContentType string `json:"ContentType"`
+}
+
+// UploadRequest describes a new file. Upload fills in FileSize. SHA256, the lowercase hex
+// digest of the content, is optional: if the user already uploaded that content, the new file
+// shares it and nothing is sent.
+type UploadRequest struct {
+	FileName  string `json:"FileName"`
+	FirstName string `json:"FirstName,omitempty"`
+	LastName  string `json:"LastName,omitempty"`
+	FileSize  int64  `json:"FileSize"`
+	SHA256    string `json:"SHA256,omitempty"`
+}
+
+// CopyRequest says where Copy puts the copy; empty fields keep the source's owner, folder
+// and name. Folder "/" is the top level.
+type CopyRequest struct {
+	TargetUserID string `json:"TargetUserID,omitempty"`
+	Folder       string `json:"Folder,omitempty"`
+	FileName     string `json:"FileName,omitempty"`
+}
+
+// ListAllOptions filter the admin listing of every file
+type ListAllOptions struct {
+	UserID         string
+	IncludeTrashed bool
+	IncludePending bool
+}
+
+// AuditEntry is one recorded operation on a file
+type AuditEntry struct {
+	EntryID    string            `json:"EntryID"`
+	Action     string            `json:"Action"`
+	Actor      string            `json:"Actor"`
+	TargetUser string            `json:"TargetUser"`
+	FileID     string            `json:"FileID"`
+	Timestamp  string            `json:"Timestamp"`
+	SourceIP   string            `json:"SourceIP,omitempty"`
+	UserAgent  string            `json:"UserAgent,omitempty"`
+	Details    map[string]string `json:"Details,omitempty"`
+}
+
+// AuditFilter picks the entries Audit returns: those about UserID's files, or about FileID
+type AuditFilter struct {
+	UserID string
+	FileID string
+}
+
+// Webhook is an endpoint the API POSTs a user's file events to. Secret, which the deliveries
+// are signed with, is only set by RegisterWebhook.
+type Webhook struct {
+	WebhookID string   `json:"WebhookID"`
+	UserID    string   `json:"UserID"`
+	URL       string   `json:"URL"`
+	Events    []string `json:"Events"`
+	Created   string   `json:"Created"`
+	Secret    string   `json:"Secret,omitempty"`
+}
+
+// WebhookRequest describes a new webhook. An empty Secret has the API generate one, and
+// empty Events subscribes to every event type.
+type WebhookRequest struct {
+	URL    string   `json:"URL"`
+	Secret string   `json:"Secret,omitempty"`
+	Events []string `json:"Events,omitempty"`
+}
+
+// WebhookAttempt is one attempt to deliver an event to a webhook
+type WebhookAttempt struct {
+	DeliveryID string `json:"DeliveryID"`
+	EventID    string `json:"EventID"`
+	EventType  string `json:"EventType"`
+	Attempt    int    `json:"Attempt"`
+	Outcome    string `json:"Outcome"`
+	StatusCode int    `json:"StatusCode,omitempty"`
+	Error      string `json:"Error,omitempty"`
+	DurationMs int64  `json:"DurationMs"`
+	Timestamp  string `json:"Timestamp"`
+	NextRetry  string `json:"NextRetry,omitempty"`
+}
+
+// Upload creates a file record for userID and PUTs size bytes of content to its upload URL,
+// returning the new FileID. If content is an io.Seeker the PUT is retried like any other request.
+// Content the API deduplicated by req.SHA256 is not read.
+func (c *Client) Upload(ctx context.Context, userID string, req UploadRequest, content io.Reader, size int64) (string, error) {
+	req.FileSize = size
+
+	var resp struct {
+		FileID       string `json:"FileID"`
+		UploadURL    string `json:"UploadURL"`
+		Deduplicated bool   `json:"Deduplicated"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/"+url.PathEscape(userID), nil, req, &resp, nil); err != nil {
+		return "", err
+	}
+	if resp.Deduplicated {
+		return resp.FileID, nil
+	}
+
+	if err := c.put(ctx, resp.UploadURL, content, size); err != nil {
+		return resp.FileID, err
+	}
+
+	return resp.FileID, nil
+}
+
+// Download returns the content of a file and its size, -1 if the server did not say.
+// The caller must close the body.
+func (c *Client) Download(ctx context.Context, userID string, fileID string) (io.ReadCloser, int64, error) {
+	var resp struct {
+		DownloadURL string `json:"DownloadURL"`
+	}
+	if err := c.call(ctx, http.MethodGet, filePath(userID, fileID), nil, nil, &resp, nil); err != nil {
+		return nil, 0, err
+	}
+
+	httpResp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, resp.DownloadURL, nil)
+	}, retryAlways)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return httpResp.Body, httpResp.ContentLength, nil
+}
+
+// Thumbnail returns the content of one of a file's thumbnails and what it is; an empty size
+// picks the API's default. It fails with ErrNotFound if the file is not an image.
+// The caller must close the body.
+func (c *Client) Thumbnail(ctx context.Context, userID string, fileID string, size string) (io.ReadCloser, *Thumbnail, error) {
+	query := url.Values{}
+	if size != "" {
+		query.Set("size", size)
+	}
+
+	var resp struct {
+		Thumbnail
+		ThumbnailURL string `json:"ThumbnailURL"`
+	}
+	if err := c.call(ctx, http.MethodGet, filePath(userID, fileID)+"/thumbnail", query, nil, &resp, nil); err != nil {
+		return nil, nil, err
+	}
+
+	httpResp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, resp.ThumbnailURL, nil)
+	}, retryAlways)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return httpResp.Body, &resp.Thumbnail, nil
+}
+
+// List returns every file owned by userID, fetching as many pages as needed
+func (c *Client) List(ctx context.Context, userID string) ([]File, error) {
+	return c.list(ctx, "/"+url.PathEscape(userID), url.Values{})
+}
+
+// ListAll returns every file in the table, or a user's with opts.UserID. Admin only.
+func (c *Client) ListAll(ctx context.Context, opts ListAllOptions) ([]File, error) {
+	query := url.Values{}
+	if opts.UserID != "" {
+		query.Set("userId", opts.UserID)
+	}
+	if opts.IncludeTrashed {
+		query.Set("includeTrashed", "true")
+	}
+	if opts.IncludePending {
+		query.Set("includePending", "true")
+	}
+
+	return c.list(ctx, "/", query)
+}
+
+func (c *Client) list(ctx context.Context, path string, query url.Values) ([]File, error) {
+	files := []File{}
+	if c.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(c.PageSize))
+	}
+
+	for {
+		var page []File
+		header := http.Header{}
+		if err := c.call(ctx, http.MethodGet, path, query, nil, &page, header); err != nil {
+			return nil, err
+		}
+		files = append(files, page...)
+
+		next := header.Get(NextTokenHeader)
+		if next == "" {
+			return files, nil
+		}
+		query.Set("nextToken", next)
+	}
+}
+
+// Audit returns the audit entries matching filter, oldest first. Admin only.
+func (c *Client) Audit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := url.Values{}
+	if filter.UserID != "" {
+		query.Set("userId", filter.UserID)
+	}
+	if filter.FileID != "" {
+		query.Set("fileId", filter.FileID)
+	}
+	if c.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(c.PageSize))
+	}
+
+	entries := []AuditEntry{}
+	for {
+		var page []AuditEntry
+		header := http.Header{}
+		if err := c.call(ctx, http.MethodGet, "/audit", query, nil, &page, header); err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+
+		next := header.Get(NextTokenHeader)
+		if next == "" {
+			return entries, nil
+		}
+		query.Set("nextToken", next)
+	}
+}
+
+// Overwrite renames a file and, when content is not nil, replaces its content with size bytes
+func (c *Client) Overwrite(ctx context.Context, userID string, fileID string, fileName string, content io.Reader, size int64) error {
+	var resp struct {
+		PostURL string `json:"PostURL"`
+	}
+	body := map[string]string{"FileName": fileName}
+	if err := c.call(ctx, http.MethodPatch, filePath(userID, fileID), nil, body, &resp, nil); err != nil {
+		return err
+	}
+
+	if content == nil {
+		return nil
+	}
+
+	return c.put(ctx, resp.PostURL, content, size)
+}
+
+// Rename changes a file's name, or its folder with a name containing slashes, without
+// touching its content. It fails with ErrConflict if another file already has that name.
+func (c *Client) Rename(ctx context.Context, userID string, fileID string, fileName string) (*File, error) {
+	var file File
+	body := map[string]string{"FileName": fileName}
+	if err := c.call(ctx, http.MethodPost, filePath(userID, fileID)+"/rename", nil, body, &file, nil); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// Copy duplicates a file on the server, returning the new file. Copies are charged to the
+// target user's quota.
+func (c *Client) Copy(ctx context.Context, userID string, fileID string, req CopyRequest) (*File, error) {
+	var file File
+	if err := c.call(ctx, http.MethodPost, filePath(userID, fileID)+"/copy", nil, req, &file, nil); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// Delete removes a file's record and then its content
+func (c *Client) Delete(ctx context.Context, userID string, fileID string) error {
+	var resp struct {
+		DeleteURL string `json:"DeleteURL"`
+	}
+	if err := c.call(ctx, http.MethodDelete, filePath(userID, fileID), nil, nil, &resp, nil); err != nil {
+		return err
+	}
+
+	httpResp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodDelete, resp.DeleteURL, nil)
+	}, retryAlways)
+	if err != nil {
+		return err
+	}
+	httpResp.Body.Close()
+
+	return nil
+}
+
+// RegisterWebhook registers an endpoint for userID's file events
+func (c *Client) RegisterWebhook(ctx context.Context, userID string, req WebhookRequest) (*Webhook, error) {
+	var hook Webhook
+	if err := c.call(ctx, http.MethodPost, "/"+url.PathEscape(userID)+"/webhooks", nil, req, &hook, nil); err != nil {
+		return nil, err
+	}
+
+	return &hook, nil
+}
+
+// Webhooks lists userID's webhooks
+func (c *Client) Webhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	hooks := []Webhook{}
+	if err := c.call(ctx, http.MethodGet, "/"+url.PathEscape(userID)+"/webhooks", nil, nil, &hooks, nil); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// DeleteWebhook removes one of userID's webhooks
+func (c *Client) DeleteWebhook(ctx context.Context, userID string, webhookID string) error {
+	return c.call(ctx, http.MethodDelete, webhookPath(userID, webhookID), nil, nil, nil, nil)
+}
+
+// WebhookDeliveries returns a webhook's delivery attempts, newest first, following every page
+func (c *Client) WebhookDeliveries(ctx context.Context, userID string, webhookID string) ([]WebhookAttempt, error) {
+	query := url.Values{}
+	if c.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(c.PageSize))
+	}
+
+	attempts := []WebhookAttempt{}
+	for {
+		var page []WebhookAttempt
+		header := http.Header{}
+		if err := c.call(ctx, http.MethodGet, webhookPath(userID, webhookID)+"/deliveries", query, nil, &page, header); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, page...)
+
+		next := header.Get(NextTokenHeader)
+		if next == "" {
+			return attempts, nil
+		}
+		query.Set("nextToken", next)
+	}
+}
+
+func webhookPath(userID string, webhookID string) string {
+	return "/" + url.PathEscape(userID) + "/webhooks/" + url.PathEscape(webhookID)
+}
+
+func filePath(userID string, fileID string) string {
+	return "/" + url.PathEscape(userID) + "/" + url.PathEscape(fileID)
+}
+
+// call sends an authenticated JSON request to the API and decodes a JSON response into out.
+// When header is not nil the response headers are copied into it.
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}, header http.Header) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	token, err := c.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get token: %v", err)
+	}
+
+	// POST may create a new file each time, so it is only repeated when it was throttled
+	policy := retryAlways
+	if method == http.MethodPost {
+		policy = retryThrottled
+	}
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	}, policy)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if header != nil {
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %v %v response: %v", method, path, err)
+	}
+
+	return nil
+}
+
+// put uploads content to a signed URL
+func (c *Client) put(ctx context.Context, signedURL string, content io.Reader, size int64) error {
+	// content can only be sent again if it can be rewound
+	policy := retryNever
+	seeker, ok := content.(io.Seeker)
+	var start int64
+	if ok {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err == nil {
+			policy = retryAlways
+		}
+	}
+
+	attempt := 0
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		if attempt > 0 {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		attempt++
+
+		req, err := http.NewRequest(http.MethodPut, signedURL, ioutil.NopCloser(content))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+		return req, nil
+	}, policy)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// retryPolicy says which failures a request may be repeated after
+type retryPolicy int
+
+const (
+	retryNever     retryPolicy = iota
+	retryThrottled             // only 429 and 503, where the server did not act on the request
+	retryAlways                // also other 5xx and network errors, for idempotent requests
+)
+
+// do sends the request built by newRequest until it succeeds, fails permanently or the
+// retries run out. Only 2xx responses are returned; anything else becomes an *Error.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error), policy retryPolicy) (*http.Response, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if policy != retryAlways || attempt >= c.MaxRetries {
+				return nil, err
+			}
+			if err := c.sleep(ctx, c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		apiErr := newError(req, resp)
+		resp.Body.Close()
+
+		if attempt >= c.MaxRetries || !apiErr.retryable(policy) {
+			return nil, apiErr
+		}
+
+		wait := c.backoff(attempt)
+		if apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff doubles from MinBackoff with up to 50% jitter, capped at MaxBackoff
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.MinBackoff
+	for i := 0; i < attempt && wait < c.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > 0 {
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	}
+	if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+		wait = c.MaxBackoff
+	}
+
+	return wait
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,407 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves the API routes the client uses from memory, with the signed URLs
+// pointing back at itself under /objects/
+type fakeAPI struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	files    []File
+	audit    []AuditEntry
+	objects  map[string]string
+	requests []string
+	// fail, when set, may answer a request instead of the fake; return false to pass it on
+	fail func(w http.ResponseWriter, r *http.Request) bool
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	f := &fakeAPI{t: t, objects: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	fail := f.fail
+	f.mu.Unlock()
+
+	if fail != nil && fail(w, r) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/objects/") {
+		id := strings.TrimPrefix(r.URL.Path, "/objects/")
+		switch r.Method {
+		case "PUT":
+			data, _ := ioutil.ReadAll(r.Body)
+			f.objects[id] = string(data)
+		case "GET":
+			content, found := f.objects[id]
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content))
+		case "DELETE":
+			delete(f.objects, id)
+			w.WriteHeader(204)
+		}
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(401)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/audit":
+		var matched []AuditEntry
+		for _, e := range f.audit {
+			if e.FileID == r.URL.Query().Get("fileId") {
+				matched = append(matched, e)
+			}
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("nextToken"))
+		end := start + 2
+		if end >= len(matched) {
+			end = len(matched)
+		} else {
+			w.Header().Set(NextTokenHeader, strconv.Itoa(end))
+		}
+		json.NewEncoder(w).Encode(matched[start:end])
+	case r.Method == "POST" && len(parts) == 1:
+		var req UploadRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		id := fmt.Sprintf("file%d", len(f.files))
+		for _, file := range f.files {
+			if req.SHA256 != "" && file.UserID == parts[0] && file.SHA256 == req.SHA256 {
+				f.files = append(f.files, File{FileID: id, UserID: parts[0], FileName: req.FileName, FileSize: file.FileSize, SHA256: req.SHA256})
+				json.NewEncoder(w).Encode(map[string]interface{}{"FileID": id, "Deduplicated": true})
+				return
+			}
+		}
+		f.files = append(f.files, File{FileID: id, UserID: parts[0], FileName: req.FileName, FileSize: req.FileSize, SHA256: req.SHA256})
+		json.NewEncoder(w).Encode(map[string]string{"FileID": id, "UploadURL": f.URL + "/objects/" + id + "?signature=secret"})
+	case r.Method == "GET" && len(parts) == 1:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		start, _ := strconv.Atoi(r.URL.Query().Get("nextToken"))
+		end := start + limit
+		if limit == 0 || end > len(f.files) {
+			end = len(f.files)
+		}
+		if end < len(f.files) {
+			w.Header().Set(NextTokenHeader, strconv.Itoa(end))
+		}
+		json.NewEncoder(w).Encode(f.files[start:end])
+	case r.Method == "GET" && len(parts) == 2:
+		if _, found := f.objects[parts[1]]; !found {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"DownloadURL": f.URL + "/objects/" + parts[1]})
+	case r.Method == "PATCH" && len(parts) == 2:
+		json.NewEncoder(w).Encode(map[string]string{"PostURL": f.URL + "/objects/" + parts[1]})
+	case r.Method == "DELETE" && len(parts) == 2:
+		json.NewEncoder(w).Encode(map[string]string{"DeleteURL": f.URL + "/objects/" + parts[1]})
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func (f *fakeAPI) client() *Client {
+	c := New(f.URL, "token")
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = 5 * time.Millisecond
+	return c
+}
+
+func (f *fakeAPI) count(request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, r := range f.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUploadDownloadOverwriteDelete(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	c := api.client()
+	ctx := context.Background()
+
+	fileID, err := c.Upload(ctx, "u1", UploadRequest{FileName: "a.txt"}, strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.files[0].FileSize != 5 || api.objects[fileID] != "hello" {
+		t.Fatalf("files %+v objects %v", api.files, api.objects)
+	}
+
+	body, size, err := c.Download(ctx, "u1", fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" || size != 5 {
+		t.Errorf("downloaded %q size %v", data, size)
+	}
+
+	if err := c.Overwrite(ctx, "u1", fileID, "b.txt", strings.NewReader("bye"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if api.objects[fileID] != "bye" {
+		t.Errorf("object after overwrite = %q", api.objects[fileID])
+	}
+
+	if err := c.Delete(ctx, "u1", fileID); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := api.objects[fileID]; found {
+		t.Error("object survived delete")
+	}
+
+	_, _, err = c.Download(ctx, "u1", fileID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("download after delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUploadDeduplicated(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	c := api.client()
+	ctx := context.Background()
+
+	req := UploadRequest{FileName: "a.txt", SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}
+	first, err := c.Upload(ctx, "u1", req, strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.FileName = "b.txt"
+	second, err := c.Upload(ctx, "u1", req, strings.NewReader("hello"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("second upload reused FileID %v", first)
+	}
+	if n := api.count("PUT /objects/" + second); n != 0 {
+		t.Errorf("deduplicated content was PUT %v times", n)
+	}
+	if _, found := api.objects[second]; found {
+		t.Error("deduplicated content was stored")
+	}
+}
+
+func TestListFollowsPages(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	for i := 0; i < 7; i++ {
+		api.files = append(api.files, File{FileID: strconv.Itoa(i)})
+	}
+
+	c := api.client()
+	c.PageSize = 3
+	files, err := c.List(context.Background(), "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 7 || files[6].FileID != "6" {
+		t.Errorf("files = %+v", files)
+	}
+	if n := api.count("GET /u1"); n != 3 {
+		t.Errorf("fetched %v pages, want 3", n)
+	}
+}
+
+func TestAuditFollowsPages(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	for i, action := range []string{"upload", "download", "rename", "delete"} {
+		api.audit = append(api.audit, AuditEntry{EntryID: strconv.Itoa(i), Action: action, FileID: "f1"})
+	}
+	api.audit = append(api.audit, AuditEntry{EntryID: "other", Action: "upload", FileID: "f2"})
+
+	entries, err := api.client().Audit(context.Background(), AuditFilter{FileID: "f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || entries[3].Action != "delete" {
+		t.Errorf("entries = %+v", entries)
+	}
+	if n := api.count("GET /audit"); n != 2 {
+		t.Errorf("fetched %v pages, want 2", n)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	c := api.client()
+	ctx := context.Background()
+
+	// throttled twice, then let through
+	throttled := 0
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "POST" && throttled < 2 {
+			throttled++
+			w.WriteHeader(503)
+			return true
+		}
+		return false
+	}
+	if _, err := c.Upload(ctx, "u1", UploadRequest{FileName: "a"}, strings.NewReader("x"), 1); err != nil {
+		t.Fatalf("upload after 503s: %v", err)
+	}
+	if n := api.count("POST /u1"); n != 3 {
+		t.Errorf("POST sent %v times, want 3", n)
+	}
+
+	// a 500 on POST may have created the file, so it is not repeated
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "POST" {
+			w.WriteHeader(500)
+			return true
+		}
+		return false
+	}
+	_, err := c.Upload(ctx, "u1", UploadRequest{FileName: "a"}, strings.NewReader("x"), 1)
+	if !errors.Is(err, ErrServer) || api.count("POST /u1") != 4 {
+		t.Errorf("upload on 500 = %v after %v POSTs", err, api.count("POST /u1"))
+	}
+
+	// but a GET is, until the retries run out
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" {
+			w.WriteHeader(502)
+			return true
+		}
+		return false
+	}
+	c.MaxRetries = 2
+	_, err = c.List(ctx, "u1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 502 || api.count("GET /u1") != 3 {
+		t.Errorf("list on 502 = %v after %v GETs", err, api.count("GET /u1"))
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	c := api.client()
+	ctx := context.Background()
+
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/quota":
+			w.WriteHeader(413)
+			w.Write([]byte(`{"Error":"storage quota exceeded","RequestedBytes":10,"UserID":"quota","UsedBytes":5,"FileCount":1,"MaxBytes":12,"MaxFiles":10}`))
+		case "/bad":
+			w.WriteHeader(400)
+			w.Write([]byte(`invalid request body: FileName is required`))
+		case "/forbidden":
+			w.WriteHeader(403)
+		case "/policy":
+			w.WriteHeader(415)
+			w.Write([]byte(`files with the extension .exe are not allowed`))
+		default:
+			return false
+		}
+		return true
+	}
+
+	_, err := c.Upload(ctx, "quota", UploadRequest{FileName: "a"}, strings.NewReader("0123456789"), 10)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrQuotaExceeded) || apiErr.Quota.MaxBytes != 12 || apiErr.Message != "storage quota exceeded" {
+		t.Errorf("quota error = %#v", err)
+	}
+
+	_, err = c.Upload(ctx, "bad", UploadRequest{}, strings.NewReader(""), 0)
+	if !errors.Is(err, ErrBadRequest) || !strings.Contains(err.Error(), "FileName is required") {
+		t.Errorf("bad request error = %v", err)
+	}
+
+	_, err = c.Upload(ctx, "policy", UploadRequest{FileName: "setup.exe"}, strings.NewReader(""), 0)
+	if !errors.Is(err, ErrNotAllowed) || !strings.Contains(err.Error(), ".exe are not allowed") {
+		t.Errorf("policy error = %v", err)
+	}
+
+	_, err = c.List(ctx, "forbidden")
+	if !errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+		t.Errorf("forbidden error = %v", err)
+	}
+
+	c.Token = StaticToken("wrong")
+	_, err = c.List(ctx, "u1")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("unauthorized error = %v", err)
+	}
+}
+
+func TestSignedURLNotInError(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			w.WriteHeader(403)
+			return true
+		}
+		return false
+	}
+
+	_, err := api.client().Upload(context.Background(), "u1", UploadRequest{FileName: "a"}, strings.NewReader("x"), 1)
+	if !errors.Is(err, ErrForbidden) || strings.Contains(err.Error(), "secret") {
+		t.Errorf("PUT error = %v", err)
+	}
+}
+
+func TestContextCancelledDuringBackoff(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	api.fail = func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(429)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := api.client().List(ctx, "u1")
+	if err != context.DeadlineExceeded || time.Since(start) > 5*time.Second {
+		t.Errorf("List = %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinels an *Error matches with errors.Is, by status code
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrNotAllowed    = errors.New("not allowed by the upload policy")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrServer        = errors.New("server error")
+)
+
+// Error is a non-2xx response from the API or a signed storage URL
+type Error struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Message is the error text from the response body, if any
+	Message string
+	// RetryAfter is the wait the server asked for on 429 or 503
+	RetryAfter time.Duration
+	// Quota is set when an upload was refused for exceeding the user's quota
+	Quota *QuotaExceeded
+}
+
+// QuotaExceeded is the body of a 413, or of a 429 for the file count limit
+type QuotaExceeded struct {
+	Message        string `json:"Error"`
+	RequestedBytes int64  `json:"RequestedBytes"`
+	UserID         string `json:"UserID"`
+	UsedBytes      int64  `json:"UsedBytes"`
+	FileCount      int64  `json:"FileCount"`
+	MaxBytes       int64  `json:"MaxBytes"`
+	MaxFiles       int64  `json:"MaxFiles"`
+}
+
+func (e *Error) Error() string {
+	// signed URLs carry credentials in the query string, so leave it out
+	target := e.URL
+	if i := strings.Index(target, "?"); i >= 0 {
+		target = target[:i]
+	}
+
+	msg := fmt.Sprintf("%v %v: %v %v", e.Method, target, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
+
+// Is lets errors.Is(err, ErrNotFound) and friends match
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrNotAllowed:
+		return e.StatusCode == http.StatusUnsupportedMediaType
+	case ErrQuotaExceeded:
+		return e.Quota != nil
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests && e.Quota == nil
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+
+	return false
+}
+
+func (e *Error) retryable(policy retryPolicy) bool {
+	switch {
+	case policy == retryNever || e.Quota != nil:
+		return false
+	case e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable:
+		return true
+	case policy == retryAlways:
+		return e.StatusCode == http.StatusInternalServerError ||
+			e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusGatewayTimeout
+	}
+
+	return false
+}
+
+// newError reads an error response. The API answers with an empty body, plain text,
+// {"message": ...} from API Gateway, or the quota error document.
+func newError(req *http.Request, resp *http.Response) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Method:     req.Method,
+		URL:        req.URL.String(),
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	body, _ := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 64<<10))
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return e
+	}
+
+	var doc struct {
+		Message  string `json:"message"`
+		Error    string `json:"Error"`
+		UserID   string `json:"UserID"`
+		MaxBytes *int64 `json:"MaxBytes"`
+	}
+	if json.Unmarshal(body, &doc) != nil {
+		e.Message = text
+		return e
+	}
+
+	e.Message = doc.Message
+	if doc.Error != "" {
+		e.Message = doc.Error
+	}
+	if doc.Error != "" && doc.MaxBytes != nil {
+		quota := &QuotaExceeded{}
+		if json.Unmarshal(body, quota) == nil {
+			e.Quota = quota
+		}
+	}
+
+	return e
+}
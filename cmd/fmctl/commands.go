@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/client"
+)
+
+// uploaded is one line of upload's JSON output
+type uploaded struct {
+	Path     string `json:"Path"`
+	FileID   string `json:"FileID"`
+	FileName string `json:"FileName"`
+	FileSize int64  `json:"FileSize"`
+}
+
+func (c *cli) upload(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	recursive := fs.Bool("r", false, "upload directories and their contents")
+	name := fs.String("name", "", "file name to store a single file under (default its base name)")
+	paths, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("upload: no paths given")
+	}
+	if *name != "" && len(paths) > 1 {
+		return fmt.Errorf("upload: --name needs a single path")
+	}
+
+	var results []uploaded
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			fileName := *name
+			if fileName == "" {
+				fileName = filepath.Base(path)
+			}
+			result, err := c.uploadFile(ctx, path, fileName)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if !*recursive {
+			return fmt.Errorf("upload: %v is a directory, use -r", path)
+		}
+
+		// files are named by their path below the directory's parent, so
+		// upload -r photos stores photos/2021/a.jpg
+		root := filepath.Dir(filepath.Clean(path))
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			result, err := c.uploadFile(ctx, file, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.json {
+		return c.printJSON(results)
+	}
+	for _, r := range results {
+		fmt.Fprintf(c.stdout, "%v\t%v\n", r.FileID, r.FileName)
+	}
+
+	return nil
+}
+
+func (c *cli) uploadFile(ctx context.Context, path string, fileName string) (uploaded, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return uploaded{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return uploaded{}, err
+	}
+
+	// declaring the digest lets the API skip content this user already uploaded
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return uploaded{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return uploaded{}, err
+	}
+	req := client.UploadRequest{FileName: fileName, SHA256: hex.EncodeToString(hash.Sum(nil))}
+
+	var content io.Reader = f
+	bar := c.newProgress(fileName, info.Size())
+	if bar != nil {
+		content = bar.reader(f)
+		defer bar.done()
+	}
+
+	fileID, err := c.client.Upload(ctx, c.user, req, content, info.Size())
+	if err != nil {
+		return uploaded{}, fmt.Errorf("upload %v: %v", path, err)
+	}
+
+	return uploaded{Path: path, FileID: fileID, FileName: fileName, FileSize: info.Size()}, nil
+}
+
+func (c *cli) download(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	output := fs.String("o", "", `write to this path, "-" for stdout (default the file's name)`)
+	ids, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("download: need exactly one fileId")
+	}
+	fileID := ids[0]
+
+	path := *output
+	if path == "" {
+		file, err := c.find(ctx, fileID)
+		if err != nil {
+			return err
+		}
+		// only the base name, so a stored "../x" cannot escape the working directory
+		path = filepath.Base(filepath.FromSlash(file.FileName))
+		if path == "." || path == string(filepath.Separator) || path == ".." {
+			path = fileID
+		}
+	}
+
+	body, size, err := c.client.Download(ctx, c.user, fileID)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var w io.Writer = c.stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var content io.Reader = body
+	bar := c.newProgress(fileID, size)
+	if bar != nil {
+		content = bar.reader(body)
+		defer bar.done()
+	}
+
+	n, err := io.Copy(w, content)
+	if err != nil {
+		return fmt.Errorf("download %v: %v", fileID, err)
+	}
+	if f, ok := w.(*os.File); ok && path != "-" {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if c.json && path != "-" {
+		return c.printJSON(map[string]interface{}{"FileID": fileID, "Path": path, "Bytes": n})
+	}
+	if path != "-" {
+		fmt.Fprintf(c.stderr, "saved %v (%v)\n", path, formatBytes(n))
+	}
+
+	return nil
+}
+
+func (c *cli) thumbnail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("thumbnail", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	size := fs.String("size", "", "small, medium or large (default medium)")
+	output := fs.String("o", "", `write to this path, "-" for stdout (default <fileId>_<size> with the image's extension)`)
+	ids, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("thumbnail: need exactly one fileId")
+	}
+	fileID := ids[0]
+
+	body, thumb, err := c.client.Thumbnail(ctx, c.user, fileID, *size)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	path := *output
+	if path == "" {
+		path = filepath.Base(filepath.FromSlash(fileID)) + "_" + thumb.Size
+		switch thumb.ContentType {
+		case "image/jpeg":
+			path += ".jpg"
+		case "image/png":
+			path += ".png"
+		}
+	}
+
+	var w io.Writer = c.stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return fmt.Errorf("thumbnail %v: %v", fileID, err)
+	}
+	if f, ok := w.(*os.File); ok && path != "-" {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if c.json && path != "-" {
+		return c.printJSON(map[string]interface{}{
+			"FileID": fileID, "Path": path, "Bytes": n,
+			"Size": thumb.Size, "Width": thumb.Width, "Height": thumb.Height, "ContentType": thumb.ContentType,
+		})
+	}
+	if path != "-" {
+		fmt.Fprintf(c.stderr, "saved %v (%vx%v %v)\n", path, thumb.Width, thumb.Height, thumb.ContentType)
+	}
+
+	return nil
+}
+
+// find looks fileID up in the user's listing, for its name
+func (c *cli) find(ctx context.Context, fileID string) (client.File, error) {
+	files, err := c.client.List(ctx, c.user)
+	if err != nil {
+		return client.File{}, err
+	}
+	for _, f := range files {
+		if f.FileID == fileID {
+			return f, nil
+		}
+	}
+
+	return client.File{}, fmt.Errorf("%v: %w", fileID, client.ErrNotFound)
+}
+
+func (c *cli) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	all := fs.Bool("all", false, "list every user's files (Admin only)")
+	owner := fs.String("user-filter", "", "with --all, only this user's files")
+	rest, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("ls: unexpected arguments %v", rest)
+	}
+
+	var files []client.File
+	if *all {
+		files, err = c.client.ListAll(ctx, client.ListAllOptions{UserID: *owner})
+	} else {
+		files, err = c.client.List(ctx, c.user)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(files)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	if *all {
+		fmt.Fprintln(tw, "FILE ID\tUSER\tSIZE\tMODIFIED\tNAME")
+	} else {
+		fmt.Fprintln(tw, "FILE ID\tSIZE\tMODIFIED\tNAME")
+	}
+	for _, f := range files {
+		size := "-"
+		if f.FileSize > 0 {
+			size = formatBytes(f.FileSize)
+		}
+		if *all {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", f.FileID, f.UserID, size, f.Modified, f.FileName)
+		} else {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", f.FileID, size, f.Modified, f.FileName)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (c *cli) remove(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("rm: no fileIds given")
+	}
+
+	var removed []string
+	for _, fileID := range args {
+		if err := c.client.Delete(ctx, c.user, fileID); err != nil {
+			return fmt.Errorf("rm %v: %v", fileID, err)
+		}
+		removed = append(removed, fileID)
+		if !c.json {
+			fmt.Fprintf(c.stdout, "removed %v\n", fileID)
+		}
+	}
+
+	if c.json {
+		return c.printJSON(map[string][]string{"Removed": removed})
+	}
+
+	return nil
+}
+
+func (c *cli) move(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("mv: usage: mv <fileId> <newName>")
+	}
+	fileID, fileName := args[0], strings.TrimSpace(args[1])
+
+	file, err := c.client.Rename(ctx, c.user, fileID, fileName)
+	if err != nil {
+		return fmt.Errorf("mv %v: %v", fileID, err)
+	}
+
+	if c.json {
+		return c.printJSON(file)
+	}
+	fmt.Fprintf(c.stdout, "%v\t%v\n", file.FileID, file.FileName)
+
+	return nil
+}
+
+func (c *cli) copy(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cp", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	toUser := fs.String("to-user", "", "copy into this user's files (Admin only)")
+	folder := fs.String("folder", "", `folder for the copy, "/" for the top level (default the source's)`)
+	rest, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		return fmt.Errorf("cp: usage: cp [--to-user id] [--folder f] <fileId> [newName]")
+	}
+
+	req := client.CopyRequest{TargetUserID: *toUser, Folder: *folder}
+	if len(rest) == 2 {
+		req.FileName = strings.TrimSpace(rest[1])
+	}
+
+	file, err := c.client.Copy(ctx, c.user, rest[0], req)
+	if err != nil {
+		return fmt.Errorf("cp %v: %v", rest[0], err)
+	}
+
+	if c.json {
+		return c.printJSON(file)
+	}
+	fmt.Fprintf(c.stdout, "%v\t%v\n", file.FileID, file.FileName)
+
+	return nil
+}
+
+func (c *cli) audit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	owner := fs.String("user-filter", "", "entries about this user's files")
+	fileID := fs.String("file", "", "entries about this file")
+	jsonl := fs.Bool("jsonl", false, "export the entries as JSON Lines")
+	rest, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 || (*owner == "") == (*fileID == "") {
+		return fmt.Errorf("audit: usage: audit [--jsonl] (--user-filter id | --file fileId)")
+	}
+
+	entries, err := c.client.Audit(ctx, client.AuditFilter{UserID: *owner, FileID: *fileID})
+	if err != nil {
+		return err
+	}
+
+	if *jsonl {
+		enc := json.NewEncoder(c.stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if c.json {
+		return c.printJSON(entries)
+	}
+
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tACTION\tACTOR\tUSER\tFILE ID\tSOURCE IP")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", e.Timestamp, e.Action, e.Actor, e.TargetUser, e.FileID, e.SourceIP)
+	}
+
+	return tw.Flush()
+}
+
+func (c *cli) webhook(ctx context.Context, args []string) error {
+	const usage = "webhook: usage: webhook add [--secret s] [--events e,...] <url> | ls | rm <webhookId> | deliveries <webhookId>"
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+
+	switch sub, rest := args[0], args[1:]; {
+	case sub == "add":
+		fs := flag.NewFlagSet("webhook add", flag.ContinueOnError)
+		fs.SetOutput(c.stderr)
+		secret := fs.String("secret", "", "sign deliveries with this secret (default a generated one)")
+		events := fs.String("events", "", "comma separated event types to receive (default all)")
+		rest, err := parseInterleaved(fs, rest)
+		if err != nil {
+			return err
+		}
+		if len(rest) != 1 {
+			return fmt.Errorf(usage)
+		}
+
+		req := client.WebhookRequest{URL: rest[0], Secret: *secret}
+		if *events != "" {
+			req.Events = strings.Split(*events, ",")
+		}
+		hook, err := c.client.RegisterWebhook(ctx, c.user, req)
+		if err != nil {
+			return fmt.Errorf("webhook add: %v", err)
+		}
+		if c.json {
+			return c.printJSON(hook)
+		}
+		fmt.Fprintf(c.stdout, "%v\t%v\nsecret: %v\n", hook.WebhookID, hook.URL, hook.Secret)
+		return nil
+
+	case sub == "ls" && len(rest) == 0:
+		hooks, err := c.client.Webhooks(ctx, c.user)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(hooks)
+		}
+
+		tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "WEBHOOK ID\tCREATED\tEVENTS\tURL")
+		for _, h := range hooks {
+			events := strings.Join(h.Events, ",")
+			if events == "" {
+				events = "all"
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", h.WebhookID, h.Created, events, h.URL)
+		}
+		return tw.Flush()
+
+	case sub == "rm" && len(rest) == 1:
+		if err := c.client.DeleteWebhook(ctx, c.user, rest[0]); err != nil {
+			return fmt.Errorf("webhook rm %v: %v", rest[0], err)
+		}
+		if !c.json {
+			fmt.Fprintf(c.stdout, "removed %v\n", rest[0])
+		}
+		return nil
+
+	case sub == "deliveries" && len(rest) == 1:
+		attempts, err := c.client.WebhookDeliveries(ctx, c.user, rest[0])
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(attempts)
+		}
+
+		tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tEVENT\tATTEMPT\tOUTCOME\tSTATUS\tERROR")
+		for _, a := range attempts {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", a.Timestamp, a.EventType, a.Attempt, a.Outcome, a.StatusCode, a.Error)
+		}
+		return tw.Flush()
+	}
+
+	return fmt.Errorf(usage)
+}
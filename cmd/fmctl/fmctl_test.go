@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPI keeps files and contents in memory, answering the API routes and the
+// signed URLs (under /objects/) that fmctl uses
+type fakeAPI struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	names   map[string]string // FileID -> FileName
+	digests map[string]string // FileID -> declared SHA256
+	objects map[string][]byte
+	hooks   map[string]string // WebhookID -> URL
+}
+
+func newFakeAPI() *fakeAPI {
+	f := &fakeAPI{names: map[string]string{}, digests: map[string]string{}, objects: map[string][]byte{}, hooks: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id := strings.TrimPrefix(r.URL.Path, "/objects/"); id != r.URL.Path {
+		switch r.Method {
+		case "PUT":
+			f.objects[id], _ = ioutil.ReadAll(r.Body)
+		case "GET":
+			w.Write(f.objects[id])
+		case "DELETE":
+			delete(f.objects, id)
+		}
+		return
+	}
+
+	if r.URL.Path == "/audit" {
+		entries := []map[string]interface{}{}
+		if fileID := r.URL.Query().Get("fileId"); f.names[fileID] != "" {
+			entries = append(entries, map[string]interface{}{"Action": "upload", "Actor": "u1", "TargetUser": "u1", "FileID": fileID})
+		}
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	if r.URL.Path != "/u1" && !strings.HasPrefix(r.URL.Path, "/u1/") {
+		w.WriteHeader(403)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) > 1 && parts[1] == "webhooks" {
+		f.serveWebhooks(w, r, parts[2:])
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && len(parts) == 1:
+		var req struct{ FileName, SHA256 string }
+		json.NewDecoder(r.Body).Decode(&req)
+		id := fmt.Sprintf("id%d", len(f.names))
+		f.names[id] = req.FileName
+		f.digests[id] = req.SHA256
+		json.NewEncoder(w).Encode(map[string]string{"FileID": id, "UploadURL": f.URL + "/objects/" + id})
+	case r.Method == "GET" && len(parts) == 1:
+		files := []map[string]string{}
+		for id, name := range f.names {
+			files = append(files, map[string]string{"FileID": id, "UserID": "u1", "FileName": name})
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i]["FileID"] < files[j]["FileID"] })
+		json.NewEncoder(w).Encode(files)
+	case r.Method == "GET" && len(parts) == 3 && parts[2] == "thumbnail":
+		// the content itself stands in for the rendition
+		size := r.URL.Query().Get("size")
+		if size == "" {
+			size = "medium"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ThumbnailURL": f.URL + "/objects/" + parts[1], "Size": size, "Width": 128, "Height": 96, "ContentType": "image/jpeg",
+		})
+	case r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]string{"DownloadURL": f.URL + "/objects/" + parts[1]})
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "rename":
+		var req struct{ FileName string }
+		json.NewDecoder(r.Body).Decode(&req)
+		f.names[parts[1]] = req.FileName
+		json.NewEncoder(w).Encode(map[string]string{"FileID": parts[1], "FileName": req.FileName})
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "copy":
+		var req struct{ FileName string }
+		json.NewDecoder(r.Body).Decode(&req)
+		id := fmt.Sprintf("id%d", len(f.names))
+		f.names[id] = req.FileName
+		f.objects[id] = f.objects[parts[1]]
+		json.NewEncoder(w).Encode(map[string]string{"FileID": id, "FileName": req.FileName})
+	case r.Method == "DELETE":
+		delete(f.names, parts[1])
+		json.NewEncoder(w).Encode(map[string]string{"DeleteURL": f.URL + "/objects/" + parts[1]})
+	}
+}
+
+func (f *fakeAPI) serveWebhooks(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case r.Method == "POST" && len(parts) == 0:
+		var req struct{ URL string }
+		json.NewDecoder(r.Body).Decode(&req)
+		id := fmt.Sprintf("hook%d", len(f.hooks))
+		f.hooks[id] = req.URL
+		json.NewEncoder(w).Encode(map[string]string{"WebhookID": id, "URL": req.URL, "Secret": "generated-secret"})
+	case r.Method == "GET" && len(parts) == 0:
+		hooks := []map[string]string{}
+		for id, u := range f.hooks {
+			hooks = append(hooks, map[string]string{"WebhookID": id, "URL": u})
+		}
+		json.NewEncoder(w).Encode(hooks)
+	case r.Method == "GET" && len(parts) == 2 && parts[1] == "deliveries":
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"WebhookID": parts[0], "EventType": "file.created", "Attempt": 1, "Outcome": "delivered", "StatusCode": 200},
+		})
+	case r.Method == "DELETE" && len(parts) == 1 && f.hooks[parts[0]] != "":
+		delete(f.hooks, parts[0])
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func token(sub string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	return "eyJhbGciOiJSUzI1NiJ9." + payload + ".sig"
+}
+
+func fmctl(t *testing.T, api *fakeAPI, args ...string) string {
+	t.Helper()
+
+	vars := map[string]string{"FMCTL_URL": api.URL, "FMCTL_TOKEN": token("u1")}
+	var stdout, stderr bytes.Buffer
+	if err := run(context.Background(), args, &stdout, &stderr, func(k string) string { return vars[k] }); err != nil {
+		t.Fatalf("fmctl %v: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+
+	return stdout.String()
+}
+
+func TestCommands(t *testing.T) {
+	api := newFakeAPI()
+	defer api.Close()
+
+	dir, err := ioutil.TempDir("", "fmctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "photos", "2021"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "photos", "a.jpg"), []byte("aaa"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "photos", "2021", "b.jpg"), []byte("bbbb"), 0644)
+
+	var uploaded []struct{ FileID, FileName string }
+	out := fmctl(t, api, "--json", "upload", "-r", filepath.Join(dir, "photos"))
+	if err := json.Unmarshal([]byte(out), &uploaded); err != nil || len(uploaded) != 2 {
+		t.Fatalf("upload output %q: %v", out, err)
+	}
+	names := map[string]string{}
+	for _, u := range uploaded {
+		names[u.FileName] = u.FileID
+	}
+	if names["photos/a.jpg"] == "" || names["photos/2021/b.jpg"] == "" {
+		t.Fatalf("uploaded names = %v", names)
+	}
+	if digest := sha256.Sum256([]byte("aaa")); api.digests[names["photos/a.jpg"]] != hex.EncodeToString(digest[:]) {
+		t.Errorf("declared digest = %q", api.digests[names["photos/a.jpg"]])
+	}
+
+	out = fmctl(t, api, "ls")
+	if !strings.Contains(out, "photos/a.jpg") || !strings.Contains(out, "FILE ID") {
+		t.Errorf("ls output:\n%v", out)
+	}
+
+	target := filepath.Join(dir, "out.jpg")
+	fmctl(t, api, "download", names["photos/2021/b.jpg"], "-o", target)
+	if data, _ := ioutil.ReadFile(target); string(data) != "bbbb" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	if out := fmctl(t, api, "download", names["photos/a.jpg"], "-o", "-"); out != "aaa" {
+		t.Errorf("download to stdout = %q", out)
+	}
+
+	thumb := filepath.Join(dir, "thumb.jpg")
+	out = fmctl(t, api, "--json", "thumbnail", "--size", "small", names["photos/a.jpg"], "-o", thumb)
+	var saved struct {
+		Path, Size    string
+		Width, Height int
+	}
+	if err := json.Unmarshal([]byte(out), &saved); err != nil || saved.Path != thumb || saved.Size != "small" || saved.Width != 128 {
+		t.Errorf("thumbnail output %q: %v", out, err)
+	}
+	if data, _ := ioutil.ReadFile(thumb); string(data) != "aaa" {
+		t.Errorf("thumbnail saved %q", data)
+	}
+
+	fmctl(t, api, "mv", names["photos/a.jpg"], "renamed.jpg")
+	if api.names[names["photos/a.jpg"]] != "renamed.jpg" {
+		t.Errorf("names after mv = %v", api.names)
+	}
+
+	out = fmctl(t, api, "cp", names["photos/a.jpg"], "copy.jpg")
+	copyID := strings.Fields(out)[0]
+	if api.names[copyID] != "copy.jpg" || string(api.objects[copyID]) != "aaa" {
+		t.Errorf("cp output %q, names %v", out, api.names)
+	}
+
+	out = fmctl(t, api, "audit", "--file", copyID, "--jsonl")
+	var entry struct{ Action, FileID string }
+	if err := json.Unmarshal([]byte(out), &entry); err != nil || entry.Action != "upload" || entry.FileID != copyID {
+		t.Errorf("audit --jsonl output %q: %v", out, err)
+	}
+
+	fmctl(t, api, "rm", names["photos/a.jpg"], names["photos/2021/b.jpg"], copyID)
+	var files []interface{}
+	json.Unmarshal([]byte(fmctl(t, api, "--json", "ls")), &files)
+	if len(files) != 0 || len(api.objects) != 0 {
+		t.Errorf("after rm: files %v objects %v", files, api.objects)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	api := newFakeAPI()
+	defer api.Close()
+
+	out := fmctl(t, api, "webhook", "add", "https://hooks.example.com/files", "--events", "file.created")
+	if !strings.HasPrefix(out, "hook0\t") || !strings.Contains(out, "secret: generated-secret") {
+		t.Errorf("webhook add output:\n%v", out)
+	}
+
+	out = fmctl(t, api, "webhook", "ls")
+	if !strings.Contains(out, "hook0") || !strings.Contains(out, "https://hooks.example.com/files") {
+		t.Errorf("webhook ls output:\n%v", out)
+	}
+
+	out = fmctl(t, api, "webhook", "deliveries", "hook0")
+	if !strings.Contains(out, "file.created") || !strings.Contains(out, "delivered") {
+		t.Errorf("webhook deliveries output:\n%v", out)
+	}
+
+	fmctl(t, api, "webhook", "rm", "hook0")
+	if len(api.hooks) != 0 {
+		t.Errorf("hooks after rm: %v", api.hooks)
+	}
+
+	var buf bytes.Buffer
+	vars := map[string]string{"FMCTL_URL": api.URL, "FMCTL_TOKEN": token("u1")}
+	if err := run(context.Background(), []string{"webhook", "rm", "hook0"}, &buf, &buf, func(k string) string { return vars[k] }); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("removing a missing webhook: %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	api := newFakeAPI()
+	defer api.Close()
+
+	run := func(vars map[string]string, args ...string) error {
+		var out bytes.Buffer
+		return run(context.Background(), args, &out, &out, func(k string) string { return vars[k] })
+	}
+
+	if err := run(map[string]string{"FMCTL_URL": api.URL}, "ls"); err == nil || !strings.Contains(err.Error(), "no token") {
+		t.Errorf("without token: %v", err)
+	}
+	if err := run(map[string]string{"FMCTL_URL": api.URL, "FMCTL_TOKEN": token("u2")}, "ls"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("other user: %v", err)
+	}
+	if err := run(map[string]string{"FMCTL_URL": api.URL, "FMCTL_TOKEN": token("u1")}, "upload", os.TempDir()); err == nil || !strings.Contains(err.Error(), "use -r") {
+		t.Errorf("directory without -r: %v", err)
+	}
+	if err := run(map[string]string{"FMCTL_URL": api.URL, "FMCTL_TOKEN": token("u1")}, "frobnicate"); err == nil {
+		t.Error("unknown command succeeded")
+	}
+	if err := run(nil); err != flag.ErrHelp {
+		t.Errorf("no command: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fmctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vars := map[string]string{"HOME": dir}
+	getenv := func(k string) string { return vars[k] }
+
+	if config, err := loadConfig("", getenv); err != nil || config != (Config{}) {
+		t.Errorf("missing default config = %+v, %v", config, err)
+	}
+	if _, err := loadConfig(filepath.Join(dir, "nope.json"), getenv); err == nil {
+		t.Error("missing explicit config should fail")
+	}
+
+	os.MkdirAll(filepath.Join(dir, ".config", "fmctl"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, ".config", "fmctl", "config.json"), []byte(`{"url":"http://api","token":"t","user":"u"}`), 0600)
+	if config, err := loadConfig("", getenv); err != nil || config != (Config{URL: "http://api", Token: "t", User: "u"}) {
+		t.Errorf("default config = %+v, %v", config, err)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	if sub, err := subject(token("abc")); err != nil || sub != "abc" {
+		t.Errorf("subject = %q, %v", sub, err)
+	}
+	for _, bad := range []string{"", "a.b", "a.!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".c"} {
+		if _, err := subject(bad); err == nil {
+			t.Errorf("subject(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	p := &progress{label: "a.txt", total: 2048, n: 1024}
+	if line := p.line(); !strings.Contains(line, "[===============>              ]  50% 1.0KiB/2.0KiB") {
+		t.Errorf("line = %q", line)
+	}
+
+	p = &progress{label: "a.txt", total: -1, n: 10}
+	if line := p.line(); !strings.HasSuffix(line, " 10B") {
+		t.Errorf("unknown total line = %q", line)
+	}
+}
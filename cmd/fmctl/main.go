@@ -0,0 +1,261 @@
+// Command fmctl manages files through the file management API.
+//
+//	$ export FMCTL_URL=https://<api-id>.execute-api.us-west-2.amazonaws.com FMCTL_TOKEN=<id token>
+//	$ fmctl upload report.pdf
+//	$ fmctl upload -r ./photos
+//	$ fmctl ls
+//	$ fmctl download <fileId> -o report.pdf
+//	$ fmctl thumbnail --size small <fileId>
+//	$ fmctl mv <fileId> final.pdf
+//	$ fmctl cp <fileId> final-copy.pdf
+//	$ fmctl rm <fileId>
+//	$ fmctl audit --file <fileId> --jsonl > history.jsonl
+//	$ fmctl webhook add --events file.committed,file.deleted https://hooks.example.com/files
+//
+// The URL, token and user can also come from a JSON config file, by default
+// ~/.config/fmctl/config.json: {"url": "...", "token": "...", "user": "..."}.
+// The user defaults to the token's sub claim. --json prints results as JSON for scripts.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/client"
+)
+
+const usage = `usage: fmctl [global flags] <command> [flags] [args]
+
+commands:
+  upload [-r] <path>...           upload files, or directories with -r
+  download <fileId> [-o path]     download a file, to its own name unless -o is given ("-" for stdout)
+  thumbnail [--size s] <fileId> [-o path]
+                                  download a thumbnail of an image file: small, medium or large
+  ls [--all] [--user-filter id]   list your files, or with --all every file (Admin only)
+  rm <fileId>...                  delete files
+  mv <fileId> <newName>           rename a file, or move it with a name like folder/name
+  cp [--to-user id] [--folder f] <fileId> [newName]
+                                  copy a file on the server
+  audit [--jsonl] (--user-filter id | --file fileId)
+                                  show who did what to a user's files or one file (Admin only),
+                                  or export it as JSON Lines
+  webhook add [--secret s] [--events e,...] <url>
+                                  have your file events POSTed to url, signed with the secret
+  webhook ls | rm <webhookId> | deliveries <webhookId>
+                                  list or remove webhooks, or show a webhook's delivery attempts
+
+global flags:
+`
+
+// Config is the config file; environment variables and flags take precedence
+type Config struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	User  string `json:"user"`
+}
+
+// env is the environment fmctl reads settings from, os.Getenv outside tests
+type env func(string) string
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr, os.Getenv); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "fmctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// cli is one invocation: the configured client and where output goes
+type cli struct {
+	client   *client.Client
+	user     string
+	json     bool
+	progress bool
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer, getenv env) error {
+	global := flag.NewFlagSet("fmctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		global.PrintDefaults()
+	}
+
+	configPath := global.String("config", getenv("FMCTL_CONFIG"), "config file (default ~/.config/fmctl/config.json)")
+	apiURL := global.String("url", getenv("FMCTL_URL"), "API base URL, or FMCTL_URL")
+	user := global.String("user", getenv("FMCTL_USER"), "act on this user's files, default the token's sub; or FMCTL_USER")
+	jsonOutput := global.Bool("json", false, "print results as JSON")
+	quiet := global.Bool("q", false, "no progress bars")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return flag.ErrHelp
+	}
+
+	config, err := loadConfig(*configPath, getenv)
+	if err != nil {
+		return err
+	}
+
+	token := getenv("FMCTL_TOKEN")
+	if token == "" {
+		token = config.Token
+	}
+	if *apiURL == "" {
+		*apiURL = config.URL
+	}
+	if *user == "" {
+		*user = config.User
+	}
+	if *apiURL == "" {
+		return fmt.Errorf("no API URL: set FMCTL_URL, --url or url in the config file")
+	}
+	if token == "" {
+		return fmt.Errorf("no token: set FMCTL_TOKEN or token in the config file")
+	}
+	if *user == "" {
+		if *user, err = subject(token); err != nil {
+			return fmt.Errorf("no user: %v; set FMCTL_USER or --user", err)
+		}
+	}
+
+	c := &cli{
+		client:   client.New(*apiURL, token),
+		user:     *user,
+		json:     *jsonOutput,
+		progress: !*quiet && !*jsonOutput && isTerminal(stderr),
+		stdout:   stdout,
+		stderr:   stderr,
+	}
+
+	command, rest := global.Arg(0), global.Args()[1:]
+	switch command {
+	case "upload":
+		return c.upload(ctx, rest)
+	case "download":
+		return c.download(ctx, rest)
+	case "thumbnail":
+		return c.thumbnail(ctx, rest)
+	case "ls":
+		return c.list(ctx, rest)
+	case "rm":
+		return c.remove(ctx, rest)
+	case "mv":
+		return c.move(ctx, rest)
+	case "cp":
+		return c.copy(ctx, rest)
+	case "audit":
+		return c.audit(ctx, rest)
+	case "webhook":
+		return c.webhook(ctx, rest)
+	}
+
+	global.Usage()
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// loadConfig reads the config file at path, or the default location if path is empty.
+// A missing default file is not an error.
+func loadConfig(path string, getenv env) (Config, error) {
+	var config Config
+
+	explicit := path != ""
+	if !explicit {
+		dir := getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			home := getenv("HOME")
+			if home == "" {
+				return config, nil
+			}
+			dir = filepath.Join(home, ".config")
+		}
+		path = filepath.Join(dir, "fmctl", "config.json")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config %v: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// subject reads the sub claim from a JWT without verifying it; the API does that
+func subject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode token: %v", err)
+	}
+
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Sub == "" {
+		return "", errors.New("token has no sub claim")
+	}
+
+	return claims.Sub, nil
+}
+
+// parseInterleaved parses flags that may come after positional arguments,
+// e.g. download <fileId> -o path, returning the positional arguments
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (c *cli) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const barWidth = 30
+
+// progress draws a single-line bar on stderr as bytes pass through reader
+type progress struct {
+	w     io.Writer
+	label string
+	total int64 // -1 when unknown
+
+	mu       sync.Mutex
+	finished bool
+	n        int64
+	drawn    time.Time
+}
+
+// newProgress returns nil when progress bars are off, so callers can skip wrapping
+func (c *cli) newProgress(label string, total int64) *progress {
+	if !c.progress {
+		return nil
+	}
+
+	return &progress{w: c.stderr, label: label, total: total}
+}
+
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.add(int64(n))
+	return n, err
+}
+
+// Seek lets the client rewind a retried upload; the bar starts over with it
+func (pr *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := pr.r.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("not seekable")
+	}
+
+	pos, err := seeker.Seek(offset, whence)
+	if err == nil {
+		pr.p.mu.Lock()
+		pr.p.n = pos
+		pr.p.mu.Unlock()
+	}
+	return pos, err
+}
+
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.n += n
+	// redraw at most ten times a second
+	if now := time.Now(); now.Sub(p.drawn) >= 100*time.Millisecond {
+		p.drawn = now
+		fmt.Fprint(p.w, "\r"+p.line())
+	}
+}
+
+func (p *progress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.finished {
+		return
+	}
+	p.finished = true
+	fmt.Fprint(p.w, "\r"+p.line()+"\n")
+}
+
+func (p *progress) line() string {
+	label := p.label
+	if len(label) > 30 {
+		label = "..." + label[len(label)-27:]
+	}
+
+	if p.total <= 0 {
+		return fmt.Sprintf("%-30s %v", label, formatBytes(p.n))
+	}
+
+	filled := int(p.n * barWidth / p.total)
+	if filled > barWidth {
+		filled = barWidth
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+
+	return fmt.Sprintf("%-30s [%s] %3d%% %v/%v", label, bar, p.n*100/p.total, formatBytes(p.n), formatBytes(p.total))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
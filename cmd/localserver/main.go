@@ -0,0 +1,115 @@
+// Command localserver runs every API handler behind a net/http server with the same
+// routes as serverless.yml, so the API can be exercised with curl without deploying.
+//
+//	$ JWT_ISSUER=https://cognito-idp.us-west-2.amazonaws.com/<pool> JWT_AUDIENCE=<client> \
+//	      go run ./cmd/localserver -addr :8080
+//	$ curl -H "Authorization: Bearer $TOKEN" localhost:8080/<sub>
+//
+// Without Cognito, -dev-user skips token verification and treats every request as that user.
+// With STORAGE_BACKEND=local, file contents are kept in LOCAL_STORAGE_DIR and the signed
+// upload/download URLs the API returns point back at this server under /_storage/.
+// Webhook deliveries are made from this process rather than through SQS. Stored uploads are
+// scanned by the clamd at CLAMD_ADDRESS, or without it by a fake that only detects EICAR.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/download_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/object_created"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/overwrite_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/upload_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/router"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/scan"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	stage := flag.String("stage", "local", "stage reported in the request context")
+	devUser := flag.String("dev-user", "", "skip JWT verification and act as this sub")
+	devGroups := flag.String("dev-groups", "", "comma separated Cognito groups for -dev-user")
+	flag.Parse()
+
+	// buckets live in this process instead of the ratelimits table
+	limiter := ratelimit.NewMemoryLimiter(ratelimit.ConfigFromEnv())
+	upload_file.Limiter = limiter
+	download_file.Limiter = limiter
+	overwrite_file.Limiter = limiter
+
+	// deliveries are made from this process, to endpoints that are usually on this machine too
+	webhooks.DefaultQueue = webhooks.NewLocalQueue()
+	webhooks.AllowHTTP = true
+
+	if os.Getenv("CLAMD_ADDRESS") == "" {
+		scan.DefaultScanner = scan.Fake{}
+	}
+
+	handler := &router.HTTPHandler{
+		Routes: router.Routes(),
+		Stage:  *stage,
+	}
+
+	if *devUser != "" {
+		principal := &auth.Principal{Subject: *devUser, Username: *devUser}
+		if *devGroups != "" {
+			principal.Groups = strings.Split(*devGroups, ",")
+		}
+		log.Printf("WARNING: JWT verification disabled, all requests act as %v %v", principal.Subject, principal.Groups)
+
+		handler.Wrap = func(next router.HandlerFunc) router.HandlerFunc {
+			return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return next(auth.NewContext(ctx, principal), request)
+			}
+		}
+	} else {
+		verifier, err := auth.NewVerifierFromEnv()
+		if err != nil {
+			log.Fatalf("configure JWT verification or pass -dev-user: %v", err)
+		}
+
+		handler.Wrap = func(next router.HandlerFunc) router.HandlerFunc {
+			return router.HandlerFunc(verifier.Middleware(auth.HandlerFunc(next)))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	if os.Getenv("STORAGE_BACKEND") == "local" && os.Getenv("LOCAL_STORAGE_URL") == "" {
+		os.Setenv("LOCAL_STORAGE_URL", localURL(*addr)+strings.TrimSuffix(storage.LocalPathPrefix, "/"))
+	}
+	if local, ok := storage.Default().(*storage.Local); ok {
+		mux.Handle(storage.LocalPathPrefix, object_created.Notifying(local))
+		log.Printf("storing files in %v, served at %v", local.Dir, local.BaseURL)
+	}
+
+	for _, route := range handler.Routes {
+		log.Printf("%-8v %v", route.Method, route.Path)
+	}
+	log.Printf("listening on %v", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// localURL turns a listen address like :8080 into a URL clients can reach it at
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,84 @@
+// Package contenttype works out what an upload really is and whether the stage accepts it.
+// Handlers refuse names the Policy does not allow before signing an upload URL; once the
+// content is stored, File sniffs its first bytes, records the detected type on the file's
+// item and, when the Policy refuses that type, rejects the file and deletes the content.
+package contenttype
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// File detects and records the type of fileName's stored content. If DefaultPolicy refuses
+// the type or the name, the file is marked rejected, its content is deleted and the *Error
+// is returned. It returns aws_usages.ErrFileNotFound for a file deleted in the meantime.
+func File(ctx context.Context, fileID string, fileName string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "contenttype.File")
+	defer span.End()
+	span.SetAttributes(attribute.String("app.file_id", fileID))
+
+	contentType, err := checkFile(ctx, fileID, fileName)
+	span.SetAttributes(attribute.String("app.content_type", contentType))
+	var refused *Error
+	if err != nil && !errors.As(err, &refused) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return contentType, err
+}
+
+func checkFile(ctx context.Context, fileID string, fileName string) (string, error) {
+	content, err := storage.Default().Open(ctx, fileID)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return "", fmt.Errorf("%w: no content to detect", aws_usages.ErrFileNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(content, head)
+	content.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read content: %v", err)
+	}
+
+	contentType := Detect(head[:n], fileName)
+	if err := aws_usages.SetContentTypeDynamoDB(ctx, "dev-files", fileID, contentType); err != nil {
+		return contentType, err
+	}
+
+	// the name was checked when the upload was signed, but the policy may have changed since
+	refused := DefaultPolicy.CheckType(contentType)
+	if refused == nil {
+		refused = DefaultPolicy.CheckName(fileName)
+	}
+	if refused == nil {
+		return contentType, nil
+	}
+
+	logging.FromContext(ctx).Warn("rejected file", "fileId", fileID, "contentType", contentType, "reason", refused.Error())
+	metrics.FromContext(ctx).Put("FilesRejected", 1, metrics.Count)
+
+	rejected := time.Now().UTC().Format(time.RFC3339)
+	if err := aws_usages.SetScanStatusDynamoDB(ctx, "dev-files", fileID, aws_usages.ScanStatusRejected, refused.Error(), rejected); err != nil {
+		return contentType, err
+	}
+	if err := storage.Default().Remove(ctx, fileID); err != nil {
+		// the file is not served while rejected, so the content can wait for its delete
+		logging.FromContext(ctx).Error("failed to remove rejected content", "fileId", fileID, "error", err)
+	}
+
+	return contentType, refused
+}
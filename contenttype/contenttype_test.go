@@ -0,0 +1,118 @@
+package contenttype
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	var pngImage bytes.Buffer
+	png.Encode(&pngImage, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	tar := make([]byte, 512)
+	copy(tar, "notes.txt")
+	copy(tar[257:], "ustar\x0000")
+
+	tests := []struct {
+		name     string
+		head     []byte
+		fileName string
+		want     string
+	}{
+		{"png", pngImage.Bytes(), "photo.png", "image/png"},
+		{"png whatever its name", pngImage.Bytes(), "photo.txt", "image/png"},
+		{"pdf", []byte("%PDF-1.7\n"), "report.pdf", "application/pdf"},
+		{"text", []byte("hello world"), "notes.txt", "text/plain"},
+		{"csv", []byte("a,b\n1,2\n"), "data.CSV", "text/csv"},
+		{"html named as text", []byte("<html><script>x</script>"), "notes.txt", "text/html"},
+		{"windows executable", []byte("MZ\x90\x00\x03"), "photo.jpg", "application/vnd.microsoft.portable-executable"},
+		{"elf", []byte("\x7fELF\x02\x01\x01"), "tool", "application/x-elf"},
+		{"mach-o", []byte("\xcf\xfa\xed\xfe\x07"), "tool", "application/x-mach-binary"},
+		{"script", []byte("#!/bin/sh\nrm -rf /\n"), "notes.txt", "text/x-shellscript"},
+		{"tar", tar, "backup", "application/x-tar"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "IMG_0001.HEIC", "image/heic"},
+		{"zip", []byte("PK\x03\x04\x14\x00"), "archive.zip", "application/zip"},
+		{"docx", []byte("PK\x03\x04\x14\x00"), "letter.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"text is not refined into a zip format", []byte("hello"), "letter.docx", "text/plain"},
+		{"unknown binary", []byte{0x00, 0x01, 0x02, 0x03}, "blob.bin", "application/octet-stream"},
+		{"empty", nil, "empty.txt", "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.head, tt.fileName); got != tt.want {
+			t.Errorf("%v: Detect = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := map[string]string{
+		"a.txt":             "txt",
+		"photos/2021/A.JPG": "jpg",
+		"setup.exe.":        "exe",
+		"archive.tar.gz":    "gz",
+		"README":            "",
+		"folder.d/README":   "",
+	}
+	for name, want := range tests {
+		if got := Extension(name); got != want {
+			t.Errorf("Extension(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	deny := Policy{
+		DenyTypes:      []string{"application/vnd.microsoft.portable-executable", "text/x-*"},
+		DenyExtensions: []string{"exe", "bat"},
+	}
+	allow := Policy{
+		AllowTypes:      []string{"image/*", "application/pdf"},
+		AllowExtensions: []string{"jpg", "png", "pdf"},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		file   string
+		typ    string
+		nameOK bool
+		typeOK bool
+	}{
+		{"nothing configured", Policy{}, "setup.exe", "application/x-elf", true, true},
+		{"denied extension", deny, "setup.EXE", "text/plain", false, true},
+		{"denied extension with a trailing dot", deny, "run.bat.", "text/plain", false, true},
+		{"denied type", deny, "photo.jpg", "application/vnd.microsoft.portable-executable", true, false},
+		{"denied type family", deny, "notes.txt", "text/x-shellscript", true, false},
+		{"not denied", deny, "photo.jpg", "image/jpeg", true, true},
+		{"allowed", allow, "scan.pdf", "application/pdf", true, true},
+		{"allowed type family", allow, "photo.png", "image/png", true, true},
+		{"not allowed", allow, "notes.txt", "text/plain", false, false},
+		{"no extension with an allow list", allow, "README", "image/png", false, true},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.CheckName(tt.file); (err == nil) != tt.nameOK {
+			t.Errorf("%v: CheckName(%q) = %v", tt.name, tt.file, err)
+		}
+		if err := tt.policy.CheckType(tt.typ); (err == nil) != tt.typeOK {
+			t.Errorf("%v: CheckType(%q) = %v", tt.name, tt.typ, err)
+		}
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	os.Setenv("UPLOAD_DENIED_EXTENSIONS", " .EXE, bat ,,")
+	os.Setenv("UPLOAD_ALLOWED_TYPES", "image/*")
+	defer os.Unsetenv("UPLOAD_DENIED_EXTENSIONS")
+	defer os.Unsetenv("UPLOAD_ALLOWED_TYPES")
+
+	p := PolicyFromEnv()
+	if len(p.DenyExtensions) != 2 || p.DenyExtensions[0] != "exe" || p.DenyExtensions[1] != "bat" {
+		t.Errorf("DenyExtensions = %q", p.DenyExtensions)
+	}
+	if len(p.AllowTypes) != 1 || p.AllowTypes[0] != "image/*" || p.DenyTypes != nil || p.AllowExtensions != nil {
+		t.Errorf("policy = %+v", p)
+	}
+}
@@ -0,0 +1,100 @@
+package contenttype
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SniffLen is how much of the content Detect looks at
+const SniffLen = 512
+
+type signature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+// signatures are formats http.DetectContentType reports as application/octet-stream or
+// text/plain, executables above all, since those are what a policy most wants to refuse
+var signatures = []signature{
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("\x7fELF"), "application/x-elf"},
+	{0, []byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{0, []byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{0, []byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("#!"), "text/x-shellscript"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftypavif"), "image/avif"},
+}
+
+// refinements are the types a name's extension may narrow a sniffed container or text type
+// to: a .docx is a ZIP and a .csv is plain text to the sniffer
+var refinements = map[string]map[string]string{
+	"application/zip": {
+		"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"odt":  "application/vnd.oasis.opendocument.text",
+		"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+		"odp":  "application/vnd.oasis.opendocument.presentation",
+		"epub": "application/epub+zip",
+		"jar":  "application/java-archive",
+		"apk":  "application/vnd.android.package-archive",
+	},
+	"text/plain": {
+		"csv":  "text/csv",
+		"tsv":  "text/tab-separated-values",
+		"md":   "text/markdown",
+		"json": "application/json",
+		"yaml": "application/yaml",
+		"yml":  "application/yaml",
+		"js":   "text/javascript",
+		"mjs":  "text/javascript",
+		"css":  "text/css",
+		"sh":   "text/x-shellscript",
+	},
+}
+
+// Detect returns the media type of content starting with head, without parameters. The
+// magic numbers in signatures are tried first, then http.DetectContentType; a ZIP or plain
+// text is narrowed by fileName's extension when it names a format of that kind.
+func Detect(head []byte, fileName string) string {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.contentType
+		}
+	}
+
+	detected := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		detected = mediaType
+	}
+
+	if refined, found := refinements[detected][Extension(fileName)]; found {
+		return refined
+	}
+
+	return detected
+}
+
+// Extension is fileName's extension, lower case and without the dot. Trailing dots are
+// ignored, as Windows ignores them, so "setup.exe." has the extension exe.
+func Extension(fileName string) string {
+	base := strings.TrimRight(path.Base(fileName), ".")
+	return strings.ToLower(strings.TrimPrefix(path.Ext(base), "."))
+}
@@ -0,0 +1,103 @@
+package contenttype
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Policy decides which content a stage accepts. Entries in a deny list are always refused;
+// when an allow list is not empty, only what it names is accepted. Types ending in * match
+// by prefix, e.g. image/* every image; extensions are given without the dot.
+type Policy struct {
+	AllowTypes      []string
+	DenyTypes       []string
+	AllowExtensions []string
+	DenyExtensions  []string
+}
+
+// Error explains why the policy refused a file
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+// DefaultPolicy is the stage's policy from the environment; tests swap it out
+var DefaultPolicy = PolicyFromEnv()
+
+// PolicyFromEnv reads the comma-separated UPLOAD_ALLOWED_TYPES, UPLOAD_DENIED_TYPES,
+// UPLOAD_ALLOWED_EXTENSIONS and UPLOAD_DENIED_EXTENSIONS. Unset, everything is accepted.
+func PolicyFromEnv() Policy {
+	return Policy{
+		AllowTypes:      envList("UPLOAD_ALLOWED_TYPES"),
+		DenyTypes:       envList("UPLOAD_DENIED_TYPES"),
+		AllowExtensions: envList("UPLOAD_ALLOWED_EXTENSIONS"),
+		DenyExtensions:  envList("UPLOAD_DENIED_EXTENSIONS"),
+	}
+}
+
+func envList(name string) []string {
+	var list []string
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			list = append(list, strings.TrimPrefix(entry, "."))
+		}
+	}
+
+	return list
+}
+
+// CheckName checks fileName's extension, returning an *Error if it is refused
+func (p Policy) CheckName(fileName string) error {
+	ext := Extension(fileName)
+
+	for _, denied := range p.DenyExtensions {
+		if ext == denied {
+			return &Error{fmt.Sprintf("files with the extension .%v are not allowed", ext)}
+		}
+	}
+	if len(p.AllowExtensions) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowExtensions {
+		if ext == allowed {
+			return nil
+		}
+	}
+
+	if ext == "" {
+		return &Error{"files without an extension are not allowed"}
+	}
+	return &Error{fmt.Sprintf("files with the extension .%v are not allowed", ext)}
+}
+
+// CheckType checks a detected content type, returning an *Error if it is refused
+func (p Policy) CheckType(contentType string) error {
+	for _, denied := range p.DenyTypes {
+		if matchType(denied, contentType) {
+			return &Error{fmt.Sprintf("content of type %v is not allowed", contentType)}
+		}
+	}
+	if len(p.AllowTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowTypes {
+		if matchType(allowed, contentType) {
+			return nil
+		}
+	}
+
+	return &Error{fmt.Sprintf("content of type %v is not allowed", contentType)}
+}
+
+func matchType(pattern string, contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+		return strings.HasPrefix(contentType, prefix)
+	}
+
+	return pattern == contentType
+}
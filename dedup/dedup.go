@@ -0,0 +1,221 @@
+// Package dedup stores each user's identical uploads once. An upload may declare the SHA-256
+// of its content: if the owner already has a blob of that digest, upload_file points the new
+// file at it instead of signing an upload URL. Otherwise, once the content is stored, Verify
+// checks it against the digest and, after it scans clean, Register moves it into a blob other
+// uploads can share. Blobs count the files pointing at them, and Release deletes one when its
+// last file goes. Blobs are never shared between users, so a digest reveals nothing about
+// anyone else's files.
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ErrMismatch is returned by Verify for content whose digest is not the one declared
+var ErrMismatch = errors.New("content does not match the declared SHA-256")
+
+// ValidSHA256 reports whether s is a digest as uploads declare it: 64 lowercase hex digits
+func ValidSHA256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewKey names the storage object of a new blob. The prefix keeps blob keys apart from
+// FileIDs, so the object-created trigger never mistakes a blob for a file.
+func NewKey() string {
+	return "blob_" + strings.Replace(uuid.New().String(), "-", "", -1)
+}
+
+// Verify hashes the stored content of fileID and, if it does not match the declared digest,
+// marks the file rejected, deletes the content and returns ErrMismatch. Nothing is shared
+// under a digest its content was not checked against.
+func Verify(ctx context.Context, fileID string, digest string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "dedup.Verify")
+	defer span.End()
+	span.SetAttributes(attribute.String("app.file_id", fileID))
+
+	err := verify(ctx, fileID, digest)
+	if err != nil && err != ErrMismatch {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Bool("app.sha256_match", err == nil))
+
+	return err
+}
+
+func verify(ctx context.Context, fileID string, digest string) error {
+	content, err := storage.Default().Open(ctx, fileID)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return fmt.Errorf("%w: no content to verify", aws_usages.ErrFileNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, content)
+	content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read content: %v", err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) == digest {
+		return nil
+	}
+
+	logging.FromContext(ctx).Warn("rejected file", "fileId", fileID, "reason", ErrMismatch.Error())
+	metrics.FromContext(ctx).Put("FilesRejected", 1, metrics.Count)
+
+	rejected := time.Now().UTC().Format(time.RFC3339)
+	if err := aws_usages.SetScanStatusDynamoDB(ctx, "dev-files", fileID, aws_usages.ScanStatusRejected, ErrMismatch.Error(), rejected); err != nil {
+		return err
+	}
+	if err := storage.Default().Remove(ctx, fileID); err != nil {
+		logging.FromContext(ctx).Error("failed to remove rejected content", "fileId", fileID, "error", err)
+	}
+
+	return ErrMismatch
+}
+
+// Register makes the verified, clean content of fileID a blob of its declared digest, or
+// points the file at the owner's existing blob if another upload got there first, then
+// deletes the file's own copy. Files without a declared digest, already pointing at a blob or
+// not clean are left alone. It returns aws_usages.ErrFileNotFound for a file deleted in the
+// meantime.
+func Register(ctx context.Context, fileID string, size int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "dedup.Register")
+	defer span.End()
+	span.SetAttributes(attribute.String("app.file_id", fileID))
+
+	err := register(ctx, fileID, size)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+func register(ctx context.Context, fileID string, size int64) error {
+	item, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if err != nil {
+		return err
+	}
+	if item.SHA256 == "" || item.BlobKey != "" || item.ScanStatus != aws_usages.ScanStatusClean {
+		return nil
+	}
+
+	blob := aws_usages.BlobTableItem{
+		UserID:      item.UserID,
+		SHA256:      item.SHA256,
+		Key:         NewKey(),
+		Size:        size,
+		ScanStatus:  item.ScanStatus,
+		Scanned:     item.Scanned,
+		ContentType: item.ContentType,
+		Thumbnails:  item.Thumbnails,
+		Created:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := copyContent(ctx, fileID, blob.Key, item.Thumbnails); err != nil {
+		removeContent(ctx, blob.Key)
+		return err
+	}
+
+	err = aws_usages.RegisterBlobDynamoDB(ctx, "dev-files", "dev-blobs", fileID, blob)
+	if err == aws_usages.ErrBlobExists {
+		removeContent(ctx, blob.Key)
+		err = attach(ctx, *item)
+	}
+	if err == aws_usages.ErrBlobNotFound {
+		// the existing blob lost its last file while we attached; keep the file's own copy
+		logging.FromContext(ctx).Info("blob deleted before attaching, file keeps its content", "fileId", fileID)
+		return nil
+	}
+	if err != nil {
+		if err != aws_usages.ErrFileNotFound {
+			removeContent(ctx, blob.Key)
+		}
+		return err
+	}
+
+	removeContent(ctx, fileID)
+	return nil
+}
+
+// attach points the file at the blob another upload of the same content registered
+func attach(ctx context.Context, item aws_usages.FileTableItem) error {
+	blob, err := aws_usages.GetBlobDynamoDB(ctx, "dev-blobs", item.UserID, item.SHA256)
+	if err != nil {
+		return err
+	}
+
+	if err := aws_usages.AttachBlobDynamoDB(ctx, "dev-files", "dev-blobs", item.FileID, *blob); err != nil {
+		return err
+	}
+	metrics.FromContext(ctx).Put("UploadsDeduplicated", 1, metrics.Count)
+
+	return nil
+}
+
+// Release deletes the owner's blob of a digest once no file points at it, after a file
+// gave up its reference. Failures are logged: a blob left behind is only wasted space.
+func Release(ctx context.Context, userID string, digest string) {
+	blob, err := aws_usages.DeleteBlobDynamoDB(ctx, "dev-blobs", userID, digest)
+	if err == aws_usages.ErrBlobNotFound {
+		// other files still point at it
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete blob", "userId", userID, "sha256", digest, "error", err)
+		return
+	}
+
+	removeContent(ctx, blob.Key)
+	metrics.FromContext(ctx).Put("BlobsDeleted", 1, metrics.Count)
+}
+
+func copyContent(ctx context.Context, src string, dst string, thumbnails []aws_usages.Thumbnail) error {
+	if err := storage.Default().Copy(ctx, src, dst); err != nil {
+		return fmt.Errorf("failed to copy content into blob: %v", err)
+	}
+	for _, t := range thumbnails {
+		if err := storage.Default().Copy(ctx, thumbnail.Key(src, t.Size), thumbnail.Key(dst, t.Size)); err != nil {
+			return fmt.Errorf("failed to copy %v thumbnail into blob: %v", t.Size, err)
+		}
+	}
+
+	return nil
+}
+
+// removeContent deletes the content and thumbnails stored under key, logging failures
+func removeContent(ctx context.Context, key string) {
+	if err := storage.Default().Remove(ctx, key); err != nil {
+		logging.FromContext(ctx).Error("failed to remove content", "key", key, "error", err)
+	}
+	thumbnail.Remove(ctx, key)
+}
@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+)
+
+func TestValidSHA256(t *testing.T) {
+	const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	tests := []struct {
+		digest string
+		valid  bool
+	}{
+		{digest, true},
+		{strings.ToUpper(digest), false},
+		{digest[1:], false},
+		{digest + "0", false},
+		{"g" + digest[1:], false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidSHA256(tt.digest); got != tt.valid {
+			t.Errorf("ValidSHA256(%q) = %v, want %v", tt.digest, got, tt.valid)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key := NewKey()
+	if !regexp.MustCompile(`^blob_[0-9a-f]{32}$`).MatchString(key) {
+		t.Errorf("NewKey() = %q", key)
+	}
+	if thumbnail.IsKey(key) {
+		t.Errorf("%q looks like a thumbnail key", key)
+	}
+	if NewKey() == key {
+		t.Error("NewKey repeated a key")
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/deliver_webhooks"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(deliver_webhooks.Handler)
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/file_stream"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(file_stream.Handler)
+}
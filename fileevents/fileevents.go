@@ -0,0 +1,89 @@
+// Package fileevents turns changes to the files table, read from its DynamoDB Stream, into
+// FileEvents carrying the item before and after the change, and publishes them to a Sink
+// (an SNS topic or an EventBridge bus) for other services to consume without calling the API.
+//
+// Every write to a file item is published, including ones the API makes internally, such as
+// an upload's pending item becoming active. Delivery is at least once and, across files,
+// unordered: consumers should ignore an EventID they have seen and order the changes to one
+// file by SequenceNumber.
+package fileevents
+
+import (
+	"fmt"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Event types, one for each kind of stream record
+const (
+	EventInserted = "file.inserted"
+	EventModified = "file.modified"
+	EventRemoved  = "file.removed"
+)
+
+// FileEvent is one change to a file item. Old is nil for inserts and New for removals.
+type FileEvent struct {
+	EventID        string                    `json:"EventID"` // the stream record's, so the same when redelivered
+	Type           string                    `json:"Type"`
+	Timestamp      string                    `json:"Timestamp"`      // audit.TimestampFormat, to the second
+	SequenceNumber string                    `json:"SequenceNumber"` // a decimal number, ordering changes to a file
+	FileID         string                    `json:"FileID"`
+	UserID         string                    `json:"UserID"`
+	Old            *aws_usages.FileTableItem `json:"Old,omitempty"`
+	New            *aws_usages.FileTableItem `json:"New,omitempty"`
+}
+
+// FromRecord converts a files table stream record, which must carry NEW_AND_OLD_IMAGES
+func FromRecord(record events.DynamoDBEventRecord) (FileEvent, error) {
+	event := FileEvent{
+		EventID:        record.EventID,
+		Timestamp:      record.Change.ApproximateCreationDateTime.UTC().Format(audit.TimestampFormat),
+		SequenceNumber: record.Change.SequenceNumber,
+	}
+
+	switch events.DynamoDBOperationType(record.EventName) {
+	case events.DynamoDBOperationTypeInsert:
+		event.Type = EventInserted
+	case events.DynamoDBOperationTypeModify:
+		event.Type = EventModified
+	case events.DynamoDBOperationTypeRemove:
+		event.Type = EventRemoved
+	default:
+		return event, fmt.Errorf("unknown stream event %q", record.EventName)
+	}
+
+	var err error
+	if event.Old, err = image(record.Change.OldImage); err != nil {
+		return event, fmt.Errorf("old image: %v", err)
+	}
+	if event.New, err = image(record.Change.NewImage); err != nil {
+		return event, fmt.Errorf("new image: %v", err)
+	}
+	if (event.Old == nil && event.Type != EventInserted) || (event.New == nil && event.Type != EventRemoved) {
+		return event, fmt.Errorf("%v record without its images, is the stream NEW_AND_OLD_IMAGES?", record.EventName)
+	}
+
+	current := event.New
+	if current == nil {
+		current = event.Old
+	}
+	event.FileID = current.FileID
+	event.UserID = current.UserID
+
+	return event, nil
+}
+
+func image(attributes map[string]events.DynamoDBAttributeValue) (*aws_usages.FileTableItem, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+
+	var item aws_usages.FileTableItem
+	if err := aws_usages.UnmarshalStreamImage(attributes, &item); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
@@ -0,0 +1,80 @@
+package fileevents
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// a MODIFY record as Lambda delivers it from a NEW_AND_OLD_IMAGES stream
+const modifyRecord = `{
+	"eventID": "c4ca4238a0b923820dcc509a6f75849b",
+	"eventName": "MODIFY",
+	"eventSource": "aws:dynamodb",
+	"awsRegion": "us-west-2",
+	"dynamodb": {
+		"ApproximateCreationDateTime": 1634515200,
+		"Keys": {"FileID": {"S": "f1"}},
+		"OldImage": {"FileID": {"S": "f1"}, "UserID": {"S": "u1"}, "FileName": {"S": "a.txt"}, "Status": {"S": "pending"}, "FileSize": {"N": "10"}},
+		"NewImage": {"FileID": {"S": "f1"}, "UserID": {"S": "u1"}, "FileName": {"S": "b.txt"}, "FileSize": {"N": "10"}, "QuotaCharged": {"BOOL": true}},
+		"SequenceNumber": "111",
+		"SizeBytes": 120,
+		"StreamViewType": "NEW_AND_OLD_IMAGES"
+	}
+}`
+
+func TestFromRecord(t *testing.T) {
+	var record events.DynamoDBEventRecord
+	if err := json.Unmarshal([]byte(modifyRecord), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := FromRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventModified || event.FileID != "f1" || event.UserID != "u1" || event.SequenceNumber != "111" ||
+		event.EventID != record.EventID || event.Timestamp != "2021-10-18T00:00:00.000000000Z" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.Old.FileName != "a.txt" || event.Old.Status != "pending" || event.Old.FileSize != 10 {
+		t.Errorf("old = %+v", event.Old)
+	}
+	if event.New.FileName != "b.txt" || event.New.FileStatus() != "active" || !event.New.QuotaCharged {
+		t.Errorf("new = %+v", event.New)
+	}
+
+	removed := record
+	removed.EventName = "REMOVE"
+	removed.Change.NewImage = nil
+	if event, err := FromRecord(removed); err != nil || event.Type != EventRemoved || event.New != nil || event.FileID != "f1" {
+		t.Errorf("REMOVE: %+v, %v", event, err)
+	}
+
+	keysOnly := record
+	keysOnly.Change.OldImage, keysOnly.Change.NewImage = nil, nil
+	if _, err := FromRecord(keysOnly); err == nil {
+		t.Error("record without images was converted")
+	}
+
+	unknown := record
+	unknown.EventName = "TRUNCATE"
+	if _, err := FromRecord(unknown); err == nil {
+		t.Error("unknown event name was converted")
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	var sink MemorySink
+	sink.Publish(context.Background(), []FileEvent{{EventID: "1"}, {EventID: "2"}})
+	sink.Publish(context.Background(), []FileEvent{{EventID: "3"}})
+
+	if events := sink.Take(); len(events) != 3 || events[2].EventID != "3" {
+		t.Errorf("Take = %+v", events)
+	}
+	if events := sink.Take(); len(events) != 0 {
+		t.Errorf("Take again = %+v", events)
+	}
+}
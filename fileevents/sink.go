@@ -0,0 +1,111 @@
+package fileevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+)
+
+// Source is the EventBridge source of published events
+const Source = "file-management-api.files"
+
+// Sink publishes events in the order given. An error means some may not have been published,
+// and the caller should publish them all again.
+type Sink interface {
+	Publish(ctx context.Context, events []FileEvent) error
+}
+
+// SNSSink publishes each event as a message on an SNS topic, with Type and UserID message
+// attributes for subscription filter policies
+type SNSSink struct {
+	TopicARN string
+}
+
+func (s *SNSSink) Publish(ctx context.Context, events []FileEvent) error {
+	if s.TopicARN == "" {
+		return fmt.Errorf("no file events topic configured, set FILE_EVENTS_TOPIC_ARN")
+	}
+
+	for _, event := range events {
+		js, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal file event: %v", err)
+		}
+
+		attributes := map[string]string{"Type": event.Type, "UserID": event.UserID}
+		if err := aws_usages.PublishSNS(ctx, s.TopicARN, string(js), attributes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EventBridgeSink puts events on an EventBridge bus with Source as their source and Type as
+// their detail-type, for rules to match on
+type EventBridgeSink struct {
+	BusName string
+}
+
+func (s *EventBridgeSink) Publish(ctx context.Context, events []FileEvent) error {
+	entries := make([]aws_usages.EventBridgeEntry, 0, len(events))
+	for _, event := range events {
+		js, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal file event: %v", err)
+		}
+
+		entries = append(entries, aws_usages.EventBridgeEntry{
+			Source:     Source,
+			DetailType: event.Type,
+			Detail:     string(js),
+		})
+	}
+
+	return aws_usages.PutEventsEventBridge(ctx, s.BusName, entries)
+}
+
+// MemorySink keeps published events in memory, for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []FileEvent
+}
+
+func (s *MemorySink) Publish(ctx context.Context, events []FileEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Take returns the events published since the last call
+func (s *MemorySink) Take() []FileEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.events
+	s.events = nil
+	return events
+}
+
+// DefaultSink is where the stream processor publishes; tests swap it out
+var DefaultSink Sink = sinkFromEnv()
+
+// sinkFromEnv publishes to the FILE_EVENTS_TOPIC_ARN topic, or with FILE_EVENTS_SINK=eventbridge
+// to the FILE_EVENTS_BUS bus (the account's default bus when not set)
+func sinkFromEnv() Sink {
+	if os.Getenv("FILE_EVENTS_SINK") == "eventbridge" {
+		bus := os.Getenv("FILE_EVENTS_BUS")
+		if bus == "" {
+			bus = "default"
+		}
+		return &EventBridgeSink{BusName: bus}
+	}
+
+	return &SNSSink{TopicARN: os.Getenv("FILE_EVENTS_TOPIC_ARN")}
+}
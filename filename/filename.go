@@ -0,0 +1,83 @@
+// Package filename validates the names files are stored under. A FileName may contain
+// slashes; everything before the last one is the file's folder, so "photos/2021/a.jpg"
+// is a.jpg in the folder photos/2021 and renaming it to "archive/a.jpg" moves it.
+package filename
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLength caps a whole FileName, folders included, in bytes
+	MaxLength = 1024
+	// MaxSegmentLength caps each folder or file name, as most file systems do
+	MaxSegmentLength = 255
+	// Forbidden are the characters Windows rejects in file names, which downloads would
+	// otherwise trip over; / is allowed as the folder separator
+	Forbidden = `\:*?"<>|`
+)
+
+// Error explains why a FileName was rejected
+type Error struct {
+	Name   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid FileName %q: %v", e.Name, e.Reason)
+}
+
+// Validate checks name's length and characters and that every folder in it is non-empty
+func Validate(name string) error {
+	if name == "" {
+		return &Error{name, "must not be empty"}
+	}
+	if len(name) > MaxLength {
+		return &Error{name, fmt.Sprintf("must be at most %d bytes", MaxLength)}
+	}
+	if !utf8.ValidString(name) {
+		return &Error{name, "must be valid UTF-8"}
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return &Error{name, "must not contain control characters"}
+		}
+		if strings.ContainsRune(Forbidden, r) {
+			return &Error{name, fmt.Sprintf("must not contain any of %v", Forbidden)}
+		}
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		switch {
+		case segment == "":
+			return &Error{name, "must not start or end with /, or contain //"}
+		case segment == "." || segment == "..":
+			return &Error{name, "must not contain . or .. folders"}
+		case len(segment) > MaxSegmentLength:
+			return &Error{name, fmt.Sprintf("each name between slashes must be at most %d bytes", MaxSegmentLength)}
+		case strings.TrimSpace(segment) != segment:
+			return &Error{name, "names must not start or end with spaces"}
+		}
+	}
+
+	return nil
+}
+
+// Folder is the folder part of a valid name, "" for the top level
+func Folder(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+
+	return ""
+}
+
+// Base is the name without its folder
+func Base(name string) string {
+	return path.Base(name)
+}
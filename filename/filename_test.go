@@ -0,0 +1,53 @@
+package filename
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{"a.txt", "photos/2021/a b.jpg", "résumé.pdf", "日本語.txt", ".hidden", strings.Repeat("a", 255)}
+	for _, name := range valid {
+		if err := Validate(name); err != nil {
+			t.Errorf("Validate(%q) = %v", name, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"":                              "empty",
+		"/a.txt":                        "start or end with /",
+		"a/":                            "start or end with /",
+		"a//b":                          "//",
+		"a/../b":                        ". or ..",
+		"./a":                           ". or ..",
+		"a\x00b":                        "control",
+		"a\nb":                          "control",
+		"a:b":                           "must not contain any of",
+		"a\\b":                          "must not contain any of",
+		"what?":                         "must not contain any of",
+		" a.txt":                        "spaces",
+		"dir /a.txt":                    "spaces",
+		strings.Repeat("a", 256):        "at most 255",
+		strings.Repeat("a/", 600) + "a": "at most 1024",
+		"\xff":                          "UTF-8",
+	}
+	for name, want := range invalid {
+		err := Validate(name)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate(%q) = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestFolder(t *testing.T) {
+	tests := map[string][2]string{
+		"a.txt":             {"", "a.txt"},
+		"photos/a.jpg":      {"photos", "a.jpg"},
+		"photos/2021/a.jpg": {"photos/2021", "a.jpg"},
+	}
+	for name, want := range tests {
+		if Folder(name) != want[0] || Base(name) != want[1] {
+			t.Errorf("%q: Folder %q Base %q, want %q %q", name, Folder(name), Base(name), want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package copy_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Copy File Lambda********************/
+// path: /{userId}/{fileId}/copy
+// step 1:
+// - put a new item in dynamoDB for the target user with a new UUID for fileID,
+//   charging its size to the target user's quota
+// step 2:
+// - copy the object and its thumbnails to the new fileID inside the storage backend;
+//   nothing is downloaded
+// return status 200 with the new file, 403 if the caller cannot act as the target user,
+// 409 if the name is taken or the source has no content, 413/429 over quota
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// CopyFileRequest says where the copy goes. Every field is optional: by default the copy
+// stays with the owner, in the source's folder, under the source's name (which is then
+// taken, so a duplicate in place needs a new FileName).
+type CopyFileRequest struct {
+	// TargetUserID owns the copy; copying into another user's space needs Admin
+	TargetUserID string `json:"TargetUserID" openapi:"maxLength=128"`
+	// Folder is the copy's folder, "/" for the top level
+	Folder string `json:"Folder" openapi:"maxLength=filename.MaxLength"`
+	// FileName is the copy's name within Folder
+	FileName string `json:"FileName" openapi:"maxLength=filename.MaxSegmentLength"`
+}
+
+// Limiter throttles copies per caller like uploads; tests swap in a ratelimit.MemoryLimiter
+var Limiter ratelimit.Limiter = ratelimit.NewDynamoDBLimiter("dev-ratelimits", ratelimit.ConfigFromEnv())
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	if retryAfter, limited := ratelimit.Check(ctx, Limiter, principal.Subject); limited {
+		return Response{
+			StatusCode: 429,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Retry-After":                 retryAfter,
+			},
+		}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	var body CopyFileRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	targetUser := body.TargetUserID
+	if targetUser == "" {
+		targetUser = userId
+	}
+	if !principal.CanActAs(targetUser) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	source, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+	if source.UserID != userId || source.FileStatus() == aws_usages.FileStatusTrashed {
+		return Response{StatusCode: 404}, nil
+	}
+	if source.FileStatus() == aws_usages.FileStatusPending {
+		return Response{StatusCode: 409, Body: "the file's upload has not completed"}, nil
+	}
+	// copies are not scanned themselves, so they must be of clean content
+	if source.ScanState() != aws_usages.ScanStatusClean {
+		return Response{StatusCode: 409, Body: fmt.Sprintf("the file is %v, only clean files can be copied", source.ScanState())}, nil
+	}
+
+	fileName := copyName(*source, targetUser, body)
+	if err := filename.Validate(fileName); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err := contenttype.DefaultPolicy.CheckName(fileName); err != nil {
+		return Response{StatusCode: 415, Body: err.Error()}, nil
+	}
+
+	taken, err := aws_usages.FileNameTakenDynamoDB(ctx, "dev-filenames", targetUser, fileName, "")
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+	if taken {
+		return Response(responses.NameTaken(fileName)), nil
+	}
+
+	usage, err := quota.Current(ctx, "dev-quotas", targetUser)
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	if exceeded := quota.Check(*usage, source.FileSize); exceeded != nil {
+		response, err := responses.QuotaExceeded(exceeded)
+		return Response(response), err
+	}
+
+	uuidWithHyphen := uuid.New()
+	copyID := strings.Replace(uuidWithHyphen.String(), "-", "", -1)
+
+	t := time.Now().UTC().Format(time.RFC3339)
+
+	item := aws_usages.FileTableItem{
+		FileID:    copyID,
+		UserID:    targetUser,
+		FirstName: source.FirstName,
+		LastName:  source.LastName,
+		FileName:  fileName,
+		Modified:  t,
+		Uploaded:  t,
+		FileSize:  source.FileSize,
+		Status:    aws_usages.FileStatusActive,
+
+		ScanStatus:  source.ScanStatus,
+		Scanned:     source.Scanned,
+		ContentType: source.ContentType,
+	}
+
+	// a copy within the owner's files shares their blob; blobs are never shared across users
+	shared := source.BlobKey != "" && targetUser == source.UserID
+	if shared {
+		item.SHA256 = source.SHA256
+		item.BlobKey = source.BlobKey
+		item.Thumbnails = source.Thumbnails
+		err = aws_usages.CommitBlobFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-blobs", "dev-filenames", item, usage.MaxBytes, usage.MaxFiles)
+		if err == aws_usages.ErrBlobNotFound {
+			return Response{StatusCode: 409, Body: "the file has no content to copy"}, nil
+		}
+	} else {
+		err = aws_usages.CommitFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-filenames", item, usage.MaxBytes, usage.MaxFiles)
+	}
+	if err == aws_usages.ErrFileNameTaken {
+		// another file took the name between our check and write
+		return Response(responses.NameTaken(fileName)), nil
+	}
+	if err == aws_usages.ErrQuotaExceeded {
+		// another upload for the target user committed between our check and write
+		response, err := responses.QuotaConflict(ctx, targetUser, source.FileSize)
+		return Response(response), err
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("copyFile failed: %v", err)
+	}
+	item.QuotaCharged = true
+
+	// a shared copy's content is already in place
+	if !shared {
+		if err := storage.Default().Copy(ctx, source.ContentKey(), copyID); err != nil {
+			// give the target user their quota back; the record would point at nothing
+			if rollbackErr := aws_usages.DeleteFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-filenames", item); rollbackErr != nil {
+				return Response{StatusCode: 500}, fmt.Errorf("failed to remove copy %v after %v: %v", copyID, err, rollbackErr)
+			}
+			if err == storage.ErrObjectNotFound {
+				return Response{StatusCode: 409, Body: "the file has no content to copy"}, nil
+			}
+			return Response{StatusCode: 500}, fmt.Errorf("failed to copy object %v to %v: %v", fileID, copyID, err)
+		}
+
+		// thumbnails are only a convenience, so the copy goes ahead without them
+		thumbnailsCopied := false
+		if len(source.Thumbnails) > 0 {
+			if err := thumbnail.Copy(ctx, source.ContentKey(), copyID, source.Thumbnails); err != nil {
+				logging.FromContext(ctx).Error("thumbnails not copied", "fileId", copyID, "error", err)
+			} else {
+				thumbnailsCopied = true
+			}
+		}
+
+		// the copy inherits the verdict read before copying, so the source must not have been
+		// overwritten or started a new scan since
+		current, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+		if err != nil && !errors.Is(err, aws_usages.ErrFileNotFound) {
+			return Response{StatusCode: 500}, err
+		}
+		if err != nil || current.ScanState() != aws_usages.ScanStatusClean || current.Modified != source.Modified {
+			if rollbackErr := aws_usages.DeleteFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-filenames", item); rollbackErr != nil {
+				return Response{StatusCode: 500}, fmt.Errorf("failed to remove copy %v of changed file %v: %v", copyID, fileID, rollbackErr)
+			}
+			if err := storage.Default().Remove(ctx, copyID); err != nil {
+				logging.FromContext(ctx).Error("failed to remove copied content", "fileId", copyID, "error", err)
+			}
+			if thumbnailsCopied {
+				thumbnail.Remove(ctx, copyID)
+			}
+			return Response{StatusCode: 409, Body: "the file changed while it was copied, retry"}, nil
+		}
+
+		if thumbnailsCopied {
+			if err := aws_usages.SetThumbnailsDynamoDB(ctx, "dev-files", copyID, source.Thumbnails); err != nil {
+				logging.FromContext(ctx).Error("thumbnails not recorded", "fileId", copyID, "error", err)
+				thumbnail.Remove(ctx, copyID)
+			} else {
+				item.Thumbnails = source.Thumbnails
+			}
+		}
+	}
+
+	metrics.FromContext(ctx).Put("BytesCopied", float64(item.FileSize), metrics.Bytes)
+
+	entry := audit.NewEntry(audit.ActionCopy, principal, request, targetUser, copyID)
+	entry.Details = map[string]string{
+		"SourceUser":   userId,
+		"SourceFileID": fileID,
+		"FileName":     fileName,
+	}
+	audit.Record(ctx, entry)
+
+	// the copy's content is already in place, so it is committed as soon as it is created
+	for _, eventType := range []string{webhooks.EventFileCreated, webhooks.EventFileCommitted} {
+		webhooks.Notify(ctx, webhooks.Event{
+			Type:     eventType,
+			UserID:   targetUser,
+			FileID:   copyID,
+			FileName: item.FileName,
+			FileSize: item.FileSize,
+		})
+	}
+
+	js, err := json.Marshal(item)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal file")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
+
+// copyName is the full name of the copy: the requested or source base name, in the requested
+// folder, or else the source's folder when the copy stays with the owner and the top level otherwise
+func copyName(source aws_usages.FileTableItem, targetUser string, body CopyFileRequest) string {
+	base := body.FileName
+	if base == "" {
+		base = filename.Base(source.FileName)
+	}
+
+	folder := body.Folder
+	if folder == "" && targetUser == source.UserID {
+		folder = filename.Folder(source.FileName)
+	}
+	folder = strings.Trim(folder, "/")
+
+	if folder == "" {
+		return base
+	}
+	return folder + "/" + base
+}
@@ -0,0 +1,142 @@
+package delete_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/dedup"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type DeleteReturn struct {
+	DeleteURL string `json:"DeleteURL"`
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	tableItem, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	if tableItem.UserID != userId {
+		return Response{StatusCode: 404}, nil
+	}
+
+	if tableItem.BlobKey != "" {
+		// the content is shared, so it goes only with the blob's last file
+		err = aws_usages.DeleteBlobFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-blobs", "dev-filenames", *tableItem)
+		if err == aws_usages.ErrFileNotFound {
+			// deleted since we read it
+			return Response{StatusCode: 404}, nil
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+		dedup.Release(ctx, tableItem.UserID, tableItem.SHA256)
+	} else {
+		err = aws_usages.DeleteFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-filenames", *tableItem)
+		if err == aws_usages.ErrFileNotFound {
+			// deleted since we read it
+			return Response{StatusCode: 404}, nil
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+
+		// the client removes the content through the signed URL, but thumbnails are ours
+		if len(tableItem.Thumbnails) > 0 {
+			thumbnail.Remove(ctx, fileID)
+		}
+	}
+
+	entry := audit.NewEntry(audit.ActionDelete, principal, request, userId, fileID)
+	entry.Details = map[string]string{
+		"FileName": tableItem.FileName,
+	}
+	audit.Record(ctx, entry)
+
+	webhooks.Notify(ctx, webhooks.Event{
+		Type:     webhooks.EventFileDeleted,
+		UserID:   userId,
+		FileID:   fileID,
+		FileName: tableItem.FileName,
+		FileSize: tableItem.FileSize,
+	})
+
+	signedUrl, err := storage.Default().DeleteURL(ctx, fileID)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
+	}
+
+	resp := DeleteReturn{
+		DeleteURL: signedUrl,
+	}
+
+	js, err := json.Marshal(resp)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package delete_webhook
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	webhookIdRaw, found := request.PathParameters["webhookId"]
+	var webhookID string
+	if found {
+		value, err := url.QueryUnescape(webhookIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape webhookIdRaw: %v, error: %v", webhookIdRaw, err)
+		}
+
+		webhookID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no webhookId found???")
+	}
+
+	err = webhooks.Delete(ctx, userId, webhookID)
+	if err == webhooks.ErrNotFound {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	return Response{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+	}, nil
+}
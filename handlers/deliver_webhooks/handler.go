@@ -0,0 +1,65 @@
+package deliver_webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+/****************Deliver Webhooks Lambda********************/
+// trigger: the webhook queue
+// Makes one attempt at each queued delivery; the Deliverer queues its own retries, so an
+// error is only returned, and the message offered again by SQS, when that failed.
+
+// Deliverer makes the attempts; tests swap in one with a local queue
+var Deliverer = webhooks.NewDeliverer(nil)
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, event events.SQSEvent) error {
+	defer tracing.Flush(ctx)
+
+	scope := metrics.NewScope(metrics.Dimensions{"Stage": metrics.Stage(), "Route": "deliverWebhooks"})
+	ctx = metrics.NewContext(ctx, scope)
+
+	for _, message := range event.Records {
+		var delivery webhooks.Delivery
+		if err := json.Unmarshal([]byte(message.Body), &delivery); err != nil {
+			// it would fail the same way every time it was offered
+			logging.FromContext(ctx).Error("dropping malformed delivery", "messageId", message.MessageId, "error", err)
+			continue
+		}
+
+		if err := deliver(ctx, delivery); err != nil {
+			return fmt.Errorf("delivery %v: %v", delivery.DeliveryID, err)
+		}
+	}
+
+	return nil
+}
+
+func deliver(ctx context.Context, delivery webhooks.Delivery) error {
+	ctx, span := tracing.Tracer().Start(ctx, "webhooks.Deliver")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("app.webhook_id", delivery.WebhookID),
+		attribute.String("app.delivery_id", delivery.DeliveryID),
+		attribute.String("app.event_type", delivery.EventType),
+		attribute.Int("app.attempt", delivery.Attempt),
+	)
+
+	err := Deliverer.Deliver(ctx, delivery)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,174 @@
+package download_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type DownloadReturn struct {
+	DownloadURL string `json:"DownloadURL"`
+}
+
+// DownloadOptions choose how the browser treats the download: ?disposition=attachment (the
+// default) saves it under the file's name, ?disposition=inline displays it when its type is
+// previewable and otherwise still saves it
+type DownloadOptions struct {
+	Disposition string `query:"disposition"`
+}
+
+func parseOptions(query map[string]string) (DownloadOptions, error) {
+	opts := DownloadOptions{
+		Disposition: query["disposition"],
+	}
+
+	switch opts.Disposition {
+	case "", "attachment", "inline":
+		return opts, nil
+	}
+
+	return opts, fmt.Errorf("invalid disposition: %v, must be attachment or inline", opts.Disposition)
+}
+
+// Limiter throttles URL signing per caller; tests swap in a ratelimit.MemoryLimiter
+var Limiter ratelimit.Limiter = ratelimit.NewDynamoDBLimiter("dev-ratelimits", ratelimit.ConfigFromEnv())
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	if retryAfter, limited := ratelimit.Check(ctx, Limiter, principal.Subject); limited {
+		return Response{
+			StatusCode: 429,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Retry-After":                 retryAfter,
+			},
+		}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	tableItem, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	if tableItem.UserID != userId {
+		return Response{StatusCode: 404}, nil
+	}
+
+	// only content the virus scan passed is served
+	switch tableItem.ScanState() {
+	case aws_usages.ScanStatusClean:
+	case aws_usages.ScanStatusQuarantined:
+		return Response{StatusCode: 409, Body: "the file is quarantined: " + tableItem.ScanSignature}, nil
+	case aws_usages.ScanStatusRejected:
+		return Response{StatusCode: 409, Body: "the file's content was rejected: " + tableItem.ScanSignature}, nil
+	case aws_usages.ScanStatusTooLarge:
+		return Response{StatusCode: 409, Body: "the file is too large to be scanned for viruses"}, nil
+	case aws_usages.ScanStatusScanning:
+		return Response{
+			StatusCode: 409,
+			Headers:    map[string]string{"Retry-After": "10"},
+			Body:       "the file is being scanned for viruses",
+		}, nil
+	default:
+		return Response{StatusCode: 409, Body: "the file has not been scanned for viruses"}, nil
+	}
+
+	// a name that disagrees with the sniffed content, e.g. HTML called photo.png, is not
+	// trusted to pick an inline type
+	inline := opts.Disposition == "inline"
+	if tableItem.ContentType != "" && tableItem.ContentType != storage.ContentType(tableItem.FileName) {
+		inline = false
+	}
+
+	// objects are stored under the bare FileID or a shared blob's key, so the name comes from
+	// the signed URL
+	downloadOpts := storage.AttachmentOptions(tableItem.FileName, inline)
+	signedUrl, err := storage.Default().DownloadURL(ctx, tableItem.ContentKey(), downloadOpts)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
+	}
+
+	entry := audit.NewEntry(audit.ActionDownload, principal, request, userId, fileID)
+	entry.Details = map[string]string{
+		"FileName":    tableItem.FileName,
+		"Disposition": strings.SplitN(downloadOpts.ContentDisposition, ";", 2)[0],
+	}
+	audit.Record(ctx, entry)
+
+	dr := DownloadReturn{
+		DownloadURL: signedUrl,
+	}
+
+	js, err := json.Marshal(dr)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
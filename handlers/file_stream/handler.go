@@ -0,0 +1,63 @@
+package file_stream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/fileevents"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+/****************File Stream Lambda********************/
+// trigger: the dev-files table's DynamoDB Stream (NEW_AND_OLD_IMAGES)
+// Publishes each change to a file item as a fileevents.FileEvent. An error has Lambda retry
+// the whole batch, so events already published are published again.
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, event events.DynamoDBEvent) error {
+	defer tracing.Flush(ctx)
+
+	scope := metrics.NewScope(metrics.Dimensions{"Stage": metrics.Stage(), "Route": "fileStream"})
+	ctx = metrics.NewContext(ctx, scope)
+
+	var fileEvents []fileevents.FileEvent
+	for _, record := range event.Records {
+		fileEvent, err := fileevents.FromRecord(record)
+		if err != nil {
+			// it would fail the same way every time it was offered
+			logging.FromContext(ctx).Error("dropping stream record", "eventId", record.EventID, "error", err)
+			continue
+		}
+		fileEvents = append(fileEvents, fileEvent)
+	}
+
+	if len(fileEvents) == 0 {
+		return nil
+	}
+
+	if err := publish(ctx, fileEvents); err != nil {
+		return fmt.Errorf("publishing %d file events: %v", len(fileEvents), err)
+	}
+	scope.Put("FileEventsPublished", float64(len(fileEvents)), metrics.Count)
+
+	return nil
+}
+
+func publish(ctx context.Context, fileEvents []fileevents.FileEvent) error {
+	ctx, span := tracing.Tracer().Start(ctx, "fileevents.Publish")
+	defer span.End()
+	span.SetAttributes(attribute.Int("app.events", len(fileEvents)))
+
+	err := fileevents.DefaultSink.Publish(ctx, fileEvents)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,174 @@
+package get_thumbnail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Get Thumbnail Lambda********************/
+// path: /{userId}/{fileId}/thumbnail
+// Returns a URL to download one of the file's thumbnails from. They are rendered after the
+// file's content passes its virus scan, and only for images, so other files get a 404.
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type ThumbnailReturn struct {
+	ThumbnailURL string `json:"ThumbnailURL"`
+	Size         string `json:"Size"`
+	Width        int    `json:"Width"`
+	Height       int    `json:"Height"`
+	ContentType  string `json:"ContentType"`
+}
+
+// ThumbnailOptions choose the rendition: ?size=small, medium (the default) or large
+type ThumbnailOptions struct {
+	Size string `query:"size"`
+}
+
+func parseOptions(query map[string]string) (ThumbnailOptions, error) {
+	opts := ThumbnailOptions{
+		Size: query["size"],
+	}
+	if opts.Size == "" {
+		opts.Size = thumbnail.DefaultSize
+	}
+
+	if _, found := thumbnail.Lookup(opts.Size); !found {
+		names := make([]string, 0, len(thumbnail.Sizes))
+		for _, size := range thumbnail.Sizes {
+			names = append(names, size.Name)
+		}
+		return opts, fmt.Errorf("invalid size: %v, must be one of %v", opts.Size, strings.Join(names, ", "))
+	}
+
+	return opts, nil
+}
+
+// Limiter throttles URL signing per caller; tests swap in a ratelimit.MemoryLimiter
+var Limiter ratelimit.Limiter = ratelimit.NewDynamoDBLimiter("dev-ratelimits", ratelimit.ConfigFromEnv())
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	if retryAfter, limited := ratelimit.Check(ctx, Limiter, principal.Subject); limited {
+		return Response{
+			StatusCode: 429,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Retry-After":                 retryAfter,
+			},
+		}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	tableItem, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	if tableItem.UserID != userId {
+		return Response{StatusCode: 404}, nil
+	}
+
+	// thumbnails are cleared when a scan quarantines the content, but an overwrite still
+	// being scanned has not been judged yet
+	if tableItem.ScanState() != aws_usages.ScanStatusClean {
+		return Response{StatusCode: 409, Body: "the file's content has not passed its virus scan"}, nil
+	}
+
+	var rendition *aws_usages.Thumbnail
+	for i := range tableItem.Thumbnails {
+		if tableItem.Thumbnails[i].Size == opts.Size {
+			rendition = &tableItem.Thumbnails[i]
+			break
+		}
+	}
+	if rendition == nil {
+		return Response{StatusCode: 404, Body: "the file has no " + opts.Size + " thumbnail"}, nil
+	}
+
+	signedUrl, err := storage.Default().DownloadURL(ctx, thumbnail.Key(tableItem.ContentKey(), opts.Size), storage.DownloadOptions{
+		ContentType: rendition.ContentType,
+	})
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
+	}
+
+	tr := ThumbnailReturn{
+		ThumbnailURL: signedUrl,
+		Size:         rendition.Size,
+		Width:        rendition.Width,
+		Height:       rendition.Height,
+		ContentType:  rendition.ContentType,
+	}
+
+	js, err := json.Marshal(tr)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal thumbnail")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
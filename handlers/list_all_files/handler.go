@@ -0,0 +1,135 @@
+package list_all_files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// MaxPageSize caps the limit query option
+const MaxPageSize = 1000
+
+// ListAllFilesOptions are the admin-only query string options for this endpoint
+// ?userId=<id>&includeTrashed=true&includePending=true&limit=<n>&nextToken=<token>
+// limit and nextToken page through the table as on GET /{userId}.
+type ListAllFilesOptions struct {
+	UserID         string `query:"userId"`
+	IncludeTrashed bool   `query:"includeTrashed"`
+	IncludePending bool   `query:"includePending"`
+	Limit          int64  `query:"limit"`
+	NextToken      string `query:"nextToken"`
+}
+
+func parseOptions(query map[string]string) (ListAllFilesOptions, error) {
+	opts := ListAllFilesOptions{
+		UserID:    query["userId"],
+		NextToken: query["nextToken"],
+	}
+
+	var err error
+	if raw, found := query["includeTrashed"]; found {
+		if opts.IncludeTrashed, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("invalid includeTrashed: %v", raw)
+		}
+	}
+	if raw, found := query["includePending"]; found {
+		if opts.IncludePending, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("invalid includePending: %v", raw)
+		}
+	}
+	if raw, found := query["limit"]; found {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return opts, fmt.Errorf("invalid limit: %v, must be 1 to %v", raw, MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
+
+func (opts ListAllFilesOptions) includes(item aws_usages.FileTableItem) bool {
+	switch item.FileStatus() {
+	case aws_usages.FileStatusTrashed:
+		return opts.IncludeTrashed
+	case aws_usages.FileStatusPending:
+		return opts.IncludePending
+	}
+
+	return true
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.IsAdmin() {
+		return Response{StatusCode: 403}, nil
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+
+	var tableItems *[]aws_usages.FileTableItem
+	if opts.Limit > 0 || opts.NextToken != "" {
+		page, next, err := aws_usages.ListFilesPageDynamoDB(ctx, "dev-files", opts.UserID, opts.Limit, opts.NextToken)
+		if err == aws_usages.ErrInvalidPageToken {
+			return Response{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+
+		tableItems = &page
+		if next != "" {
+			headers["X-Next-Token"] = next
+			headers["Access-Control-Expose-Headers"] = "X-Next-Token"
+		}
+	} else {
+		if opts.UserID != "" {
+			tableItems, err = aws_usages.ListFilesDynamoDB(ctx, "dev-files", opts.UserID)
+		} else {
+			tableItems, err = aws_usages.ListAllFilesDynamoDB(ctx, "dev-files")
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+	}
+
+	files := []aws_usages.FileTableItem{}
+	for _, item := range *tableItems {
+		if opts.includes(item) {
+			files = append(files, item)
+		}
+	}
+
+	js, err := json.Marshal(responses.Files(files))
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers:         headers,
+		Body:            string(js),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package list_files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// MaxPageSize caps the limit query option
+const MaxPageSize = 1000
+
+// ListFilesOptions page through a user's files: ?limit=<n>&nextToken=<token>.
+// Without either the whole list is returned. When more pages remain the response carries
+// the token for the next one in the X-Next-Token header; a page may be short, or empty.
+type ListFilesOptions struct {
+	Limit     int64  `query:"limit"`
+	NextToken string `query:"nextToken"`
+}
+
+func (opts ListFilesOptions) paged() bool {
+	return opts.Limit > 0 || opts.NextToken != ""
+}
+
+func parseOptions(query map[string]string) (ListFilesOptions, error) {
+	opts := ListFilesOptions{
+		NextToken: query["nextToken"],
+	}
+
+	if raw, found := query["limit"]; found {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return opts, fmt.Errorf("invalid limit: %v, must be 1 to %v", raw, MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+
+	var tableItems []aws_usages.FileTableItem
+	if opts.paged() {
+		page, next, err := aws_usages.ListFilesPageDynamoDB(ctx, "dev-files", userId, opts.Limit, opts.NextToken)
+		if err == aws_usages.ErrInvalidPageToken {
+			return Response{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+
+		tableItems = page
+		if next != "" {
+			headers["X-Next-Token"] = next
+			headers["Access-Control-Expose-Headers"] = "X-Next-Token"
+		}
+	} else {
+		all, err := aws_usages.ListFilesDynamoDB(ctx, "dev-files", userId)
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+		tableItems = *all
+	}
+
+	js, err := json.Marshal(responses.Files(tableItems))
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers:         headers,
+		Body:            string(js),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package list_webhook_deliveries
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************List Webhook Deliveries Lambda********************/
+// path: /{userId}/webhooks/{webhookId}/deliveries
+// Returns the webhook's delivery attempts, newest first, with each one's outcome, the
+// endpoint's status code or error, and when it will be retried. Attempts are kept for
+// webhooks.HistoryTTL.
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// MaxPageSize caps the limit query option, which also applies when it is not given
+const MaxPageSize = 1000
+
+// DeliveriesOptions page through the history: ?limit=<n>&nextToken=<token>. Only one page is
+// returned; X-Next-Token carries the token for the next when more remain.
+type DeliveriesOptions struct {
+	Limit     int64  `query:"limit"`
+	NextToken string `query:"nextToken"`
+}
+
+func parseOptions(query map[string]string) (DeliveriesOptions, error) {
+	opts := DeliveriesOptions{
+		Limit:     100,
+		NextToken: query["nextToken"],
+	}
+
+	if raw, found := query["limit"]; found {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return opts, fmt.Errorf("invalid limit: %v, must be 1 to %v", raw, MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	webhookIdRaw, found := request.PathParameters["webhookId"]
+	var webhookID string
+	if found {
+		value, err := url.QueryUnescape(webhookIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape webhookIdRaw: %v, error: %v", webhookIdRaw, err)
+		}
+
+		webhookID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no webhookId found???")
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	// the history is keyed by webhook alone, so check whose it is
+	if _, err := webhooks.Get(ctx, userId, webhookID); err == webhooks.ErrNotFound {
+		return Response{StatusCode: 404}, nil
+	} else if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	attempts, next, err := webhooks.History(ctx, webhookID, opts.Limit, opts.NextToken)
+	if err == webhooks.ErrInvalidPageToken {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	js, err := json.Marshal(attempts)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal deliveries")
+	}
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+	if next != "" {
+		headers["X-Next-Token"] = next
+		headers["Access-Control-Expose-Headers"] = "X-Next-Token"
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers:         headers,
+		Body:            string(js),
+	}, nil
+}
@@ -0,0 +1,241 @@
+package object_created
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/dedup"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/scan"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Object Created Lambda********************/
+// trigger: s3:ObjectCreated:Put on the files bucket
+// A client's PUT to an upload URL has stored a file's content: mark the file scanning so
+// nothing is served or copied from it meanwhile, charge its stored size to the owner's quota
+// and reject it if that does not fit, check it against the SHA-256 the upload declared,
+// detect its type and reject it if the upload policy refuses that, scan it for viruses,
+// render thumbnails of clean images, move clean content with a declared SHA-256 into a
+// shared blob, then tell the owner's webhooks the file is committed. Copies are committed
+// by copy_file itself, which only copies clean files and stores their content.
+// A failed scan is returned, so S3's retries of the invocation scan again; thumbnails are
+// only a convenience, so failing to render them is logged.
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, event events.S3Event) error {
+	defer tracing.Flush(ctx)
+
+	for _, record := range event.Records {
+		fileID := record.S3.Object.URLDecodedKey
+		if fileID == "" {
+			fileID = record.S3.Object.Key
+		}
+		if thumbnail.IsKey(fileID) {
+			// a rendition we stored ourselves
+			continue
+		}
+
+		item, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+		if errors.Is(err, aws_usages.ErrFileNotFound) {
+			// deleted before its content arrived, or not one of ours
+			logging.FromContext(ctx).Info("no file for stored object", "fileId", fileID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// the verdict was for the content this replaced; nothing is served while the new
+		// content is checked, and a copy_file racing this sees it
+		err = aws_usages.StartScanDynamoDB(ctx, "dev-files", fileID)
+		if errors.Is(err, aws_usages.ErrFileNotFound) {
+			logging.FromContext(ctx).Info("file deleted before its content was checked", "fileId", fileID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if item.FileStatus() == aws_usages.FileStatusPending {
+			if err := aws_usages.ActivateFileDynamoDB(ctx, "dev-files", fileID); err != nil {
+				return err
+			}
+		}
+
+		if item.BlobKey != "" {
+			// an overwrite has replaced the blob the file pointed at with content of its own
+			err := aws_usages.DetachBlobDynamoDB(ctx, "dev-files", "dev-blobs", *item)
+			if errors.Is(err, aws_usages.ErrFileNotFound) {
+				logging.FromContext(ctx).Info("file deleted before its blob was detached", "fileId", fileID)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			dedup.Release(ctx, item.UserID, item.SHA256)
+			item.SHA256 = ""
+			item.Thumbnails = nil
+		}
+
+		// the quota was charged the size the upload declared; charge what was stored instead
+		size := record.S3.Object.Size
+		if size < 0 {
+			// unknown, e.g. a chunked PUT to the local server
+			size = item.FileSize
+		}
+		err = quota.Settle(ctx, "dev-files", "dev-quotas", *item, size)
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			if err := reject(ctx, *item, exceeded.Error()); err != nil && !errors.Is(err, aws_usages.ErrFileNotFound) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		item.FileSize = size
+
+		if item.SHA256 != "" {
+			err := dedup.Verify(ctx, fileID, item.SHA256)
+			if err == dedup.ErrMismatch {
+				continue
+			}
+			if errors.Is(err, aws_usages.ErrFileNotFound) {
+				logging.FromContext(ctx).Info("file deleted before its content was verified", "fileId", fileID)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = contenttype.File(ctx, fileID, item.FileName)
+		var refused *contenttype.Error
+		if errors.As(err, &refused) {
+			// an overwrite may have replaced an image
+			if len(item.Thumbnails) > 0 {
+				if err := thumbnail.Clear(ctx, fileID); err != nil {
+					logging.FromContext(ctx).Error("thumbnails not updated", "fileId", fileID, "error", err)
+				}
+			}
+			continue
+		}
+		if errors.Is(err, aws_usages.ErrFileNotFound) {
+			logging.FromContext(ctx).Info("file deleted before its type was detected", "fileId", fileID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		status, err := scan.File(ctx, fileID)
+		if errors.Is(err, aws_usages.ErrFileNotFound) {
+			logging.FromContext(ctx).Info("file deleted before its scan", "fileId", fileID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case aws_usages.ScanStatusClean:
+			_, err = thumbnail.Render(ctx, fileID)
+		case aws_usages.ScanStatusQuarantined, aws_usages.ScanStatusTooLarge:
+			// an overwrite may have replaced a clean image
+			err = thumbnail.Clear(ctx, fileID)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("thumbnails not updated", "fileId", fileID, "error", err)
+		}
+
+		if status == aws_usages.ScanStatusClean && item.SHA256 != "" {
+			// the file is served from its own copy until then, so failing here only costs space
+			if err := dedup.Register(ctx, fileID, size); err != nil {
+				logging.FromContext(ctx).Error("content not deduplicated", "fileId", fileID, "error", err)
+			}
+		}
+
+		webhooks.Notify(ctx, webhooks.Event{
+			Type:     webhooks.EventFileCommitted,
+			UserID:   item.UserID,
+			FileID:   item.FileID,
+			FileName: item.FileName,
+			FileSize: size,
+		})
+	}
+
+	return nil
+}
+
+// reject refuses content the owner's quota has no room for, as contenttype does content the
+// upload policy refuses: the file is marked rejected and the content deleted
+func reject(ctx context.Context, item aws_usages.FileTableItem, reason string) error {
+	logging.FromContext(ctx).Warn("rejected file", "fileId", item.FileID, "reason", reason)
+	metrics.FromContext(ctx).Put("FilesRejected", 1, metrics.Count)
+
+	rejected := time.Now().UTC().Format(time.RFC3339)
+	if err := aws_usages.SetScanStatusDynamoDB(ctx, "dev-files", item.FileID, aws_usages.ScanStatusRejected, reason, rejected); err != nil {
+		return err
+	}
+	if err := storage.Default().Remove(ctx, item.FileID); err != nil {
+		// the file is not served while rejected, so the content can wait for its delete
+		logging.FromContext(ctx).Error("failed to remove rejected content", "fileId", item.FileID, "error", err)
+	}
+	// an overwrite may have replaced an image
+	if len(item.Thumbnails) > 0 {
+		if err := thumbnail.Clear(ctx, item.FileID); err != nil {
+			logging.FromContext(ctx).Error("thumbnails not updated", "fileId", item.FileID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Notifying wraps the local storage backend's handler so that a successful PUT invokes
+// Handler, as S3 does in the deployed stack
+func Notifying(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status/100 != 2 {
+			return
+		}
+
+		var record events.S3EventRecord
+		record.EventName = "ObjectCreated:Put"
+		record.S3.Object.Key = path.Base(r.URL.Path)
+		record.S3.Object.URLDecodedKey = record.S3.Object.Key
+		record.S3.Object.Size = r.ContentLength
+		if err := Handler(r.Context(), events.S3Event{Records: []events.S3EventRecord{record}}); err != nil {
+			logging.Default().Error("object created notification failed", "fileId", record.S3.Object.Key, "error", err)
+		}
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
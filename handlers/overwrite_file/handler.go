@@ -0,0 +1,184 @@
+package overwrite_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Upload File Lambda********************/
+// path: /{userId}
+// steps 1:
+// - put a new item in dynamoDB with a generated fields: UUID for fileID, string for TS
+// step 2:
+// - put item in s3 with the fileID
+// return status 200 if all of these are accomplished, and return in body json with fields...
+
+// Response is of type APIGatewayProxyResponse since we're leveraging the
+// AWS Lambda Proxy Request functionality (default behavior)
+//
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type UploadFileRequest struct {
+	FileName string `json:"FileName" openapi:"required,minLength=1,maxLength=filename.MaxLength"`
+}
+
+type PatchFileReturn struct {
+	PostURL string `json:"PostURL"`
+}
+
+// Limiter throttles URL signing per caller; tests swap in a ratelimit.MemoryLimiter
+var Limiter ratelimit.Limiter = ratelimit.NewDynamoDBLimiter("dev-ratelimits", ratelimit.ConfigFromEnv())
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	if retryAfter, limited := ratelimit.Check(ctx, Limiter, principal.Subject); limited {
+		return Response{
+			StatusCode: 429,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Retry-After":                 retryAfter,
+			},
+		}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	var body UploadFileRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if err := filename.Validate(body.FileName); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if err := contenttype.DefaultPolicy.CheckName(body.FileName); err != nil {
+		return Response{StatusCode: 415, Body: err.Error()}, nil
+	}
+
+	tableItem, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+	if tableItem.UserID != userId {
+		return Response{StatusCode: 404}, nil
+	}
+
+	signedUrl, err := storage.Default().UploadURL(ctx, fileID)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
+	}
+
+	t := time.Now().UTC().Format(time.RFC3339)
+
+	item := aws_usages.OverwriteTableItem{
+		FileName: body.FileName,
+		Modified: t,
+	}
+
+	err = aws_usages.OverwriteDynamoDB(ctx, "dev-files", "dev-filenames", *tableItem, item)
+	if err == aws_usages.ErrFileNotFound {
+		// deleted or renamed since we read it
+		return Response{StatusCode: 404}, nil
+	}
+	if err == aws_usages.ErrFileNameTaken {
+		return Response(responses.NameTaken(item.FileName)), nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("uploadFile failed: %v", err)
+	}
+
+	if tableItem.SHA256 != "" && tableItem.BlobKey == "" {
+		if err := aws_usages.ClearSHA256DynamoDB(ctx, "dev-files", fileID); err != nil {
+			return Response{StatusCode: 500}, err
+		}
+	}
+
+	entry := audit.NewEntry(audit.ActionOverwrite, principal, request, userId, fileID)
+	entry.Details = map[string]string{
+		"OldName": tableItem.FileName,
+		"NewName": item.FileName,
+	}
+	audit.Record(ctx, entry)
+
+	webhooks.Notify(ctx, webhooks.Event{
+		Type:     webhooks.EventFileOverwritten,
+		UserID:   userId,
+		FileID:   fileID,
+		FileName: item.FileName,
+	})
+
+	resp := PatchFileReturn{
+		PostURL: signedUrl,
+	}
+
+	js, err := json.Marshal(resp)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package query_audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Query Audit Lambda********************/
+// path: /audit
+// Admin only. Returns the audit entries about one user's files (?userId=) or one file (?fileId=),
+// oldest first, as a JSON array or, with ?format=jsonl, as JSON Lines to save as a file.
+// Without limit every entry is returned; with limit or nextToken one page is, and
+// X-Next-Token carries the token for the next one.
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// MaxPageSize caps the limit query option
+const MaxPageSize = 1000
+
+// AuditOptions are the query string options for this endpoint; exactly one of userId and fileId is required
+// ?userId=<id>&fileId=<id>&limit=<n>&nextToken=<token>&format=json|jsonl
+type AuditOptions struct {
+	UserID    string `query:"userId"`
+	FileID    string `query:"fileId"`
+	Limit     int64  `query:"limit"`
+	NextToken string `query:"nextToken"`
+	Format    string `query:"format"`
+}
+
+func parseOptions(query map[string]string) (AuditOptions, error) {
+	opts := AuditOptions{
+		UserID:    query["userId"],
+		FileID:    query["fileId"],
+		NextToken: query["nextToken"],
+		Format:    query["format"],
+	}
+
+	if (opts.UserID == "") == (opts.FileID == "") {
+		return opts, fmt.Errorf("exactly one of userId and fileId is required")
+	}
+	if raw, found := query["limit"]; found {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return opts, fmt.Errorf("invalid limit: %v, must be 1 to %v", raw, MaxPageSize)
+		}
+		opts.Limit = limit
+	}
+	switch opts.Format {
+	case "", "json", "jsonl":
+	default:
+		return opts, fmt.Errorf("invalid format: %v, must be json or jsonl", opts.Format)
+	}
+
+	return opts, nil
+}
+
+// Store is where entries are read from; it is the table audit.Default writes to
+var Store = audit.NewDynamoDBRecorder(audit.TableName)
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.IsAdmin() {
+		return Response{StatusCode: 403}, nil
+	}
+
+	opts, err := parseOptions(request.QueryStringParameters)
+	if err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+	}
+
+	filter := audit.Filter{TargetUser: opts.UserID, FileID: opts.FileID}
+	entries := []audit.Entry{}
+	token := opts.NextToken
+	for {
+		page, next, err := Store.Query(ctx, filter, opts.Limit, token)
+		if err == audit.ErrInvalidPageToken {
+			return Response{StatusCode: 400, Body: err.Error()}, nil
+		}
+		if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+
+		entries = append(entries, page...)
+		if opts.Limit > 0 || opts.NextToken != "" {
+			if next != "" {
+				headers["X-Next-Token"] = next
+				headers["Access-Control-Expose-Headers"] = "X-Next-Token"
+			}
+			break
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	if opts.Format == "jsonl" {
+		var body bytes.Buffer
+		for _, entry := range entries {
+			js, err := json.Marshal(entry)
+			if err != nil {
+				return Response{StatusCode: 500}, fmt.Errorf("failed to marshal audit entry")
+			}
+			body.Write(js)
+			body.WriteByte('\n')
+		}
+
+		name := "audit-user-" + opts.UserID + ".jsonl"
+		if opts.FileID != "" {
+			name = "audit-file-" + opts.FileID + ".jsonl"
+		}
+		headers["Content-Type"] = "application/x-ndjson"
+		headers["Content-Disposition"] = storage.ContentDisposition("attachment", name)
+
+		return Response{
+			StatusCode:      200,
+			IsBase64Encoded: false,
+			Headers:         headers,
+			Body:            body.String(),
+		}, nil
+	}
+
+	js, err := json.Marshal(entries)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal audit entries")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers:         headers,
+		Body:            string(js),
+	}, nil
+}
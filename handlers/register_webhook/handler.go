@@ -0,0 +1,122 @@
+package register_webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Register Webhook Lambda********************/
+// path: /{userId}/webhooks
+// Registers an endpoint to be POSTed the user's file events, signed with its secret.
+// The secret is generated unless the caller supplies one, and is only ever returned here.
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// RegisterWebhookRequest describes the endpoint. Events subscribes to some event types only.
+type RegisterWebhookRequest struct {
+	URL    string   `json:"URL" openapi:"required,minLength=1,maxLength=2048"`
+	Secret string   `json:"Secret" openapi:"maxLength=128"`
+	Events []string `json:"Events"`
+}
+
+// RegisterWebhookReturn is the new webhook with the secret its deliveries are signed with
+type RegisterWebhookReturn struct {
+	WebhookID string   `json:"WebhookID"`
+	UserID    string   `json:"UserID"`
+	URL       string   `json:"URL"`
+	Events    []string `json:"Events"`
+	Created   string   `json:"Created"`
+	Secret    string   `json:"Secret"`
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	var body RegisterWebhookRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err := webhooks.ValidateURL(body.URL); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err := webhooks.ValidateEvents(body.Events); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+	if err := webhooks.ValidateSecret(body.Secret); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	existing, err := webhooks.List(ctx, userId)
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+	if len(existing) >= webhooks.MaxWebhooks {
+		return Response{StatusCode: 409, Body: fmt.Sprintf("a user can register at most %v webhooks", webhooks.MaxWebhooks)}, nil
+	}
+
+	secret := body.Secret
+	if secret == "" {
+		if secret, err = webhooks.NewSecret(); err != nil {
+			return Response{StatusCode: 500}, err
+		}
+	}
+
+	hook, err := webhooks.Register(ctx, userId, body.URL, secret, body.Events)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("registerWebhook failed: %v", err)
+	}
+
+	resp := RegisterWebhookReturn{
+		WebhookID: hook.WebhookID,
+		UserID:    hook.UserID,
+		URL:       hook.URL,
+		Events:    hook.Events,
+		Created:   hook.Created,
+		Secret:    secret,
+	}
+
+	js, err := json.Marshal(resp)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal webhook")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
@@ -0,0 +1,139 @@
+package rename_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Rename File Lambda********************/
+// path: /{userId}/{fileId}/rename
+// changes FileName only: no upload URL is issued and Modified is left alone.
+// A name with slashes puts the file in that folder, so this also moves files.
+// return status 200 with the updated file, 400 for an invalid name,
+// 409 if another of the user's files already has that name
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type RenameFileRequest struct {
+	FileName string `json:"FileName" openapi:"required,minLength=1,maxLength=filename.MaxLength"`
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	fileIdRaw, found := request.PathParameters["fileId"]
+	var fileID string
+	if found {
+		value, err := url.QueryUnescape(fileIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape fileIdRaw: %v, error: %v", fileIdRaw, err)
+		}
+
+		fileID = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no fileId found???")
+	}
+
+	var body RenameFileRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if err := filename.Validate(body.FileName); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	// renaming would otherwise get around the extension policy
+	if err := contenttype.DefaultPolicy.CheckName(body.FileName); err != nil {
+		return Response{StatusCode: 415, Body: err.Error()}, nil
+	}
+
+	tableItem, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		return Response{StatusCode: 404}, nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+	if tableItem.UserID != userId {
+		return Response{StatusCode: 404}, nil
+	}
+
+	if tableItem.FileName == body.FileName {
+		return fileResponse(tableItem)
+	}
+
+	renamed, err := aws_usages.RenameFileDynamoDB(ctx, "dev-files", "dev-filenames", *tableItem, body.FileName)
+	if errors.Is(err, aws_usages.ErrFileNotFound) {
+		// deleted or renamed since we read it
+		return Response{StatusCode: 404}, nil
+	}
+	if err == aws_usages.ErrFileNameTaken {
+		return Response(responses.NameTaken(body.FileName)), nil
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("renameFile failed: %v", err)
+	}
+
+	entry := audit.NewEntry(audit.ActionRename, principal, request, userId, fileID)
+	entry.Details = map[string]string{
+		"OldName": tableItem.FileName,
+		"NewName": renamed.FileName,
+	}
+	audit.Record(ctx, entry)
+
+	return fileResponse(renamed)
+}
+
+func fileResponse(item *aws_usages.FileTableItem) (Response, error) {
+	js, err := json.Marshal(item)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal file")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
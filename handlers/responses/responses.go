@@ -0,0 +1,107 @@
+// Package responses holds what several handlers answer alike: the error responses of those
+// that create or rename files, so a client sees the same 409, 413 and 429 whichever of them
+// refused its request, and the public form of a file's item. Handlers convert the responses
+// to their own Response type.
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// File is a file's item as the API returns it, without the bookkeeping only the API itself
+// uses: whether its size is charged to the quota and which shared blob holds its content
+type File struct {
+	FileID    string `json:"FileID"`
+	UserID    string `json:"UserID"`
+	FirstName string `json:"FirstName"`
+	LastName  string `json:"LastName"`
+	FileName  string `json:"FileName"`
+	Modified  string `json:"Modified"`
+	Uploaded  string `json:"Uploaded"`
+	Status    string `json:"Status,omitempty"`
+	FileSize  int64  `json:"FileSize,omitempty"`
+
+	ScanStatus    string `json:"ScanStatus,omitempty"`
+	ScanSignature string `json:"ScanSignature,omitempty"`
+	Scanned       string `json:"Scanned,omitempty"`
+
+	ContentType string                 `json:"ContentType,omitempty"`
+	Thumbnails  []aws_usages.Thumbnail `json:"Thumbnails,omitempty"`
+	SHA256      string                 `json:"SHA256,omitempty"`
+}
+
+// Files maps items to what the API returns for them
+func Files(items []aws_usages.FileTableItem) []File {
+	files := make([]File, 0, len(items))
+	for _, item := range items {
+		files = append(files, File{
+			FileID:        item.FileID,
+			UserID:        item.UserID,
+			FirstName:     item.FirstName,
+			LastName:      item.LastName,
+			FileName:      item.FileName,
+			Modified:      item.Modified,
+			Uploaded:      item.Uploaded,
+			Status:        item.Status,
+			FileSize:      item.FileSize,
+			ScanStatus:    item.ScanStatus,
+			ScanSignature: item.ScanSignature,
+			Scanned:       item.Scanned,
+			ContentType:   item.ContentType,
+			Thumbnails:    item.Thumbnails,
+			SHA256:        item.SHA256,
+		})
+	}
+
+	return files
+}
+
+// NameTaken is the 409 for a fileName another of the user's files already has
+func NameTaken(fileName string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: 409,
+		Body:       fmt.Sprintf("a file named %q already exists in folder %q", filename.Base(fileName), filename.Folder(fileName)),
+	}
+}
+
+// QuotaExceeded is the 413 or 429 for a file the user's quota has no room for, with the
+// quota's usage and limits as a JSON body
+func QuotaExceeded(exceeded *quota.ExceededError) (events.APIGatewayProxyResponse, error) {
+	js, err := json.Marshal(exceeded)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, fmt.Errorf("failed to marshal quota error")
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:      exceeded.StatusCode,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+			"Content-Type":                "application/json",
+		},
+		Body: string(js),
+	}, nil
+}
+
+// QuotaConflict answers a commit of size bytes for userID that was refused with
+// aws_usages.ErrQuotaExceeded after the quota check passed: another write for the user
+// committed in between. If the quota is now exceeded that is the answer; otherwise the
+// client is asked to retry.
+func QuotaConflict(ctx context.Context, userID string, size int64) (events.APIGatewayProxyResponse, error) {
+	usage, err := quota.Current(ctx, "dev-quotas", userID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+	if exceeded := quota.Check(*usage, size); exceeded != nil {
+		return QuotaExceeded(exceeded)
+	}
+
+	return events.APIGatewayProxyResponse{StatusCode: 429, Body: "quota check conflicted with a concurrent upload, retry"}, nil
+}
@@ -0,0 +1,78 @@
+package update_quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+// UpdateQuotaRequest overrides a user's limits. 0 restores the stage default.
+type UpdateQuotaRequest struct {
+	MaxBytes int64 `json:"MaxBytes" openapi:"minimum=0"`
+	MaxFiles int64 `json:"MaxFiles" openapi:"minimum=0"`
+}
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.IsAdmin() {
+		return Response{StatusCode: 403}, nil
+	}
+
+	var body UpdateQuotaRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if err := aws_usages.SetQuotaLimitsDynamoDB(ctx, "dev-quotas", userId, body.MaxBytes, body.MaxFiles); err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	usage, err := quota.Current(ctx, "dev-quotas", userId)
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	js, err := json.Marshal(usage)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal usage")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
@@ -0,0 +1,264 @@
+package upload_file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/dedup"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+/****************Upload File Lambda********************/
+// path: /{userId}
+// steps 1:
+// - put a new item in dynamoDB with a generated fields: UUID for fileID, string for TS
+// step 2:
+// - put item in s3 with the fileID
+// if the request declares the SHA256 of content the user already uploaded, the new item points
+// at that shared blob instead and no upload URL is returned
+// return status 200 if all of these are accomplished, and return in body json with fields...
+
+// Response is of type APIGatewayProxyResponse since we're leveraging the
+// AWS Lambda Proxy Request functionality (default behavior)
+//
+// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
+type Response events.APIGatewayProxyResponse
+
+type UploadFileRequest struct {
+	FileName  string `json:"FileName" openapi:"required,minLength=1,maxLength=filename.MaxLength"`
+	FirstName string `json:"FirstName"`
+	LastName  string `json:"LastName"`
+	FileSize  int64  `json:"FileSize" openapi:"minimum=0"`
+	// SHA256 optionally declares the hex digest of the content, so content the user already
+	// uploaded is not stored again
+	SHA256 string `json:"SHA256,omitempty" openapi:"minLength=64,maxLength=64"`
+}
+
+// UploadFileReturn has no UploadURL when the upload was Deduplicated: the file already has
+// its content
+type UploadFileReturn struct {
+	FileID       string `json:"FileID"`
+	UploadURL    string `json:"UploadURL,omitempty"`
+	Deduplicated bool   `json:"Deduplicated,omitempty"`
+}
+
+// Limiter throttles URL signing per caller; tests swap in a ratelimit.MemoryLimiter
+var Limiter ratelimit.Limiter = ratelimit.NewDynamoDBLimiter("dev-ratelimits", ratelimit.ConfigFromEnv())
+
+// Handler is our lambda handler invoked by the `lambda.Start` function call
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	// Get the file from the request, and get the UserID from the request
+	userIdRaw, found := request.PathParameters["userId"]
+	var userId string
+	if found {
+		value, err := url.QueryUnescape(userIdRaw)
+		if nil != err {
+			return Response{StatusCode: 500},
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
+		}
+
+		userId = value
+	} else {
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
+	}
+
+	if retryAfter, limited := ratelimit.Check(ctx, Limiter, principal.Subject); limited {
+		return Response{
+			StatusCode: 429,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Retry-After":                 retryAfter,
+			},
+		}, nil
+	}
+
+	var body UploadFileRequest
+	if err := openapi.Decode(request.Body, &body); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if body.SHA256 != "" && !dedup.ValidSHA256(body.SHA256) {
+		return Response{StatusCode: 400, Body: "SHA256 must be 64 lowercase hex digits"}, nil
+	}
+
+	if err := filename.Validate(body.FileName); err != nil {
+		return Response{StatusCode: 400, Body: err.Error()}, nil
+	}
+
+	if err := contenttype.DefaultPolicy.CheckName(body.FileName); err != nil {
+		return Response{StatusCode: 415, Body: err.Error()}, nil
+	}
+
+	usage, err := quota.Current(ctx, "dev-quotas", userId)
+	if err != nil {
+		return Response{StatusCode: 500}, err
+	}
+
+	var blob *aws_usages.BlobTableItem
+	if body.SHA256 != "" {
+		blob, err = aws_usages.GetBlobDynamoDB(ctx, "dev-blobs", userId, body.SHA256)
+		if err == aws_usages.ErrBlobNotFound {
+			blob = nil
+		} else if err != nil {
+			return Response{StatusCode: 500}, err
+		}
+	}
+
+	// a deduplicated file is charged the size of its blob, whatever was declared
+	size := body.FileSize
+	if blob != nil {
+		size = blob.Size
+	}
+
+	if exceeded := quota.Check(*usage, size); exceeded != nil {
+		response, err := responses.QuotaExceeded(exceeded)
+		return Response(response), err
+	}
+
+	uuidWithHyphen := uuid.New()
+	fileID := strings.Replace(uuidWithHyphen.String(), "-", "", -1)
+
+	t := time.Now().UTC().Format(time.RFC3339)
+
+	uploaded := aws_usages.FileTableItem{
+		FileID:    fileID,
+		UserID:    userId,
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		FileName:  body.FileName,
+		Modified:  t,
+		Uploaded:  t,
+		FileSize:  body.FileSize,
+		SHA256:    body.SHA256,
+		// active once the content arrives (object_created)
+		Status: aws_usages.FileStatusPending,
+		// served once the content arrives and scans clean
+		ScanStatus: aws_usages.ScanStatusUnscanned,
+	}
+
+	item := uploaded
+	if blob != nil {
+		item = withBlob(uploaded, *blob)
+		err = aws_usages.CommitBlobFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-blobs", "dev-filenames", item, usage.MaxBytes, usage.MaxFiles)
+		if err == aws_usages.ErrBlobNotFound {
+			// the blob lost its last file since we looked it up, so the content is needed after all
+			blob = nil
+			item = uploaded
+		}
+	}
+
+	var signedUrl string
+	if blob == nil {
+		signedUrl, err = storage.Default().UploadURL(ctx, fileID)
+		if err != nil {
+			return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
+		}
+
+		err = aws_usages.CommitFileDynamoDB(ctx, "dev-files", "dev-quotas", "dev-filenames", item, usage.MaxBytes, usage.MaxFiles)
+	}
+	if err == aws_usages.ErrFileNameTaken {
+		return Response(responses.NameTaken(item.FileName)), nil
+	}
+	if err == aws_usages.ErrQuotaExceeded {
+		// another upload for this user committed between our check and write
+		response, err := responses.QuotaConflict(ctx, userId, item.FileSize)
+		return Response(response), err
+	}
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("uploadFile failed: %v", err)
+	}
+
+	entry := audit.NewEntry(audit.ActionUpload, principal, request, userId, fileID)
+	entry.Details = map[string]string{
+		"FileName": item.FileName,
+		"FileSize": strconv.FormatInt(item.FileSize, 10),
+	}
+	if blob != nil {
+		entry.Details["Deduplicated"] = "true"
+	}
+	audit.Record(ctx, entry)
+
+	webhooks.Notify(ctx, webhooks.Event{
+		Type:     webhooks.EventFileCreated,
+		UserID:   userId,
+		FileID:   fileID,
+		FileName: item.FileName,
+		FileSize: item.FileSize,
+	})
+
+	if blob != nil {
+		// the content is already stored, scanned and thumbnailed
+		webhooks.Notify(ctx, webhooks.Event{
+			Type:     webhooks.EventFileCommitted,
+			UserID:   userId,
+			FileID:   fileID,
+			FileName: item.FileName,
+			FileSize: item.FileSize,
+		})
+		metrics.FromContext(ctx).Put("UploadsDeduplicated", 1, metrics.Count)
+	} else {
+		// the declared size; the bytes themselves go straight to storage
+		metrics.FromContext(ctx).Put("BytesUploaded", float64(body.FileSize), metrics.Bytes)
+	}
+
+	resp := UploadFileReturn{
+		FileID:       fileID,
+		UploadURL:    signedUrl,
+		Deduplicated: blob != nil,
+	}
+
+	js, err := json.Marshal(resp)
+	if err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
+	}
+
+	return Response{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		},
+		Body: string(js),
+	}, nil
+}
+
+// withBlob is the item of an upload pointing at the user's blob of the same content, which
+// has already been through everything the object-created trigger does to new content
+func withBlob(item aws_usages.FileTableItem, blob aws_usages.BlobTableItem) aws_usages.FileTableItem {
+	item.Status = aws_usages.FileStatusActive
+	item.FileSize = blob.Size
+	item.BlobKey = blob.Key
+	item.ScanStatus = blob.ScanStatus
+	item.Scanned = blob.Scanned
+	item.ContentType = blob.ContentType
+	item.Thumbnails = blob.Thumbnails
+
+	return item
+}
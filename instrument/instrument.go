@@ -0,0 +1,124 @@
+// Package instrument wraps API handlers with the logging, metrics and tracing every request
+// gets, whether it is served by a per-function Lambda, the single-binary one or the local
+// server. It imports no handlers, so a per-function binary links only its own.
+package instrument
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// HandlerFunc is a handler with its package Response type converted back to the API Gateway one
+type HandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Route wraps next, the handler for routeKey, with what every request gets whichever way it
+// is deployed: a root span that AWS calls made with its context become children of, a logger
+// in its context carrying the request ID, correlation ID, trace ID, route, user and file, a
+// log line and latency and status metrics when it completes, and the correlation ID echoed
+// in the response
+func Route(routeKey string, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		ctx, span := tracing.StartRequest(ctx, request, routeKey)
+		ctx, logger, correlationID := logging.ForRequest(ctx, request, routeKey)
+		span.SetAttributes(attribute.String("app.correlation_id", correlationID))
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			logger = logger.With("traceId", sc.TraceID().String())
+			ctx = logging.NewContext(ctx, logger)
+		}
+		scope := metrics.NewScope(metrics.Dimensions{"Stage": stage(request), "Route": routeKey})
+		ctx = metrics.NewContext(ctx, scope)
+
+		start := time.Now()
+		resp, err := next(ctx, request)
+		elapsed := time.Since(start)
+
+		status := resp.StatusCode
+		if err != nil {
+			// API Gateway answers a Lambda error with a bare 500
+			status = 500
+		}
+		tracing.EndRequest(span, status, err)
+		scope.Emit(nil,
+			metrics.Metric{Name: "Latency", Value: float64(elapsed) / float64(time.Millisecond), Unit: metrics.Milliseconds},
+			metrics.Metric{Name: "Requests", Value: 1, Unit: metrics.Count},
+		)
+		scope.Emit(metrics.Dimensions{"StatusCode": strconv.Itoa(status)},
+			metrics.Metric{Name: "Requests", Value: 1, Unit: metrics.Count},
+		)
+
+		if err != nil {
+			logger.Error("request failed", "status", status, "durationMs", elapsed, "error", err)
+			return resp, err
+		}
+		logger.Info("request completed", "status", status, "durationMs", elapsed)
+
+		resp.Headers = withHeader(resp.Headers, logging.CorrelationIDHeader, correlationID)
+		resp.Headers = withExposedHeader(resp.Headers, logging.CorrelationIDHeader)
+		return resp, nil
+	}
+}
+
+// stage is the request's API Gateway stage, or STAGE for HTTP APIs' $default stage
+func stage(request events.APIGatewayProxyRequest) string {
+	if s := request.RequestContext.Stage; s != "" && s != "$default" {
+		return s
+	}
+	return metrics.Stage()
+}
+
+// Function is the entry point of a per-function Lambda serving routeKey with next. The
+// storage backend is built from the environment first; if that fails every request gets a
+// logged 500 carrying the configuration error, rather than the function crashing at startup
+// without a response.
+func Function(routeKey string, next HandlerFunc) HandlerFunc {
+	if err := storage.Init(); err != nil {
+		err = fmt.Errorf("storage: %v", err)
+		next = func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{StatusCode: 500}, err
+		}
+	}
+
+	return Flushing(Route(routeKey, next))
+}
+
+// Flushing exports the invocation's spans before Lambda freezes the process
+func Flushing(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		defer tracing.Flush(ctx)
+		return next(ctx, request)
+	}
+}
+
+// withHeader sets a header on a possibly nil map, which handlers return for bare 4xx responses
+func withHeader(headers map[string]string, name string, value string) map[string]string {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers[name] = value
+
+	return headers
+}
+
+// withExposedHeader adds name to Access-Control-Expose-Headers so browsers let scripts read it
+func withExposedHeader(headers map[string]string, name string) map[string]string {
+	const expose = "Access-Control-Expose-Headers"
+	for k, v := range headers {
+		if strings.EqualFold(k, expose) {
+			headers[k] = v + ", " + name
+			return headers
+		}
+	}
+	headers[expose] = name
+
+	return headers
+}
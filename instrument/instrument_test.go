@@ -0,0 +1,168 @@
+package instrument
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRoute(t *testing.T) {
+	var buf bytes.Buffer
+	saved := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelInfo))
+	defer logging.SetDefault(saved)
+	recorder := &metrics.Recorder{}
+	savedSink := metrics.Default()
+	metrics.SetDefault(recorder)
+	defer metrics.SetDefault(savedSink)
+
+	handler := Route("GET /{userId}", func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		logging.FromContext(ctx).Info("inside")
+		if r.PathParameters["userId"] == "broken" {
+			return events.APIGatewayProxyResponse{StatusCode: 500}, errors.New("GetItem error")
+		}
+		return events.APIGatewayProxyResponse{StatusCode: 404, Headers: map[string]string{"Access-Control-Expose-Headers": "X-Next-Token"}}, nil
+	})
+
+	request := events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"X-Correlation-ID": "trace-1"},
+		PathParameters: map[string]string{"userId": "u1"},
+	}
+	request.RequestContext.RequestID = "req-1"
+	resp, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers[logging.CorrelationIDHeader] != "trace-1" || resp.Headers["Access-Control-Expose-Headers"] != "X-Next-Token, X-Correlation-ID" {
+		t.Errorf("headers = %v", resp.Headers)
+	}
+
+	request.PathParameters["userId"] = "broken"
+	if _, err := handler(context.Background(), request); err == nil {
+		t.Error("handler error was swallowed")
+	}
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("%q is not JSON: %v", line, err)
+		}
+		lines = append(lines, fields)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("logged %v lines:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if line["route"] != "GET /{userId}" || line["requestId"] != "req-1" || line["correlationId"] != "trace-1" {
+			t.Errorf("line missing request fields: %v", line)
+		}
+	}
+	if lines[1]["msg"] != "request completed" || lines[1]["status"] != 404.0 || lines[1]["userId"] != "u1" {
+		t.Errorf("completion line = %v", lines[1])
+	}
+	if lines[3]["level"] != "ERROR" || lines[3]["error"] != "GetItem error" {
+		t.Errorf("failure line = %v", lines[3])
+	}
+
+	route404 := metrics.Dimensions{"Route": "GET /{userId}", "StatusCode": "404"}
+	route500 := metrics.Dimensions{"Route": "GET /{userId}", "StatusCode": "500"}
+	if recorder.Sum("Requests", route404) != 1 || recorder.Sum("Requests", route500) != 1 {
+		t.Errorf("status counts: 404 %v, 500 %v", recorder.Sum("Requests", route404), recorder.Sum("Requests", route500))
+	}
+	if latency := recorder.Points("Latency", metrics.Dimensions{"Route": "GET /{userId}", "Stage": "dev"}); len(latency) != 2 {
+		t.Errorf("latency points = %+v", latency)
+	}
+}
+
+func TestRouteTracing(t *testing.T) {
+	var buf bytes.Buffer
+	saved := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelInfo))
+	defer logging.SetDefault(saved)
+	spans := tracetest.NewSpanRecorder()
+	savedProvider := tracing.Default()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	defer tracing.SetDefault(savedProvider)
+
+	handler := Route("GET /{userId}", func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		_, child := tracing.Tracer().Start(ctx, "DynamoDB.GetItem")
+		child.End()
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	})
+
+	request := events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		PathParameters: map[string]string{"userId": "u1"},
+	}
+	if _, err := handler(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("ended %v spans", len(ended))
+	}
+	child, root := ended[0], ended[1]
+	if root.Name() != "GET /{userId}" || root.SpanKind() != trace.SpanKindServer {
+		t.Errorf("root span = %v (%v)", root.Name(), root.SpanKind())
+	}
+	if root.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || root.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("root span did not continue the caller's trace: %v", root.Parent())
+	}
+	if child.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("span started in the handler is not a child of the root span")
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["http.status_code"].AsInt64() != 200 || attrs["app.user_id"].AsString() != "u1" {
+		t.Errorf("root span attributes = %v", root.Attributes())
+	}
+
+	if !strings.Contains(buf.String(), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("log lines lack the trace ID:\n%s", buf.String())
+	}
+}
+
+func TestFunctionWithoutStorage(t *testing.T) {
+	var buf bytes.Buffer
+	saved := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelInfo))
+	defer logging.SetDefault(saved)
+
+	storage.SetDefault(nil)
+	defer storage.SetDefault(nil)
+	os.Setenv("STORAGE_BACKEND", "floppy")
+	defer os.Setenv("STORAGE_BACKEND", "")
+
+	called := false
+	handler := Function("GET /{userId}", func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		called = true
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	})
+
+	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+	if resp.StatusCode != 500 || err == nil || !strings.Contains(err.Error(), "unknown STORAGE_BACKEND floppy") || called {
+		t.Errorf("misconfigured function = %v, %v, handler called %v", resp.StatusCode, err, called)
+	}
+	if !strings.Contains(buf.String(), "request failed") {
+		t.Errorf("failure was not logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,2021 @@
+//go:build integration
+// +build integration
+
+// Package integration runs the API end to end: requests go through the router, the JWT
+// middleware and the real handlers, which talk to an in-process DynamoDB stand-in and the
+// local storage backend. Nothing leaves the machine.
+//
+//	$ go test -tags integration ./integration/
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth/authtest"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages/dynamotest"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/client"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/contenttype"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/fileevents"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/copy_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/download_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/file_stream"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/get_thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/object_created"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/overwrite_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/register_webhook"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/upload_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/ratelimit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/router"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/scan"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	issuerURL = "https://cognito-idp.us-west-2.amazonaws.com/us-west-2_test"
+	clientID  = "integration-client"
+)
+
+var (
+	recorded = &metrics.Recorder{}
+
+	dynamo *dynamotest.Server
+	issuer *authtest.Issuer
+	api    *httptest.Server
+)
+
+func TestMain(m *testing.M) {
+	code, err := run(m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func run(m *testing.M) (int, error) {
+	// request logs would bury the test output
+	logging.SetDefault(logging.New(ioutil.Discard, logging.LevelError+1))
+	metrics.SetDefault(recorded)
+
+	dynamo = dynamotest.NewServer()
+	defer dynamo.Close()
+	dynamo.CreateTable("dev-files", "FileID", "")
+	dynamo.EnableStream("dev-files")
+	dynamo.CreateTable("dev-quotas", "UserID", "")
+	dynamo.CreateTable("dev-ratelimits", "UserID", "")
+	dynamo.CreateTable("dev-audit", "EntryID", "")
+	dynamo.CreateIndex("dev-audit", "ByTargetUser", "TargetUser", "Timestamp")
+	dynamo.CreateIndex("dev-audit", "ByFile", "FileID", "Timestamp")
+	dynamo.CreateTable("dev-webhooks", "UserID", "WebhookID")
+	dynamo.CreateTable("dev-webhook-deliveries", "WebhookID", "AttemptID")
+	dynamo.CreateTable("dev-webhook-deadletters", "WebhookID", "DeliveryID")
+	dynamo.CreateTable("dev-blobs", "UserID", "SHA256")
+	dynamo.CreateTable("dev-filenames", "UserID", "FileName")
+
+	// the aws_usages client is created on first use, so this must happen before any request
+	os.Setenv("DYNAMODB_ENDPOINT", dynamo.URL)
+	os.Setenv("AWS_ACCESS_KEY_ID", "integration")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "integration")
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	dir, err := ioutil.TempDir("", "integration")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	issuer, err = authtest.NewIssuer(issuerURL, clientID)
+	if err != nil {
+		return 0, err
+	}
+	jwksFile := filepath.Join(dir, "jwks.json")
+	if err := issuer.WriteJWKS(jwksFile); err != nil {
+		return 0, err
+	}
+	verifier := &auth.Verifier{
+		Issuer:   issuerURL,
+		Audience: []string{clientID},
+		Keys:     &auth.KeySet{File: jwksFile},
+	}
+
+	mux := http.NewServeMux()
+	api = httptest.NewServer(mux)
+	defer api.Close()
+
+	local, err := storage.NewLocal(filepath.Join(dir, "objects"), api.URL+strings.TrimSuffix(storage.LocalPathPrefix, "/"), "integration")
+	if err != nil {
+		return 0, err
+	}
+	storage.SetDefault(local)
+	mux.Handle(storage.LocalPathPrefix, object_created.Notifying(local))
+	mux.Handle("/", &router.HTTPHandler{
+		Routes: router.Routes(),
+		Stage:  "integration",
+		Wrap: func(next router.HandlerFunc) router.HandlerFunc {
+			return router.HandlerFunc(verifier.Middleware(auth.HandlerFunc(next)))
+		},
+	})
+
+	setLimiter(ratelimit.Config{Burst: 1000, PerMinute: 1000})
+
+	// deliveries wait in queued until a test makes them; receivers are httptest servers
+	webhooks.DefaultQueue = queued
+	webhooks.AllowHTTP = true
+
+	scan.DefaultScanner = scan.Fake{}
+
+	return m.Run(), nil
+}
+
+func setLimiter(cfg ratelimit.Config) {
+	limiter := ratelimit.NewMemoryLimiter(cfg)
+	upload_file.Limiter = limiter
+	download_file.Limiter = limiter
+	overwrite_file.Limiter = limiter
+	copy_file.Limiter = limiter
+	get_thumbnail.Limiter = limiter
+}
+
+// call sends a request to the API as token, decoding a JSON response into out when given
+func call(t *testing.T, token string, method string, path string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, api.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%v %v: failed to decode response: %v", method, path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// object performs a request against a signed storage URL
+func object(t *testing.T, method string, signedURL string, content string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, signedURL, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(data)
+}
+
+func upload(t *testing.T, token string, userID string, name string, content string) string {
+	t.Helper()
+
+	var up upload_file.UploadFileReturn
+	request := upload_file.UploadFileRequest{FileName: name, FirstName: "Ada", LastName: "Lovelace", FileSize: int64(len(content))}
+	if status := call(t, token, "POST", "/"+userID, request, &up); status != 200 {
+		t.Fatalf("upload %v: status %v", name, status)
+	}
+	if status, _ := object(t, "PUT", up.UploadURL, content); status != 200 {
+		t.Fatalf("PUT %v: status %v", name, status)
+	}
+
+	return up.FileID
+}
+
+func TestFileLifecycle(t *testing.T) {
+	const user = "lifecycle-user"
+	token := issuer.Token(user)
+
+	fileID := upload(t, token, user, "notes.txt", "first version")
+
+	var list []aws_usages.FileTableItem
+	if status := call(t, token, "GET", "/"+user, nil, &list); status != 200 {
+		t.Fatalf("list: status %v", status)
+	}
+	if len(list) != 1 || list[0].FileID != fileID || list[0].FileName != "notes.txt" {
+		t.Fatalf("list = %+v", list)
+	}
+	// the item's bookkeeping stays internal
+	if list[0].QuotaCharged {
+		t.Errorf("list exposes QuotaCharged: %+v", list[0])
+	}
+
+	var down download_file.DownloadReturn
+	if status := call(t, token, "GET", "/"+user+"/"+fileID, nil, &down); status != 200 {
+		t.Fatalf("download: status %v", status)
+	}
+	if status, content := object(t, "GET", down.DownloadURL, ""); status != 200 || content != "first version" {
+		t.Fatalf("GET object = %v %q", status, content)
+	}
+
+	var patch overwrite_file.PatchFileReturn
+	overwrite := overwrite_file.UploadFileRequest{FileName: "notes-v2.txt"}
+	if status := call(t, token, "PATCH", "/"+user+"/"+fileID, overwrite, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	if status, _ := object(t, "PUT", patch.PostURL, "second version"); status != 200 {
+		t.Fatalf("PUT overwrite: status %v", status)
+	}
+	if status, content := object(t, "GET", down.DownloadURL, ""); status != 200 || content != "second version" {
+		t.Fatalf("GET overwritten object = %v %q", status, content)
+	}
+
+	list = nil
+	call(t, token, "GET", "/"+user, nil, &list)
+	if len(list) != 1 || list[0].FileName != "notes-v2.txt" {
+		t.Fatalf("list after overwrite = %+v", list)
+	}
+
+	var del struct {
+		DeleteURL string `json:"DeleteURL"`
+	}
+	if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, &del); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+	if status, _ := object(t, "DELETE", del.DeleteURL, ""); status != 204 {
+		t.Fatalf("DELETE object: status %v", status)
+	}
+	if status, _ := object(t, "GET", down.DownloadURL, ""); status != 404 {
+		t.Errorf("GET deleted object: status %v", status)
+	}
+
+	list = nil
+	call(t, token, "GET", "/"+user, nil, &list)
+	if len(list) != 0 {
+		t.Errorf("list after delete = %+v", list)
+	}
+
+	var usage struct {
+		UsedBytes int64 `json:"UsedBytes"`
+		FileCount int64 `json:"FileCount"`
+	}
+	if status := call(t, token, "GET", "/"+user+"/usage", nil, &usage); status != 200 {
+		t.Fatalf("usage: status %v", status)
+	}
+	if usage.UsedBytes != 0 || usage.FileCount != 0 {
+		t.Errorf("usage after delete = %+v", usage)
+	}
+}
+
+func TestAuthorizationFailures(t *testing.T) {
+	const owner = "owner-user"
+	const other = "other-user"
+	ownerToken := issuer.Token(owner)
+	otherToken := issuer.Token(other)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	fileID := upload(t, ownerToken, owner, "private.txt", "secret")
+
+	stranger, err := authtest.NewIssuer(issuerURL, clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"no token", "", "GET", "/" + owner, nil, 401},
+		{"malformed token", "not-a-jwt", "GET", "/" + owner, nil, 401},
+		{"unknown signing key", stranger.Token(owner), "GET", "/" + owner, nil, 401},
+		{"list another user", otherToken, "GET", "/" + owner, nil, 403},
+		{"download another user", otherToken, "GET", "/" + owner + "/" + fileID, nil, 403},
+		{"overwrite another user", otherToken, "PATCH", "/" + owner + "/" + fileID, overwrite_file.UploadFileRequest{FileName: "x"}, 403},
+		{"delete another user", otherToken, "DELETE", "/" + owner + "/" + fileID, nil, 403},
+		{"upload as another user", otherToken, "POST", "/" + owner, upload_file.UploadFileRequest{FileName: "x"}, 403},
+		{"another user's file by id", otherToken, "GET", "/" + other + "/" + fileID, nil, 404},
+		{"delete another user's file by id", otherToken, "DELETE", "/" + other + "/" + fileID, nil, 404},
+		{"overwrite another user's file by id", otherToken, "PATCH", "/" + other + "/" + fileID, overwrite_file.UploadFileRequest{FileName: "x"}, 404},
+		{"download missing file", ownerToken, "GET", "/" + owner + "/missing", nil, 404},
+		{"overwrite missing file", ownerToken, "PATCH", "/" + owner + "/missing", overwrite_file.UploadFileRequest{FileName: "x"}, 404},
+		{"delete missing file", ownerToken, "DELETE", "/" + owner + "/missing", nil, 404},
+		{"list all as user", ownerToken, "GET", "/", nil, 403},
+		{"update quota as user", ownerToken, "PUT", "/" + owner + "/usage", map[string]int64{"MaxBytes": 1 << 40}, 403},
+		{"list all as admin", adminToken, "GET", "/", nil, 200},
+		{"download as admin", adminToken, "GET", "/" + owner + "/" + fileID, nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := call(t, tt.token, tt.method, tt.path, tt.body, nil); got != tt.want {
+				t.Errorf("%v %v = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// the file survived every attempt
+	var list []aws_usages.FileTableItem
+	call(t, ownerToken, "GET", "/"+owner, nil, &list)
+	if len(list) != 1 {
+		t.Errorf("owner's files = %+v", list)
+	}
+}
+
+func TestSignedURLsCannotBeRepurposed(t *testing.T) {
+	const user = "signed-url-user"
+	token := issuer.Token(user)
+
+	fileID := upload(t, token, user, "a.txt", "original")
+
+	var down download_file.DownloadReturn
+	call(t, token, "GET", "/"+user+"/"+fileID, nil, &down)
+
+	if status, _ := object(t, "PUT", down.DownloadURL, "tampered"); status != 403 {
+		t.Errorf("PUT with download URL: status %v", status)
+	}
+	if status, _ := object(t, "DELETE", down.DownloadURL, ""); status != 403 {
+		t.Errorf("DELETE with download URL: status %v", status)
+	}
+
+	otherID := upload(t, token, user, "b.txt", "other")
+	if status, _ := object(t, "GET", strings.Replace(down.DownloadURL, fileID, otherID, 1), ""); status != 403 {
+		t.Errorf("GET with download URL for another file: status %v", status)
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	const user = "quota-user"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	limits := map[string]int64{"MaxBytes": 10, "MaxFiles": 2}
+	if status := call(t, adminToken, "PUT", "/"+user+"/usage", limits, nil); status != 200 {
+		t.Fatalf("update quota: status %v", status)
+	}
+
+	upload(t, token, user, "small.txt", "12345")
+
+	request := upload_file.UploadFileRequest{FileName: "big.txt", FileSize: 6}
+	if status := call(t, token, "POST", "/"+user, request, nil); status != 413 {
+		t.Errorf("upload over byte quota: status %v", status)
+	}
+
+	upload(t, token, user, "small2.txt", "12345")
+
+	request = upload_file.UploadFileRequest{FileName: "empty.txt"}
+	if status := call(t, token, "POST", "/"+user, request, nil); status != 429 {
+		t.Errorf("upload over file quota: status %v", status)
+	}
+}
+
+func TestQuotaChargesStoredSize(t *testing.T) {
+	const user = "stored-size-user"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	limits := map[string]int64{"MaxBytes": 20, "MaxFiles": 10}
+	if status := call(t, adminToken, "PUT", "/"+user+"/usage", limits, nil); status != 200 {
+		t.Fatalf("update quota: status %v", status)
+	}
+
+	var usage struct {
+		UsedBytes int64 `json:"UsedBytes"`
+		FileCount int64 `json:"FileCount"`
+	}
+	used := func() int64 {
+		t.Helper()
+		call(t, token, "GET", "/"+user+"/usage", nil, &usage)
+		return usage.UsedBytes
+	}
+	file := func(fileID string) aws_usages.FileTableItem {
+		t.Helper()
+		item, err := aws_usages.GetFileDynamoDB(context.Background(), "dev-files", fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *item
+	}
+	post := func(name string, declared int64) upload_file.UploadFileReturn {
+		t.Helper()
+		var up upload_file.UploadFileReturn
+		if status := call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: name, FileSize: declared}, &up); status != 200 {
+			t.Fatalf("upload %v: status %v", name, status)
+		}
+		return up
+	}
+
+	// declaring less than is stored is charged what is stored
+	under := post("under.txt", 1)
+	object(t, "PUT", under.UploadURL, "0123456789")
+	if f := file(under.FileID); f.FileSize != 10 || f.ScanStatus != aws_usages.ScanStatusClean {
+		t.Errorf("underdeclared file = %+v", f)
+	}
+	if u := used(); u != 10 {
+		t.Errorf("usage after an underdeclared upload = %v, want 10", u)
+	}
+
+	// and refused when what is stored does not fit
+	over := post("over.txt", 1)
+	object(t, "PUT", over.UploadURL, "0123456789abcdef")
+	if f := file(over.FileID); f.FileSize != 1 || f.ScanStatus != aws_usages.ScanStatusRejected {
+		t.Errorf("file over quota = %+v", f)
+	}
+	if status := call(t, token, "GET", "/"+user+"/"+over.FileID, nil, nil); status != 409 {
+		t.Errorf("download of a file over quota: status %v", status)
+	}
+	if u := used(); u != 11 {
+		t.Errorf("usage after a refused upload = %v, want 11", u)
+	}
+
+	// overwrites are charged the difference
+	var patch overwrite_file.PatchFileReturn
+	if status := call(t, token, "PATCH", "/"+user+"/"+under.FileID, overwrite_file.UploadFileRequest{FileName: "under.txt"}, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	object(t, "PUT", patch.PostURL, "0123")
+	if u := used(); u != 5 {
+		t.Errorf("usage after a smaller overwrite = %v, want 5", u)
+	}
+	call(t, token, "PATCH", "/"+user+"/"+under.FileID, overwrite_file.UploadFileRequest{FileName: "under.txt"}, &patch)
+	object(t, "PUT", patch.PostURL, "0123456789abcdefghijklmnopqrstuvwxyz")
+	if f := file(under.FileID); f.FileSize != 4 || f.ScanStatus != aws_usages.ScanStatusRejected {
+		t.Errorf("file overwritten over quota = %+v", f)
+	}
+	if u := used(); u != 5 {
+		t.Errorf("usage after a refused overwrite = %v, want 5", u)
+	}
+
+	// deletes release what was charged
+	for _, fileID := range []string{under.FileID, over.FileID} {
+		if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+			t.Fatalf("delete: status %v", status)
+		}
+	}
+	if u := used(); u != 0 || usage.FileCount != 0 {
+		t.Errorf("usage after deletes = %+v", usage)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	setLimiter(ratelimit.Config{Burst: 2, PerMinute: 1})
+	defer setLimiter(ratelimit.Config{Burst: 1000, PerMinute: 1000})
+
+	const user = "busy-user"
+	token := issuer.Token(user)
+
+	for i := 0; i < 2; i++ {
+		request := upload_file.UploadFileRequest{FileName: fmt.Sprintf("a-%v.txt", i)}
+		if status := call(t, token, "POST", "/"+user, request, nil); status != 200 {
+			t.Fatalf("upload %v: status %v", i, status)
+		}
+	}
+
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", api.URL+"/"+user, strings.NewReader(`{"FileName":"a.txt"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("third upload = %v, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// other callers have their own bucket
+	if status := call(t, issuer.Token("idle-user"), "POST", "/idle-user", upload_file.UploadFileRequest{FileName: "a.txt"}, nil); status != 200 {
+		t.Errorf("other user upload: status %v", status)
+	}
+}
+
+func TestMalformedBodies(t *testing.T) {
+	const user = "malformed-user"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+	fileID := upload(t, token, user, "a.txt", "content")
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+	}{
+		{"upload not json", token, "POST", "/" + user, `FileName=a.txt`},
+		{"upload empty", token, "POST", "/" + user, ``},
+		{"upload without FileName", token, "POST", "/" + user, `{"FileSize":3}`},
+		{"upload negative size", token, "POST", "/" + user, `{"FileName":"a.txt","FileSize":-1}`},
+		{"upload size as string", token, "POST", "/" + user, `{"FileName":"a.txt","FileSize":"3"}`},
+		{"overwrite empty FileName", token, "PATCH", "/" + user + "/" + fileID, `{"FileName":""}`},
+		{"update quota negative", adminToken, "PUT", "/" + user + "/usage", `{"MaxBytes":-1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, api.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != 400 || !strings.HasPrefix(string(body), "invalid request body") {
+				t.Errorf("%v %v = %v %s, want 400", tt.method, tt.path, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocumentIsPublic(t *testing.T) {
+	resp, err := http.Get(api.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || resp.StatusCode != 200 || doc.OpenAPI == "" {
+		t.Errorf("GET /openapi.json = %v %+v %v", resp.StatusCode, doc, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	const user = "client-user"
+	ctx := context.Background()
+	c := client.New(api.URL, issuer.Token(user))
+	c.PageSize = 2
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		content := fmt.Sprintf("content %d", i)
+		id, err := c.Upload(ctx, user, client.UploadRequest{FileName: fmt.Sprintf("%d.txt", i)}, strings.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// pages hold at most two items of the whole table, most of them other users' files
+	files, err := c.List(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("listed %v files, want 5", len(files))
+	}
+
+	body, size, err := c.Download(ctx, user, ids[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(data) != "content 3" || size != int64(len(data)) {
+		t.Errorf("downloaded %q, size %v", data, size)
+	}
+
+	if err := c.Overwrite(ctx, user, ids[3], "renamed.txt", strings.NewReader("new content"), 11); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, user, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = c.List(ctx, user)
+	if err != nil || len(files) != 4 {
+		t.Fatalf("after delete listed %v files, %v", len(files), err)
+	}
+
+	other := client.New(api.URL, issuer.Token("client-stranger"))
+	if _, _, err := other.Download(ctx, user, ids[1]); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("stranger download = %v, want ErrForbidden", err)
+	}
+	if _, err := c.Upload(ctx, user, client.UploadRequest{}, strings.NewReader(""), 0); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("upload without name = %v, want ErrBadRequest", err)
+	}
+
+	admin := client.New(api.URL, issuer.Token("admin-user", auth.AdminGroup))
+	admin.PageSize = 3
+	all, err := admin.ListAll(ctx, client.ListAllOptions{UserID: user})
+	if err != nil || len(all) != 4 {
+		t.Errorf("admin listed %v files, %v", len(all), err)
+	}
+}
+
+func TestInvalidPageToken(t *testing.T) {
+	const user = "page-token-user"
+	token := issuer.Token(user)
+
+	if status := call(t, token, "GET", "/"+user+"?nextToken=%25%25", nil, nil); status != 400 {
+		t.Errorf("invalid nextToken: status %v", status)
+	}
+	if status := call(t, token, "GET", "/"+user+"?limit=0", nil, nil); status != 400 {
+		t.Errorf("limit=0: status %v", status)
+	}
+}
+
+// recorder collects audit entries in memory
+type recorder struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (r *recorder) Record(ctx context.Context, entry audit.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// actions returns the entries for action, in the order they were recorded
+func (r *recorder) actions(action string) []audit.Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []audit.Entry
+	for _, entry := range r.entries {
+		if entry.Action == action {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+func TestRename(t *testing.T) {
+	const user = "rename-user"
+	token := issuer.Token(user)
+
+	entries := &recorder{}
+	saved := audit.Default
+	audit.Default = entries
+	defer func() { audit.Default = saved }()
+
+	fileID := upload(t, token, user, "draft.txt", "contents")
+	otherID := upload(t, token, user, "reports/final.txt", "other")
+
+	var before []aws_usages.FileTableItem
+	call(t, token, "GET", "/"+user, nil, &before)
+
+	var renamed aws_usages.FileTableItem
+	if status := call(t, token, "POST", "/"+user+"/"+fileID+"/rename", map[string]string{"FileName": "reports/draft.txt"}, &renamed); status != 200 {
+		t.Fatalf("rename: status %v", status)
+	}
+	if renamed.FileID != fileID || renamed.FileName != "reports/draft.txt" {
+		t.Errorf("renamed = %+v", renamed)
+	}
+	for _, f := range before {
+		if f.FileID == fileID && f.Modified != renamed.Modified {
+			t.Errorf("rename changed Modified from %v to %v", f.Modified, renamed.Modified)
+		}
+	}
+
+	var down download_file.DownloadReturn
+	call(t, token, "GET", "/"+user+"/"+fileID, nil, &down)
+	if status, content := object(t, "GET", down.DownloadURL, ""); status != 200 || content != "contents" {
+		t.Errorf("GET renamed object = %v %q", status, content)
+	}
+
+	renames := entries.actions(audit.ActionRename)
+	if len(renames) != 1 {
+		t.Fatalf("audit entries = %+v", entries.entries)
+	}
+	entry := renames[0]
+	if entry.Action != audit.ActionRename || entry.Actor != user || entry.FileID != fileID ||
+		entry.Details["OldName"] != "draft.txt" || entry.Details["NewName"] != "reports/draft.txt" {
+		t.Errorf("audit entry = %+v", entry)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"taken in folder", token, "/" + user + "/" + fileID + "/rename", map[string]string{"FileName": "reports/final.txt"}, 409},
+		{"dot segment", token, "/" + user + "/" + fileID + "/rename", map[string]string{"FileName": "a/../b"}, 400},
+		{"forbidden character", token, "/" + user + "/" + fileID + "/rename", map[string]string{"FileName": "a:b"}, 400},
+		{"missing name", token, "/" + user + "/" + fileID + "/rename", map[string]string{}, 400},
+		{"missing file", token, "/" + user + "/no-such-file/rename", map[string]string{"FileName": "x.txt"}, 404},
+		{"another user's file", issuer.Token("rename-other"), "/rename-other/" + otherID + "/rename", map[string]string{"FileName": "x.txt"}, 404},
+		{"not the owner", issuer.Token("rename-other"), "/" + user + "/" + otherID + "/rename", map[string]string{"FileName": "x.txt"}, 403},
+	}
+	for _, tt := range tests {
+		if status := call(t, tt.token, "POST", tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%v: status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+
+	if renames := entries.actions(audit.ActionRename); len(renames) != 1 {
+		t.Errorf("failed renames were audited: %+v", renames[1:])
+	}
+}
+
+func TestUniqueFileNames(t *testing.T) {
+	const user = "names-user"
+	token := issuer.Token(user)
+
+	fileID := upload(t, token, user, "a.txt", "first")
+	if status := call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: "a.txt"}, nil); status != 409 {
+		t.Errorf("upload of a taken name: status %v", status)
+	}
+
+	// uploads and overwrites refuse the names renames do, before claiming them
+	for _, name := range []string{"a//b", "../x", "a\x00b", "what?", strings.Repeat("a/", 600) + "a"} {
+		if status := call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: name}, nil); status != 400 {
+			t.Errorf("upload of %q: status %v", name, status)
+		}
+		if status := call(t, token, "PATCH", "/"+user+"/"+fileID, overwrite_file.UploadFileRequest{FileName: name}, nil); status != 400 {
+			t.Errorf("overwrite to %q: status %v", name, status)
+		}
+	}
+
+	// racing uploads of one name: exactly one gets it
+	statuses := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", api.URL+"/"+user, strings.NewReader(`{"FileName":"race.txt"}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	created := 0
+	for status := range statuses {
+		switch status {
+		case 200:
+			created++
+		case 409:
+		default:
+			t.Errorf("racing upload: status %v", status)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%v racing uploads of one name succeeded", created)
+	}
+
+	// renaming and deleting give names up
+	if status := call(t, token, "POST", "/"+user+"/"+fileID+"/rename", map[string]string{"FileName": "b.txt"}, nil); status != 200 {
+		t.Fatalf("rename: status %v", status)
+	}
+	otherID := upload(t, token, user, "a.txt", "second")
+	if status := call(t, token, "POST", "/"+user+"/"+otherID+"/rename", map[string]string{"FileName": "b.txt"}, nil); status != 409 {
+		t.Errorf("rename onto a taken name: status %v", status)
+	}
+	if status := call(t, token, "PATCH", "/"+user+"/"+otherID, upload_file.UploadFileRequest{FileName: "b.txt"}, nil); status != 409 {
+		t.Errorf("overwrite onto a taken name: status %v", status)
+	}
+	if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+	if status := call(t, token, "POST", "/"+user+"/"+otherID+"/rename", map[string]string{"FileName": "b.txt"}, nil); status != 200 {
+		t.Errorf("rename onto a freed name: status %v", status)
+	}
+
+	// a file from before names were claimed can still be deleted, leaving the claim of the
+	// file that took its name since
+	legacy := aws_usages.FileTableItem{FileID: "names-user-legacy", UserID: user, FileName: "legacy.txt", Status: aws_usages.FileStatusActive}
+	if err := aws_usages.PutDynamoDB(context.Background(), "dev-files", legacy); err != nil {
+		t.Fatal(err)
+	}
+	upload(t, token, user, "legacy.txt", "claimed")
+	if status := call(t, token, "DELETE", "/"+user+"/"+legacy.FileID, nil, nil); status != 200 {
+		t.Fatalf("delete legacy file: status %v", status)
+	}
+	if status := call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: "legacy.txt"}, nil); status != 409 {
+		t.Errorf("upload of a name claimed after a legacy file: status %v", status)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	const user = "copy-user"
+	const other = "copy-other"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	entries := &recorder{}
+	saved := audit.Default
+	audit.Default = entries
+	defer func() { audit.Default = saved }()
+
+	fileID := upload(t, token, user, "docs/report.txt", "report contents")
+	copyPath := "/" + user + "/" + fileID + "/copy"
+
+	var duplicate aws_usages.FileTableItem
+	if status := call(t, token, "POST", copyPath, copy_file.CopyFileRequest{FileName: "report-2.txt"}, &duplicate); status != 200 {
+		t.Fatalf("copy: status %v", status)
+	}
+	if duplicate.FileID == fileID || duplicate.UserID != user || duplicate.FileName != "docs/report-2.txt" || duplicate.FileSize != int64(len("report contents")) {
+		t.Errorf("copy = %+v", duplicate)
+	}
+
+	var down download_file.DownloadReturn
+	call(t, token, "GET", "/"+user+"/"+duplicate.FileID, nil, &down)
+	if status, content := object(t, "GET", down.DownloadURL, ""); status != 200 || content != "report contents" {
+		t.Errorf("GET copied object = %v %q", status, content)
+	}
+
+	var usage struct {
+		UsedBytes int64 `json:"UsedBytes"`
+		FileCount int64 `json:"FileCount"`
+	}
+	call(t, token, "GET", "/"+user+"/usage", nil, &usage)
+	if usage.FileCount != 2 || usage.UsedBytes != 2*int64(len("report contents")) {
+		t.Errorf("usage after copy = %+v", usage)
+	}
+
+	// only someone who can act as both users may copy between them
+	if status := call(t, token, "POST", copyPath, copy_file.CopyFileRequest{TargetUserID: other}, nil); status != 403 {
+		t.Errorf("copy into another user's space: status %v", status)
+	}
+	var shared aws_usages.FileTableItem
+	if status := call(t, adminToken, "POST", copyPath, copy_file.CopyFileRequest{TargetUserID: other, Folder: "/"}, &shared); status != 200 {
+		t.Fatalf("admin copy to %v: status %v", other, status)
+	}
+	if shared.UserID != other || shared.FileName != "report.txt" {
+		t.Errorf("admin copy = %+v", shared)
+	}
+	call(t, issuer.Token(other), "GET", "/"+other+"/"+shared.FileID, nil, &down)
+	if status, content := object(t, "GET", down.DownloadURL, ""); status != 200 || content != "report contents" {
+		t.Errorf("GET object copied to %v = %v %q", other, status, content)
+	}
+
+	copies := entries.actions(audit.ActionCopy)
+	if len(copies) != 2 {
+		t.Fatalf("audit entries = %+v", entries.entries)
+	}
+	entry := copies[1]
+	if entry.Action != audit.ActionCopy || entry.Actor != "admin-user" || entry.TargetUser != other ||
+		entry.FileID != shared.FileID || entry.Details["SourceFileID"] != fileID {
+		t.Errorf("audit entry = %+v", entry)
+	}
+
+	// a record whose upload never arrived has nothing to copy, and is not charged twice
+	var pending upload_file.UploadFileReturn
+	call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: "never-uploaded.txt"}, &pending)
+
+	limits := map[string]int64{"MaxBytes": 40, "MaxFiles": 10}
+	if status := call(t, adminToken, "PUT", "/"+user+"/usage", limits, nil); status != 200 {
+		t.Fatalf("update quota: status %v", status)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   copy_file.CopyFileRequest
+		status int
+	}{
+		{"name taken", copyPath, copy_file.CopyFileRequest{}, 409},
+		{"invalid name", copyPath, copy_file.CopyFileRequest{FileName: "a:b"}, 400},
+		{"invalid folder", copyPath, copy_file.CopyFileRequest{Folder: "a/../b"}, 400},
+		{"over quota", copyPath, copy_file.CopyFileRequest{FileName: "report-3.txt"}, 413},
+		{"missing file", "/" + user + "/no-such-file/copy", copy_file.CopyFileRequest{}, 404},
+		{"another user's file", "/" + user + "/" + shared.FileID + "/copy", copy_file.CopyFileRequest{}, 404},
+		{"no content", "/" + user + "/" + pending.FileID + "/copy", copy_file.CopyFileRequest{FileName: "copy.txt"}, 409},
+	}
+	for _, tt := range tests {
+		if status := call(t, token, "POST", tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%v: status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+
+	call(t, token, "GET", "/"+user+"/usage", nil, &usage)
+	if usage.FileCount != 3 {
+		t.Errorf("file count after failed copies = %v, want 3", usage.FileCount)
+	}
+}
+
+func TestDownloadDisposition(t *testing.T) {
+	const user = "disposition-user"
+	token := issuer.Token(user)
+
+	pdfID := upload(t, token, user, "reports/Q1 report.pdf", "%PDF-1.4")
+	htmlID := upload(t, token, user, "page.html", "<script></script>")
+	disguisedID := upload(t, token, user, "photo.png", "<html><script></script>")
+
+	tests := []struct {
+		name        string
+		path        string
+		disposition string
+		contentType string
+	}{
+		{"default", "/" + user + "/" + pdfID, "attachment; filename*=UTF-8''Q1%20report.pdf", ""},
+		{"inline", "/" + user + "/" + pdfID + "?disposition=inline", "inline; filename*=UTF-8''Q1%20report.pdf", "application/pdf"},
+		{"inline not previewable", "/" + user + "/" + htmlID + "?disposition=inline", "attachment; filename*=UTF-8''page.html", ""},
+		{"inline content unlike its name", "/" + user + "/" + disguisedID + "?disposition=inline", "attachment; filename*=UTF-8''photo.png", ""},
+	}
+	for _, tt := range tests {
+		var down download_file.DownloadReturn
+		if status := call(t, token, "GET", tt.path, nil, &down); status != 200 {
+			t.Fatalf("%v: download status %v", tt.name, status)
+		}
+
+		resp, err := http.Get(down.DownloadURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Disposition"); resp.StatusCode != 200 || got != tt.disposition {
+			t.Errorf("%v: %v Content-Disposition %q, want %q", tt.name, resp.StatusCode, got, tt.disposition)
+		}
+		if got := resp.Header.Get("Content-Type"); tt.contentType != "" && got != tt.contentType {
+			t.Errorf("%v: Content-Type %q, want %q", tt.name, got, tt.contentType)
+		}
+	}
+
+	if status := call(t, token, "GET", "/"+user+"/"+pdfID+"?disposition=preview", nil, nil); status != 400 {
+		t.Errorf("invalid disposition: status %v", status)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	const user = "metrics-user"
+	token := issuer.Token(user)
+
+	upload(t, token, user, "a.txt", "12345")
+	upload(t, token, user, "b.txt", "123")
+	call(t, token, "GET", "/"+user+"/missing-file", nil, nil)
+
+	uploads := metrics.Dimensions{"Stage": "integration", "Route": "POST /{userId}"}
+	if sum := recorded.Sum("BytesUploaded", uploads); sum < 8 {
+		t.Errorf("BytesUploaded = %v, want at least 8", sum)
+	}
+	if points := recorded.Points("Latency", uploads); len(points) < 2 {
+		t.Errorf("upload latency points = %v", len(points))
+	}
+	if points := recorded.Points("Requests", metrics.Dimensions{"Route": "POST /{userId}", "StatusCode": "200"}); len(points) < 2 {
+		t.Errorf("upload 200 counts = %v", len(points))
+	}
+	if points := recorded.Points("DynamoDBLatency", metrics.Dimensions{"Route": "POST /{userId}", "Operation": "TransactWriteItems"}); len(points) == 0 {
+		t.Error("no DynamoDB latency recorded for uploads")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	const user = "tracing-user"
+	token := issuer.Token(user)
+
+	spans := tracetest.NewSpanRecorder()
+	saved := tracing.Default()
+	tracing.SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	defer tracing.SetDefault(saved)
+
+	upload(t, token, user, "traced.txt", "hello")
+
+	var root sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.Name() == "POST /{userId}" {
+			root = span
+		}
+	}
+	if root == nil {
+		t.Fatal("no root span for the upload")
+	}
+
+	var commit sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.Name() == "DynamoDB.TransactWriteItems" && span.Parent().SpanID() == root.SpanContext().SpanID() {
+			commit = span
+		}
+	}
+	if commit == nil {
+		t.Fatal("the quota transaction has no span under the upload's")
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range commit.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if tables := attrs["aws.dynamodb.table_names"].AsStringSlice(); len(tables) != 3 || tables[0] != "dev-files" || tables[1] != "dev-quotas" || tables[2] != "dev-filenames" {
+		t.Errorf("tables = %v", tables)
+	}
+	if keys := attrs[tracing.DynamoDBKeyKey].AsStringSlice(); len(keys) != 1 || keys[0] != "UserID="+user {
+		t.Errorf("keys = %v", keys)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	const user = "audited-user"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	fileID := upload(t, token, user, "ledger.csv", "a,b")
+	if status := call(t, token, "GET", "/"+user+"/"+fileID, nil, nil); status != 200 {
+		t.Fatalf("download: status %v", status)
+	}
+	if status := call(t, adminToken, "POST", "/"+user+"/"+fileID+"/rename", map[string]string{"FileName": "books.csv"}, nil); status != 200 {
+		t.Fatalf("rename: status %v", status)
+	}
+	if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+
+	var entries []audit.Entry
+	if status := call(t, adminToken, "GET", "/audit?fileId="+fileID, nil, &entries); status != 200 {
+		t.Fatalf("query by file: status %v", status)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if strings.Join(actions, ",") != "upload,download,rename,delete" {
+		t.Fatalf("actions = %v", actions)
+	}
+	if entries[2].Actor != "admin-user" || entries[2].TargetUser != user || entries[3].Details["FileName"] != "books.csv" {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	// a page at a time by user
+	req, _ := http.NewRequest("GET", api.URL+"/audit?userId="+user+"&limit=3", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page []audit.Entry
+	json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	next := resp.Header.Get("X-Next-Token")
+	if len(page) != 3 || next == "" {
+		t.Fatalf("first page: %v entries, next %q", len(page), next)
+	}
+	var rest []audit.Entry
+	if status := call(t, adminToken, "GET", "/audit?userId="+user+"&limit=3&nextToken="+next, nil, &rest); status != 200 || len(rest) != 1 || rest[0].Action != "delete" {
+		t.Errorf("second page: status %v, %+v", status, rest)
+	}
+
+	req, _ = http.NewRequest("GET", api.URL+"/audit?userId="+user+"&format=jsonl", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || len(lines) != 4 {
+		t.Fatalf("export: %v, %q", resp.Header.Get("Content-Type"), body)
+	}
+	var first audit.Entry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Action != "upload" || first.EntryID == "" {
+		t.Errorf("first line %q: %+v %v", lines[0], first, err)
+	}
+
+	if status := call(t, token, "GET", "/audit?userId="+user, nil, nil); status != 403 {
+		t.Errorf("non-admin query: status %v", status)
+	}
+	if status := call(t, adminToken, "GET", "/audit", nil, nil); status != 400 {
+		t.Errorf("query without filter: status %v", status)
+	}
+	if status := call(t, adminToken, "GET", "/audit?userId="+user+"&nextToken=bogus", nil, nil); status != 400 {
+		t.Errorf("invalid nextToken: status %v", status)
+	}
+}
+
+// queue keeps the deliveries Notify and the Deliverer send
+type queue struct {
+	mu   sync.Mutex
+	sent []queuedDelivery
+}
+
+type queuedDelivery struct {
+	delivery webhooks.Delivery
+	delay    time.Duration
+}
+
+var queued = &queue{}
+
+func (q *queue) Send(ctx context.Context, delivery webhooks.Delivery, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sent = append(q.sent, queuedDelivery{delivery, delay})
+	return nil
+}
+
+// take removes and returns the deliveries to webhookID
+func (q *queue) take(webhookID string) []queuedDelivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var taken, kept []queuedDelivery
+	for _, d := range q.sent {
+		if d.delivery.WebhookID == webhookID {
+			taken = append(taken, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	q.sent = kept
+
+	return taken
+}
+
+// receiver is a webhook endpoint that checks signatures and answers with status
+type receiver struct {
+	mu     sync.Mutex
+	secret string
+	status int
+	events []webhooks.Event
+	errors []error
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := webhooks.Verify(r.secret, req.Header, body, time.Minute); err != nil {
+		r.errors = append(r.errors, err)
+		w.WriteHeader(401)
+		return
+	}
+	var event webhooks.Event
+	if err := json.Unmarshal(body, &event); err != nil || req.Header.Get(webhooks.EventHeader) != event.Type {
+		r.errors = append(r.errors, fmt.Errorf("event %q: %v", body, err))
+	}
+	r.events = append(r.events, event)
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) types() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var types []string
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+func TestWebhooks(t *testing.T) {
+	const user = "webhook-user"
+	token := issuer.Token(user)
+	ctx := context.Background()
+
+	rcv := &receiver{secret: "integration-secret", status: 200}
+	endpoint := httptest.NewServer(rcv)
+	defer endpoint.Close()
+
+	var hook register_webhook.RegisterWebhookReturn
+	request := register_webhook.RegisterWebhookRequest{URL: endpoint.URL, Secret: rcv.secret}
+	if status := call(t, token, "POST", "/"+user+"/webhooks", request, &hook); status != 200 {
+		t.Fatalf("register: status %v", status)
+	}
+	if hook.WebhookID == "" || hook.Secret != rcv.secret {
+		t.Fatalf("registered %+v", hook)
+	}
+
+	for _, bad := range []register_webhook.RegisterWebhookRequest{
+		{URL: "ftp://example.com/hook"},
+		{URL: endpoint.URL, Events: []string{"file.shared"}},
+		{URL: endpoint.URL, Secret: "short"},
+	} {
+		if status := call(t, token, "POST", "/"+user+"/webhooks", bad, nil); status != 400 {
+			t.Errorf("register %+v: status %v", bad, status)
+		}
+	}
+
+	var generated register_webhook.RegisterWebhookReturn
+	request = register_webhook.RegisterWebhookRequest{URL: endpoint.URL, Events: []string{webhooks.EventFileDeleted}}
+	if status := call(t, token, "POST", "/"+user+"/webhooks", request, &generated); status != 200 || len(generated.Secret) < webhooks.MinSecretLength {
+		t.Fatalf("register with generated secret: status %v, %+v", status, generated)
+	}
+
+	var hooks []webhooks.Webhook
+	if status := call(t, token, "GET", "/"+user+"/webhooks", nil, &hooks); status != 200 || len(hooks) != 2 {
+		t.Fatalf("list: status %v, %+v", status, hooks)
+	}
+	if status := call(t, issuer.Token("someone-else"), "GET", "/"+user+"/webhooks", nil, nil); status != 403 {
+		t.Errorf("list as another user: status %v", status)
+	}
+
+	// an upload is created by the POST and committed by the PUT of its content
+	deliverer := webhooks.NewDeliverer(queued)
+	fileID := upload(t, token, user, "report.pdf", "%PDF-1.4")
+	for _, d := range queued.take(hook.WebhookID) {
+		if err := deliverer.Deliver(ctx, d.delivery); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rcv.types(); got != "file.created,file.committed" || len(rcv.errors) > 0 {
+		t.Fatalf("received %v, errors %v", got, rcv.errors)
+	}
+	if rcv.events[1].FileID != fileID || rcv.events[1].FileSize != 8 || rcv.events[1].FileName != "report.pdf" {
+		t.Errorf("committed event %+v", rcv.events[1])
+	}
+	if len(queued.take(generated.WebhookID)) != 0 {
+		t.Errorf("webhook subscribed to deletes only was sent other events")
+	}
+
+	// a failing endpoint is retried with growing delays and finally dead-lettered
+	rcv.mu.Lock()
+	rcv.status = 503
+	rcv.mu.Unlock()
+	if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+	if len(queued.take(generated.WebhookID)) != 1 {
+		t.Errorf("delete not queued for the deletes-only webhook")
+	}
+	pending := queued.take(hook.WebhookID)
+	var delays []time.Duration
+	for len(pending) > 0 {
+		d := pending[0]
+		delays = append(delays, d.delay)
+		if err := deliverer.Deliver(ctx, d.delivery); err != nil {
+			t.Fatal(err)
+		}
+		pending = queued.take(hook.WebhookID)
+	}
+	if len(delays) != webhooks.MaxAttempts || delays[0] != 0 || delays[1] != webhooks.BaseDelay || delays[2] != 2*webhooks.BaseDelay {
+		t.Errorf("attempt delays %v", delays)
+	}
+	if letters := dynamo.Items("dev-webhook-deadletters"); len(letters) != 1 || *letters[0]["EventType"].S != webhooks.EventFileDeleted {
+		t.Errorf("dead letters %v", letters)
+	}
+
+	// the history is newest first, a page at a time
+	var history []webhooks.Attempt
+	if status := call(t, token, "GET", "/"+user+"/webhooks/"+hook.WebhookID+"/deliveries", nil, &history); status != 200 {
+		t.Fatalf("history: status %v", status)
+	}
+	if len(history) != 2+webhooks.MaxAttempts {
+		t.Fatalf("history has %v attempts", len(history))
+	}
+	last, first := history[0], history[len(history)-1]
+	if last.Outcome != webhooks.OutcomeDeadLettered || last.StatusCode != 503 || last.Attempt != webhooks.MaxAttempts {
+		t.Errorf("last attempt %+v", last)
+	}
+	if history[1].Outcome != webhooks.OutcomeRetrying || history[1].NextRetry == "" {
+		t.Errorf("retried attempt %+v", history[1])
+	}
+	if first.Outcome != webhooks.OutcomeDelivered || first.EventType != webhooks.EventFileCreated {
+		t.Errorf("first attempt %+v", first)
+	}
+
+	req, _ := http.NewRequest("GET", api.URL+"/"+user+"/webhooks/"+hook.WebhookID+"/deliveries?limit=4", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page []webhooks.Attempt
+	json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	next := resp.Header.Get("X-Next-Token")
+	if len(page) != 4 || next == "" || page[0].DeliveryID != last.DeliveryID {
+		t.Fatalf("first page: %v attempts, next %q", len(page), next)
+	}
+	var rest []webhooks.Attempt
+	if status := call(t, token, "GET", "/"+user+"/webhooks/"+hook.WebhookID+"/deliveries?nextToken="+next, nil, &rest); status != 200 || len(rest) != len(history)-4 {
+		t.Errorf("second page: status %v, %v attempts", status, len(rest))
+	}
+	if status := call(t, token, "GET", "/"+user+"/webhooks/"+hook.WebhookID+"/deliveries?nextToken=bogus", nil, nil); status != 400 {
+		t.Errorf("invalid nextToken: status %v", status)
+	}
+	if status := call(t, issuer.Token("someone-else"), "GET", "/someone-else/webhooks/"+hook.WebhookID+"/deliveries", nil, nil); status != 404 {
+		t.Errorf("another user's history: status %v", status)
+	}
+
+	c := client.New(api.URL, token)
+	c.PageSize = 3
+	if attempts, err := c.WebhookDeliveries(ctx, user, hook.WebhookID); err != nil || len(attempts) != len(history) {
+		t.Errorf("client history: %v attempts, %v", len(attempts), err)
+	}
+
+	// once removed, a webhook is sent nothing more
+	if status := call(t, token, "DELETE", "/"+user+"/webhooks/"+hook.WebhookID, nil, nil); status != 204 {
+		t.Fatalf("delete webhook: status %v", status)
+	}
+	if status := call(t, token, "DELETE", "/"+user+"/webhooks/"+hook.WebhookID, nil, nil); status != 404 {
+		t.Errorf("delete webhook again: status %v", status)
+	}
+	upload(t, token, user, "after.txt", "x")
+	if len(queued.take(hook.WebhookID)) != 0 {
+		t.Errorf("removed webhook was sent events")
+	}
+	if err := c.DeleteWebhook(ctx, user, generated.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+	if remaining, err := c.Webhooks(ctx, user); err != nil || len(remaining) != 0 {
+		t.Errorf("webhooks after removing both: %+v, %v", remaining, err)
+	}
+}
+
+func TestFileEvents(t *testing.T) {
+	const user = "events-user"
+	token := issuer.Token(user)
+
+	sink := &fileevents.MemorySink{}
+	saved := fileevents.DefaultSink
+	fileevents.DefaultSink = sink
+	defer func() { fileevents.DefaultSink = saved }()
+
+	// start from this test's changes
+	dynamo.StreamRecords("dev-files")
+
+	fileID := upload(t, token, user, "draft.txt", "contents")
+	if status := call(t, token, "POST", "/"+user+"/"+fileID+"/rename", map[string]string{"FileName": "final.txt"}, nil); status != 200 {
+		t.Fatalf("rename: status %v", status)
+	}
+	if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+
+	records := dynamo.StreamRecords("dev-files")
+	if err := file_stream.Handler(context.Background(), events.DynamoDBEvent{Records: records}); err != nil {
+		t.Fatal(err)
+	}
+
+	var published []fileevents.FileEvent
+	for _, e := range sink.Take() {
+		if e.FileID == fileID {
+			published = append(published, e)
+		}
+	}
+	if len(published) < 3 {
+		t.Fatalf("published %+v", published)
+	}
+
+	first, last := published[0], published[len(published)-1]
+	if first.Type != fileevents.EventInserted || first.Old != nil || first.New.FileName != "draft.txt" || first.UserID != user {
+		t.Errorf("first event = %+v", first)
+	}
+	if last.Type != fileevents.EventRemoved || last.New != nil || last.Old.FileName != "final.txt" {
+		t.Errorf("last event = %+v", last)
+	}
+	renamed := false
+	for _, e := range published[1 : len(published)-1] {
+		if e.Type != fileevents.EventModified {
+			t.Errorf("unexpected %v between insert and remove", e.Type)
+		}
+		renamed = renamed || (e.Old.FileName == "draft.txt" && e.New.FileName == "final.txt")
+	}
+	if !renamed {
+		t.Errorf("no event for the rename in %+v", published)
+	}
+
+	// a failing sink fails the batch, so Lambda retries it
+	fileevents.DefaultSink = &fileevents.SNSSink{}
+	if err := file_stream.Handler(context.Background(), events.DynamoDBEvent{Records: records}); err == nil {
+		t.Error("batch succeeded without a topic to publish to")
+	}
+}
+
+func TestVirusScan(t *testing.T) {
+	const user = "scan-user"
+	token := issuer.Token(user)
+
+	files := func() map[string]aws_usages.FileTableItem {
+		var list []aws_usages.FileTableItem
+		call(t, token, "GET", "/"+user, nil, &list)
+		byID := map[string]aws_usages.FileTableItem{}
+		for _, f := range list {
+			byID[f.FileID] = f
+		}
+		return byID
+	}
+
+	cleanID := upload(t, token, user, "clean.txt", "hello")
+	infectedID := upload(t, token, user, "eicar.com", scan.EICAR)
+
+	var pending upload_file.UploadFileReturn
+	call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: "pending.txt", FileSize: 1}, &pending)
+
+	// the scanner fails, so the file stays scanning until it is scanned again
+	scan.DefaultScanner = scan.Fake{Err: errors.New("clamd unavailable")}
+	unscannedID := upload(t, token, user, "unlucky.txt", "hello")
+	scan.DefaultScanner = scan.Fake{}
+
+	// content over the scanner's limit gets a verdict of its own rather than staying scanning
+	scan.DefaultScanner = scan.Fake{MaxBytes: 8}
+	bigID := upload(t, token, user, "big.txt", "more than eight bytes")
+	scan.DefaultScanner = scan.Fake{}
+
+	// a file stored before scanning existed has no ScanStatus and is served as it was
+	legacy := aws_usages.FileTableItem{FileID: "scan-user-legacy", UserID: user, FileName: "legacy.txt", FileSize: 5}
+	if err := aws_usages.PutDynamoDB(context.Background(), "dev-files", legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Default().Put(context.Background(), legacy.FileID, []byte("hello"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	byID := files()
+	if f := byID[cleanID]; f.ScanStatus != aws_usages.ScanStatusClean || f.Scanned == "" {
+		t.Errorf("clean file = %+v", f)
+	}
+	if f := byID[infectedID]; f.ScanStatus != aws_usages.ScanStatusQuarantined || f.ScanSignature != scan.EICARSignature {
+		t.Errorf("infected file = %+v", f)
+	}
+	if f := byID[unscannedID]; f.ScanStatus != aws_usages.ScanStatusScanning {
+		t.Errorf("file whose scan failed = %+v", f)
+	}
+	if f := byID[bigID]; f.ScanStatus != aws_usages.ScanStatusTooLarge || f.Scanned == "" {
+		t.Errorf("file too large to scan = %+v", f)
+	}
+	if f := byID[pending.FileID]; f.ScanStatus != aws_usages.ScanStatusUnscanned {
+		t.Errorf("file without content = %+v", f)
+	}
+
+	tests := []struct {
+		name   string
+		fileID string
+		status int
+	}{
+		{"clean", cleanID, 200},
+		{"stored before scanning", legacy.FileID, 200},
+		{"quarantined", infectedID, 409},
+		{"scan failed", unscannedID, 409},
+		{"too large", bigID, 409},
+		{"no content", pending.FileID, 409},
+	}
+	for _, tt := range tests {
+		if status := call(t, token, "GET", "/"+user+"/"+tt.fileID, nil, nil); status != tt.status {
+			t.Errorf("download %v: status %v, want %v", tt.name, status, tt.status)
+		}
+		copyStatus := call(t, token, "POST", "/"+user+"/"+tt.fileID+"/copy", copy_file.CopyFileRequest{FileName: "copy of " + tt.name}, nil)
+		if copyStatus != tt.status {
+			t.Errorf("copy %v: status %v, want %v", tt.name, copyStatus, tt.status)
+		}
+	}
+
+	// a copy of a clean file is clean without being scanned
+	for _, f := range files() {
+		if f.FileName == "copy of clean" && f.ScanStatus != aws_usages.ScanStatusClean {
+			t.Errorf("copy = %+v", f)
+		}
+	}
+
+	// an overwrite whose content never arrives leaves the old content's verdict in place
+	var patch overwrite_file.PatchFileReturn
+	if status := call(t, token, "PATCH", "/"+user+"/"+cleanID, overwrite_file.UploadFileRequest{FileName: "clean.txt"}, &patch); status != 200 {
+		t.Fatalf("abandoned overwrite: status %v", status)
+	}
+	if f := files()[cleanID]; f.ScanStatus != aws_usages.ScanStatusClean || f.Scanned == "" || f.ContentType == "" {
+		t.Errorf("file after an abandoned overwrite = %+v", f)
+	}
+	if status := call(t, token, "GET", "/"+user+"/"+cleanID, nil, nil); status != 200 {
+		t.Errorf("download after an abandoned overwrite: status %v", status)
+	}
+
+	// overwriting with clean content rescans the file and releases it
+	if status := call(t, token, "PATCH", "/"+user+"/"+infectedID, overwrite_file.UploadFileRequest{FileName: "fixed.txt"}, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	if f := files()[infectedID]; f.ScanStatus != aws_usages.ScanStatusQuarantined {
+		t.Errorf("file awaiting its new content = %+v", f)
+	}
+	object(t, "PUT", patch.PostURL, "fixed")
+	if f := files()[infectedID]; f.ScanStatus != aws_usages.ScanStatusClean || f.ScanSignature != "" || f.ContentType != "text/plain" {
+		t.Errorf("overwritten file = %+v", f)
+	}
+	if status := call(t, token, "GET", "/"+user+"/"+infectedID, nil, nil); status != 200 {
+		t.Errorf("download after overwrite: status %v", status)
+	}
+}
+
+// copyHook runs during at the start of each Copy, as if another request got in between
+type copyHook struct {
+	storage.Storage
+	during func()
+}
+
+func (c copyHook) Copy(ctx context.Context, src string, dst string) error {
+	c.during()
+	return c.Storage.Copy(ctx, src, dst)
+}
+
+func TestCopyDuringRescan(t *testing.T) {
+	const user = "rescan-user"
+	token := issuer.Token(user)
+
+	fileID := upload(t, token, user, "clean.txt", "hello")
+	type usage struct {
+		UsedBytes int64
+		FileCount int64
+	}
+	var before usage
+	call(t, token, "GET", "/"+user+"/usage", nil, &before)
+
+	// the file is overwritten while it is copied, so the verdict copy_file read is stale
+	saved := storage.Default()
+	storage.SetDefault(copyHook{Storage: saved, during: func() {
+		if err := aws_usages.SetScanStatusDynamoDB(context.Background(), "dev-files", fileID, aws_usages.ScanStatusScanning, "", ""); err != nil {
+			t.Error(err)
+		}
+	}})
+	status := call(t, token, "POST", "/"+user+"/"+fileID+"/copy", copy_file.CopyFileRequest{FileName: "copy.txt"}, nil)
+	storage.SetDefault(saved)
+	if status != 409 {
+		t.Errorf("copy during rescan: status %v", status)
+	}
+
+	var files []aws_usages.FileTableItem
+	call(t, token, "GET", "/"+user, nil, &files)
+	if len(files) != 1 {
+		t.Errorf("files after a refused copy = %+v", files)
+	}
+	var after usage
+	call(t, token, "GET", "/"+user+"/usage", nil, &after)
+	if after.UsedBytes != before.UsedBytes || after.FileCount != before.FileCount {
+		t.Errorf("usage after a refused copy = %+v, want %+v", after, before)
+	}
+}
+
+func TestThumbnails(t *testing.T) {
+	const user = "thumbnail-user"
+	token := issuer.Token(user)
+
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 800; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	imageID := upload(t, token, user, "photo.png", buf.String())
+	textID := upload(t, token, user, "notes.txt", "not an image")
+	infectedID := upload(t, token, user, "eicar.png", scan.EICAR)
+
+	item, err := aws_usages.GetFileDynamoDB(context.Background(), "dev-files", imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(item.Thumbnails) != len(thumbnail.Sizes) {
+		t.Fatalf("image thumbnails = %+v", item.Thumbnails)
+	}
+
+	want := map[string][2]int{"small": {128, 64}, "medium": {512, 256}, "large": {800, 400}}
+	for _, size := range []string{"", "small", "medium", "large"} {
+		var thumb get_thumbnail.ThumbnailReturn
+		path := "/" + user + "/" + imageID + "/thumbnail"
+		if size != "" {
+			path += "?size=" + size
+		}
+		if status := call(t, token, "GET", path, nil, &thumb); status != 200 {
+			t.Errorf("thumbnail %q: status %v", size, status)
+			continue
+		}
+		if size == "" && thumb.Size != thumbnail.DefaultSize {
+			t.Errorf("default thumbnail is %v, want %v", thumb.Size, thumbnail.DefaultSize)
+		}
+		if dims := want[thumb.Size]; thumb.Width != dims[0] || thumb.Height != dims[1] || thumb.ContentType != "image/jpeg" {
+			t.Errorf("thumbnail %q = %+v", size, thumb)
+		}
+
+		status, content := object(t, "GET", thumb.ThumbnailURL, "")
+		if status != 200 {
+			t.Errorf("GET thumbnail %q: status %v", size, status)
+			continue
+		}
+		if config, format, err := image.DecodeConfig(strings.NewReader(content)); err != nil || format != "jpeg" || config.Width != thumb.Width {
+			t.Errorf("thumbnail %q content: %v %+v %v", size, format, config, err)
+		}
+	}
+
+	// a copy gets renditions of its own rather than being left without thumbnails
+	var copied aws_usages.FileTableItem
+	if status := call(t, token, "POST", "/"+user+"/"+imageID+"/copy", copy_file.CopyFileRequest{FileName: "photo copy.png"}, &copied); status != 200 {
+		t.Fatalf("copy: status %v", status)
+	}
+	if len(copied.Thumbnails) != len(thumbnail.Sizes) {
+		t.Errorf("copy's thumbnails = %+v", copied.Thumbnails)
+	}
+	if item, err := aws_usages.GetFileDynamoDB(context.Background(), "dev-files", copied.FileID); err != nil || len(item.Thumbnails) != len(thumbnail.Sizes) {
+		t.Errorf("copy's recorded thumbnails = %+v, %v", item, err)
+	}
+	copyRenditions := func(when string) {
+		for _, size := range thumbnail.Sizes {
+			reader, err := storage.Default().Open(context.Background(), thumbnail.Key(copied.FileID, size.Name))
+			if err != nil {
+				t.Errorf("copy's %v rendition %v: %v", size.Name, when, err)
+				continue
+			}
+			reader.Close()
+		}
+	}
+	copyRenditions("after copying")
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"not an image", "/" + user + "/" + textID + "/thumbnail", 404},
+		{"quarantined", "/" + user + "/" + infectedID + "/thumbnail", 409},
+		{"unknown size", "/" + user + "/" + imageID + "/thumbnail?size=huge", 400},
+		{"missing file", "/" + user + "/nope/thumbnail", 404},
+		{"another user's", "/other-user/" + imageID + "/thumbnail", 403},
+	}
+	for _, tt := range tests {
+		if status := call(t, token, "GET", tt.path, nil, nil); status != tt.status {
+			t.Errorf("%v: status %v, want %v", tt.name, status, tt.status)
+		}
+	}
+
+	// overwriting with content that is not an image removes the thumbnails
+	var patch overwrite_file.PatchFileReturn
+	if status := call(t, token, "PATCH", "/"+user+"/"+imageID, overwrite_file.UploadFileRequest{FileName: "photo.txt"}, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	object(t, "PUT", patch.PostURL, "now text")
+	if item, _ := aws_usages.GetFileDynamoDB(context.Background(), "dev-files", imageID); len(item.Thumbnails) != 0 {
+		t.Errorf("thumbnails after overwrite = %+v", item.Thumbnails)
+	}
+	if status := call(t, token, "GET", "/"+user+"/"+imageID+"/thumbnail", nil, nil); status != 404 {
+		t.Errorf("thumbnail after overwrite: status %v", status)
+	}
+	for _, size := range thumbnail.Sizes {
+		if _, err := storage.Default().Open(context.Background(), thumbnail.Key(imageID, size.Name)); err != storage.ErrObjectNotFound {
+			t.Errorf("%v rendition after overwrite: %v", size.Name, err)
+		}
+	}
+	copyRenditions("after the source was overwritten")
+
+	// deleting an image removes its renditions with it
+	otherID := upload(t, token, user, "again.png", buf.String())
+	if status := call(t, token, "DELETE", "/"+user+"/"+otherID, nil, nil); status != 200 {
+		t.Fatalf("delete: status %v", status)
+	}
+	for _, size := range thumbnail.Sizes {
+		if _, err := storage.Default().Open(context.Background(), thumbnail.Key(otherID, size.Name)); err != storage.ErrObjectNotFound {
+			t.Errorf("%v rendition after delete: %v", size.Name, err)
+		}
+	}
+}
+
+func TestUploadPolicy(t *testing.T) {
+	const user = "policy-user"
+	token := issuer.Token(user)
+
+	defer func(policy contenttype.Policy) { contenttype.DefaultPolicy = policy }(contenttype.DefaultPolicy)
+	contenttype.DefaultPolicy = contenttype.Policy{
+		DenyTypes:      []string{"application/vnd.microsoft.portable-executable", "application/x-elf"},
+		DenyExtensions: []string{"exe", "dll"},
+	}
+
+	item := func(fileID string) aws_usages.FileTableItem {
+		t.Helper()
+		item, err := aws_usages.GetFileDynamoDB(context.Background(), "dev-files", fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *item
+	}
+
+	// denied names are refused before an upload URL is signed
+	notesID := upload(t, token, user, "notes.txt", "hello")
+	refused := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"upload", "POST", "/" + user, upload_file.UploadFileRequest{FileName: "setup.exe", FileSize: 2}},
+		{"upload with a trailing dot", "POST", "/" + user, upload_file.UploadFileRequest{FileName: "setup.exe.", FileSize: 2}},
+		{"overwrite", "PATCH", "/" + user + "/" + notesID, overwrite_file.UploadFileRequest{FileName: "notes.dll"}},
+		{"rename", "POST", "/" + user + "/" + notesID + "/rename", map[string]string{"FileName": "notes.exe"}},
+		{"copy", "POST", "/" + user + "/" + notesID + "/copy", copy_file.CopyFileRequest{FileName: "copy.exe"}},
+	}
+	for _, tt := range refused {
+		if status := call(t, token, tt.method, tt.path, tt.body, nil); status != 415 {
+			t.Errorf("%v: status %v, want 415", tt.name, status)
+		}
+	}
+
+	if f := item(notesID); f.ContentType != "text/plain" || f.ScanStatus != aws_usages.ScanStatusClean {
+		t.Errorf("allowed file = %+v", f)
+	}
+
+	// content of a denied type is rejected whatever it is called, and deleted
+	disguisedID := upload(t, token, user, "photo.jpg", "MZ\x90\x00 this program cannot be run in DOS mode")
+	f := item(disguisedID)
+	if f.ScanStatus != aws_usages.ScanStatusRejected || f.ContentType != "application/vnd.microsoft.portable-executable" || !strings.Contains(f.ScanSignature, "not allowed") {
+		t.Errorf("rejected file = %+v", f)
+	}
+	if _, err := storage.Default().Open(context.Background(), disguisedID); err != storage.ErrObjectNotFound {
+		t.Errorf("rejected content: %v", err)
+	}
+	if status := call(t, token, "GET", "/"+user+"/"+disguisedID, nil, nil); status != 409 {
+		t.Errorf("download of rejected file: status %v", status)
+	}
+	if status := call(t, token, "POST", "/"+user+"/"+disguisedID+"/copy", copy_file.CopyFileRequest{FileName: "copy.jpg"}, nil); status != 409 {
+		t.Errorf("copy of rejected file: status %v", status)
+	}
+
+	// overwriting an allowed file with denied content rejects it too
+	var patch overwrite_file.PatchFileReturn
+	if status := call(t, token, "PATCH", "/"+user+"/"+notesID, overwrite_file.UploadFileRequest{FileName: "notes.txt"}, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	object(t, "PUT", patch.PostURL, "\x7fELF\x02\x01\x01")
+	if f := item(notesID); f.ScanStatus != aws_usages.ScanStatusRejected || f.ContentType != "application/x-elf" {
+		t.Errorf("overwritten file = %+v", f)
+	}
+
+	// a rejected file can still be deleted, freeing its quota
+	if status := call(t, token, "DELETE", "/"+user+"/"+disguisedID, nil, nil); status != 200 {
+		t.Errorf("delete of rejected file: status %v", status)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	const user = "dedup-user"
+	token := issuer.Token(user)
+	ctx := context.Background()
+
+	digest := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	declare := func(token string, userID string, name string, content string) upload_file.UploadFileReturn {
+		t.Helper()
+		var up upload_file.UploadFileReturn
+		request := upload_file.UploadFileRequest{FileName: name, FileSize: int64(len(content)), SHA256: digest(content)}
+		if status := call(t, token, "POST", "/"+userID, request, &up); status != 200 {
+			t.Fatalf("upload %v: status %v", name, status)
+		}
+		if up.UploadURL != "" {
+			if status, _ := object(t, "PUT", up.UploadURL, content); status != 200 {
+				t.Fatalf("PUT %v: status %v", name, status)
+			}
+		}
+		return up
+	}
+	item := func(fileID string) aws_usages.FileTableItem {
+		t.Helper()
+		item, err := aws_usages.GetFileDynamoDB(ctx, "dev-files", fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *item
+	}
+	download := func(fileID string) string {
+		t.Helper()
+		var down download_file.DownloadReturn
+		if status := call(t, token, "GET", "/"+user+"/"+fileID, nil, &down); status != 200 {
+			t.Fatalf("download %v: status %v", fileID, status)
+		}
+		_, content := object(t, "GET", down.DownloadURL, "")
+		return content
+	}
+	refs := func(content string) int64 {
+		t.Helper()
+		blob, err := aws_usages.GetBlobDynamoDB(ctx, "dev-blobs", user, digest(content))
+		if err == aws_usages.ErrBlobNotFound {
+			return 0
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob.RefCount
+	}
+
+	// the first upload stores the content, which then moves into a blob
+	const content = "the same report, uploaded again and again"
+	first := declare(token, user, "report.txt", content)
+	if first.Deduplicated || first.UploadURL == "" {
+		t.Fatalf("first upload = %+v", first)
+	}
+	blobKey := item(first.FileID).BlobKey
+	if !strings.HasPrefix(blobKey, "blob_") || refs(content) != 1 {
+		t.Fatalf("first upload item = %+v", item(first.FileID))
+	}
+	if _, err := storage.Default().Open(ctx, first.FileID); err != storage.ErrObjectNotFound {
+		t.Errorf("the file's own copy was kept: %v", err)
+	}
+
+	// the second points at the blob without an upload URL
+	second := declare(token, user, "report copy.txt", content)
+	if !second.Deduplicated || second.UploadURL != "" {
+		t.Fatalf("second upload = %+v", second)
+	}
+	if f := item(second.FileID); f.BlobKey != blobKey || f.ScanStatus != aws_usages.ScanStatusClean || f.FileSize != int64(len(content)) {
+		t.Errorf("deduplicated item = %+v", f)
+	}
+	if got := download(second.FileID); got != content {
+		t.Errorf("deduplicated download = %q", got)
+	}
+	if n := refs(content); n != 2 {
+		t.Errorf("references after second upload = %v", n)
+	}
+
+	// both files count against the quota, as if each had its own copy
+	usage, err := aws_usages.GetQuotaDynamoDB(ctx, "dev-quotas", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.FileCount != 2 || usage.UsedBytes != 2*int64(len(content)) {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	// blobs are per user, so another user's identical upload is stored again
+	if other := declare(issuer.Token("dedup-other"), "dedup-other", "report.txt", content); other.Deduplicated || other.UploadURL == "" {
+		t.Errorf("another user's upload = %+v", other)
+	}
+
+	// a copy shares the blob too
+	var copied aws_usages.FileTableItem
+	if status := call(t, token, "POST", "/"+user+"/"+first.FileID+"/copy", copy_file.CopyFileRequest{FileName: "report 2.txt"}, &copied); status != 200 {
+		t.Fatalf("copy: status %v", status)
+	}
+	if copied.BlobKey != blobKey || refs(content) != 3 {
+		t.Errorf("copy = %+v", copied)
+	}
+
+	// overwriting gives the file its own content and gives up its reference
+	var patch overwrite_file.PatchFileReturn
+	if status := call(t, token, "PATCH", "/"+user+"/"+second.FileID, overwrite_file.UploadFileRequest{FileName: "report copy.txt"}, &patch); status != 200 {
+		t.Fatalf("overwrite: status %v", status)
+	}
+	object(t, "PUT", patch.PostURL, "edited")
+	if f := item(second.FileID); f.BlobKey != "" || f.SHA256 != "" || f.ScanStatus != aws_usages.ScanStatusClean {
+		t.Errorf("overwritten item = %+v", f)
+	}
+	if got := download(second.FileID); got != "edited" {
+		t.Errorf("overwritten download = %q", got)
+	}
+	if got := download(first.FileID); got != content {
+		t.Errorf("download after overwriting another reference = %q", got)
+	}
+	if n := refs(content); n != 2 {
+		t.Errorf("references after overwrite = %v", n)
+	}
+
+	// the blob goes with its last file
+	for _, fileID := range []string{first.FileID, copied.FileID} {
+		if status := call(t, token, "DELETE", "/"+user+"/"+fileID, nil, nil); status != 200 {
+			t.Fatalf("delete: status %v", status)
+		}
+		if _, err := storage.Default().Open(ctx, blobKey); (err == nil) != (fileID == first.FileID) {
+			t.Errorf("blob content after deleting %v: %v", fileID, err)
+		}
+	}
+	if n := refs(content); n != 0 {
+		t.Errorf("references after deleting every file = %v", n)
+	}
+
+	// content that does not match its declared digest is rejected and deleted
+	var up upload_file.UploadFileReturn
+	request := upload_file.UploadFileRequest{FileName: "liar.txt", FileSize: 5, SHA256: digest("hello")}
+	if status := call(t, token, "POST", "/"+user, request, &up); status != 200 {
+		t.Fatalf("upload: status %v", status)
+	}
+	object(t, "PUT", up.UploadURL, "howdy")
+	if f := item(up.FileID); f.ScanStatus != aws_usages.ScanStatusRejected || f.BlobKey != "" || !strings.Contains(f.ScanSignature, "SHA-256") {
+		t.Errorf("mismatched item = %+v", f)
+	}
+	if n := refs("hello"); n != 0 {
+		t.Errorf("mismatched content was shared %v times", n)
+	}
+
+	bad := upload_file.UploadFileRequest{FileName: "a.txt", SHA256: strings.ToUpper(digest("hello"))}
+	if status := call(t, token, "POST", "/"+user, bad, nil); status != 400 {
+		t.Errorf("uppercase digest: status %v", status)
+	}
+
+	// a deduplicated image shares its blob's thumbnails
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	declare(token, user, "a.png", buf.String())
+	again := declare(token, user, "b.png", buf.String())
+	var thumb get_thumbnail.ThumbnailReturn
+	if status := call(t, token, "GET", "/"+user+"/"+again.FileID+"/thumbnail?size=small", nil, &thumb); status != 200 {
+		t.Fatalf("thumbnail: status %v", status)
+	}
+	if status, data := object(t, "GET", thumb.ThumbnailURL, ""); status != 200 || len(data) == 0 {
+		t.Errorf("GET thumbnail: status %v", status)
+	}
+}
+
+func TestListAllStatusOptions(t *testing.T) {
+	const user = "status-user"
+	token := issuer.Token(user)
+	adminToken := issuer.Token("admin-user", auth.AdminGroup)
+
+	activeID := upload(t, token, user, "active.txt", "stored")
+
+	// an upload whose content has not been PUT yet is pending
+	var pending upload_file.UploadFileReturn
+	if status := call(t, token, "POST", "/"+user, upload_file.UploadFileRequest{FileName: "pending.txt", FileSize: 4}, &pending); status != 200 {
+		t.Fatalf("upload: status %v", status)
+	}
+
+	// nothing trashes files through the API yet, so put one in place
+	trashed := aws_usages.FileTableItem{FileID: "status-user-trashed", UserID: user, FileName: "trashed.txt", Status: aws_usages.FileStatusTrashed}
+	if err := aws_usages.PutDynamoDB(context.Background(), "dev-files", trashed); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) map[string]string {
+		t.Helper()
+		var files []aws_usages.FileTableItem
+		if status := call(t, adminToken, "GET", "/?userId="+user+query, nil, &files); status != 200 {
+			t.Fatalf("list %q: status %v", query, status)
+		}
+		statuses := map[string]string{}
+		for _, f := range files {
+			statuses[f.FileID] = f.FileStatus()
+		}
+		return statuses
+	}
+
+	tests := []struct {
+		query string
+		want  map[string]string
+	}{
+		{"", map[string]string{activeID: "active"}},
+		{"&includePending=true", map[string]string{activeID: "active", pending.FileID: "pending"}},
+		{"&includeTrashed=true", map[string]string{activeID: "active", trashed.FileID: "trashed"}},
+		{"&includePending=true&includeTrashed=true", map[string]string{activeID: "active", pending.FileID: "pending", trashed.FileID: "trashed"}},
+	}
+	for _, tt := range tests {
+		if got := list(tt.query); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("list %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// a pending file cannot be copied, and becomes active when its content arrives
+	if status := call(t, token, "POST", "/"+user+"/"+pending.FileID+"/copy", copy_file.CopyFileRequest{FileName: "copy.txt"}, nil); status != 409 {
+		t.Errorf("copy of pending file: status %v", status)
+	}
+	object(t, "PUT", pending.UploadURL, "data")
+	if got := list(""); got[pending.FileID] != "active" {
+		t.Errorf("after its content arrived the upload is %q", got[pending.FileID])
+	}
+}
@@ -2,59 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/url"
 
-	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_files"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-// https://serverless.com/framework/docs/providers/aws/events/apigateway/#lambda-proxy-integration
-type Response events.APIGatewayProxyResponse
-
-type ListFilesReturn struct {
-	Files []aws_usages.FileTableItem `json:"Files"`
-}
-
-// Handler is our lambda handler invoked by the `lambda.Start` function call
-func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
-	// Get the file from the request, and get the UserID from the request
-	userIdRaw, found := request.PathParameters["userId"]
-	var userId string
-	if found {
-		value, err := url.QueryUnescape(userIdRaw)
-		if nil != err {
-			return Response{StatusCode: 500},
-				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v\n", userIdRaw, err)
-		}
-
-		userId = value
-	} else {
-		return Response{StatusCode: 500}, fmt.Errorf("no userId found???\n")
-	}
-
-	tableItems, err := aws_usages.ListFilesDynamoDB("dev-files", userId)
-	if err != nil {
-		return Response{StatusCode: 500}, err
-	}
-
-	js, err := json.Marshal(tableItems)
-	if err != nil {
-		return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL\n")
-	}
-
-	return Response{
-		StatusCode:      200,
-		IsBase64Encoded: false,
-		Headers: map[string]string{
-			"Access-Control-Allow-Origin": "*",
-		},
-		Body: string(js),
-	}, nil
-}
-
 func main() {
-	lambda.Start(Handler)
+	lambda.Start(instrument.Function("GET /{userId}", func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		resp, err := list_files.Handler(ctx, r)
+		return events.APIGatewayProxyResponse(resp), err
+	}))
 }
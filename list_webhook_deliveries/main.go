@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_webhook_deliveries"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	lambda.Start(instrument.Function("GET /{userId}/webhooks/{webhookId}/deliveries", func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		resp, err := list_webhook_deliveries.Handler(ctx, r)
+		return events.APIGatewayProxyResponse(resp), err
+	}))
+}
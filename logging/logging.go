@@ -0,0 +1,209 @@
+// Package logging writes structured JSON log lines in the style of log/slog, which the
+// go1.16 toolchain this module targets does not have. Each line is one object:
+//
+//	{"time":"2021-10-19T17:04:05.123Z","level":"INFO","msg":"request completed","route":"GET /{userId}","status":200}
+//
+// CloudWatch Logs Insights discovers the fields of JSON lines automatically.
+// Handlers log through the Logger that router.Instrument puts in their context, which
+// already carries the request ID, correlation ID, route, user ID and file ID.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is a log line's severity
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l >= LevelError:
+		return "ERROR"
+	case l >= LevelWarn:
+		return "WARN"
+	case l >= LevelInfo:
+		return "INFO"
+	}
+	return "DEBUG"
+}
+
+// ParseLevel reads a level name as LOG_LEVEL spells it, case insensitively
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO", "":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// output serializes lines from every Logger writing to the same place
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	now   func() time.Time
+}
+
+// Logger writes lines at or above its output's level, each carrying the logger's
+// attributes followed by the call's. Attributes are alternating keys and values.
+type Logger struct {
+	out   *output
+	attrs []interface{}
+}
+
+// New returns a logger writing lines at level and above to w
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, level: level, now: time.Now}}
+}
+
+// With returns a logger that adds args to every line, sharing l's output
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := make([]interface{}, 0, len(l.attrs)+len(args))
+	attrs = append(attrs, l.attrs...)
+	attrs = append(attrs, args...)
+
+	return &Logger{out: l.out, attrs: attrs}
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(LevelDebug, msg, args) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.log(LevelInfo, msg, args) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.log(LevelWarn, msg, args) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(LevelError, msg, args) }
+
+// Enabled reports whether lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	line := &lineBuilder{}
+	line.add("time", l.out.now().UTC().Format(time.RFC3339Nano))
+	line.add("level", level.String())
+	line.add("msg", msg)
+	line.addPairs(l.attrs)
+	line.addPairs(args)
+	line.buf.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	io.WriteString(l.out.w, line.buf.String())
+}
+
+// lineBuilder writes a JSON object field by field, keeping the order keys were given in
+type lineBuilder struct {
+	buf strings.Builder
+}
+
+func (b *lineBuilder) add(key string, value interface{}) {
+	if b.buf.Len() == 0 {
+		b.buf.WriteString("{")
+	} else {
+		b.buf.WriteString(",")
+	}
+
+	k, _ := json.Marshal(key)
+	b.buf.Write(k)
+	b.buf.WriteString(":")
+
+	v, err := json.Marshal(jsonValue(value))
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	b.buf.Write(v)
+}
+
+// addPairs adds alternating keys and values; a key without a value is logged under !BADKEY like slog does
+func (b *lineBuilder) addPairs(args []interface{}) {
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			b.add("!BADKEY", args[i])
+			i--
+			continue
+		}
+		b.add(key, args[i+1])
+	}
+}
+
+// jsonValue turns values JSON would mangle into something readable: errors into their message,
+// times into RFC 3339 and durations into milliseconds
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return strings.TrimSpace(v.Error())
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case time.Duration:
+		return float64(v) / float64(time.Millisecond)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultLogger = New(os.Stdout, levelFromEnv())
+)
+
+// levelFromEnv reads LOG_LEVEL, defaulting to INFO
+func levelFromEnv() Level {
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring LOG_LEVEL: %v\n", err)
+	}
+	return level
+}
+
+// Default is the process-wide logger, writing to stdout where Lambda ships it to CloudWatch
+func Default() *Logger {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the process-wide logger, e.g. in tests
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the context's logger, or Default outside a request
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
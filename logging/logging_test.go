@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := New(&buf, level)
+	l.out.now = func() time.Time { return time.Date(2021, 10, 19, 17, 4, 5, 0, time.UTC) }
+	return l, &buf
+}
+
+func TestJSONLines(t *testing.T) {
+	l, buf := newTestLogger(LevelInfo)
+
+	l.With("route", "GET /{userId}").Error("request failed", "status", 500, "error", errors.New("GetItem error: boom\n"), "took", 1500*time.Microsecond, "dangling")
+	l.Debug("not written")
+
+	want := `{"time":"2021-10-19T17:04:05Z","level":"ERROR","msg":"request failed","route":"GET /{userId}","status":500,"error":"GetItem error: boom","took":1.5,"!BADKEY":"dangling"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got  %s\nwant %s", buf.String(), want)
+	}
+}
+
+func TestWithDoesNotShareAttributes(t *testing.T) {
+	l, buf := newTestLogger(LevelDebug)
+
+	base := l.With("a", 1)
+	base.With("b", 2).Info("first")
+	base.With("c", 3).Info("second")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var second map[string]interface{}
+	json.Unmarshal([]byte(lines[1]), &second)
+	if _, found := second["b"]; found || second["c"] != 3.0 || second["a"] != 1.0 {
+		t.Errorf("second line = %v", lines[1])
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	l, buf := newTestLogger(LevelInfo)
+	saved := Default()
+	SetDefault(l)
+	defer SetDefault(saved)
+
+	request := events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"x-correlation-id": "client-123"},
+		PathParameters: map[string]string{"userId": "u1", "fileId": "f1"},
+	}
+	request.RequestContext.RequestID = "req-1"
+
+	ctx, _, id := ForRequest(context.Background(), request, "GET /{userId}/{fileId}")
+	if id != "client-123" {
+		t.Errorf("correlation ID = %v", id)
+	}
+	FromContext(ctx).Info("hello")
+
+	var line map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &line)
+	for k, v := range map[string]string{"requestId": "req-1", "correlationId": "client-123", "route": "GET /{userId}/{fileId}", "userId": "u1", "fileId": "f1"} {
+		if line[k] != v {
+			t.Errorf("%v = %v, want %v", k, line[k], v)
+		}
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	request := events.APIGatewayProxyRequest{Headers: map[string]string{"X-Correlation-ID": "bad id\n{}"}}
+	request.RequestContext.RequestID = "req-1"
+	if id := CorrelationID(request); id != "req-1" {
+		t.Errorf("malformed header: %v, want the request ID", id)
+	}
+
+	if id := CorrelationID(events.APIGatewayProxyRequest{}); len(id) != 36 {
+		t.Errorf("generated ID = %q", id)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": LevelDebug, "": LevelInfo, "Warning": LevelWarn, "ERROR": LevelError} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel(loud) succeeded")
+	}
+}
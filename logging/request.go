@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// CorrelationIDHeader carries an ID that ties together the log lines of one client action
+// across requests. A caller may send one; otherwise the request gets a fresh one. Either
+// way it is returned in the response.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+var validCorrelationID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// CorrelationID is the request's X-Correlation-ID when it is well formed, or else its
+// API Gateway request ID, or a new UUID when there is neither
+func CorrelationID(request events.APIGatewayProxyRequest) string {
+	for name, value := range request.Headers {
+		if strings.EqualFold(name, CorrelationIDHeader) && validCorrelationID.MatchString(value) {
+			return value
+		}
+	}
+
+	if id := request.RequestContext.RequestID; id != "" {
+		return id
+	}
+
+	return uuid.New().String()
+}
+
+// ForRequest returns a context whose logger carries the request's IDs and route, and the
+// correlation ID it used
+func ForRequest(ctx context.Context, request events.APIGatewayProxyRequest, route string) (context.Context, *Logger, string) {
+	correlationID := CorrelationID(request)
+
+	args := []interface{}{
+		"requestId", request.RequestContext.RequestID,
+		"correlationId", correlationID,
+		"route", route,
+	}
+	if userID := request.PathParameters["userId"]; userID != "" {
+		args = append(args, "userId", userID)
+	}
+	if fileID := request.PathParameters["fileId"]; fileID != "" {
+		args = append(args, "fileId", fileID)
+	}
+
+	logger := Default().With(args...)
+	return NewContext(ctx, logger), logger, correlationID
+}
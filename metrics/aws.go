@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// AWSLatency times every call of an AWS client it is added to, retries included, as metric
+// name with the API operation added to the dimensions of the call's scope:
+//
+//	svc.Handlers.Complete.PushBackNamed(metrics.AWSLatency("DynamoDBLatency"))
+//
+// Calls made with a request's context are broken down by route; others have only the stage.
+func AWSLatency(name string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "metrics." + name,
+		Fn: func(r *request.Request) {
+			elapsed := time.Since(r.Time)
+			FromContext(r.Context()).Emit(Dimensions{"Operation": r.Operation.Name}, Metric{
+				Name:  name,
+				Value: float64(elapsed) / float64(time.Millisecond),
+				Unit:  Milliseconds,
+			})
+		},
+	}
+}
@@ -0,0 +1,249 @@
+// Package metrics emits CloudWatch metrics as Embedded Metric Format log lines: JSON objects
+// on stdout with an _aws directive that CloudWatch Logs turns into metrics, so no PutMetricData
+// calls sit on the request path.
+//
+//	{"_aws":{"Timestamp":1634663045123,"CloudWatchMetrics":[{"Namespace":"FileManagementAPI",
+//	  "Dimensions":[["Route","Stage"]],"Metrics":[{"Name":"Latency","Unit":"Milliseconds"}]}]},
+//	  "Route":"GET /{userId}","Stage":"dev","Latency":12.5}
+//
+// Handlers put metrics through the Scope router.Instrument stores in their context, which
+// adds the stage and route dimensions.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Namespace groups the API's metrics in CloudWatch
+const Namespace = "FileManagementAPI"
+
+// Unit is a CloudWatch metric unit
+type Unit string
+
+const (
+	Milliseconds Unit = "Milliseconds"
+	Count        Unit = "Count"
+	Bytes        Unit = "Bytes"
+)
+
+// Metric is one value
+type Metric struct {
+	Name  string
+	Value float64
+	Unit  Unit
+}
+
+// Dimensions name the series a metric belongs to, e.g. {"Stage": "dev", "Route": "GET /{userId}"}
+type Dimensions map[string]string
+
+// with returns a copy of d with extra added
+func (d Dimensions) with(extra Dimensions) Dimensions {
+	dims := make(Dimensions, len(d)+len(extra))
+	for k, v := range d {
+		dims[k] = v
+	}
+	for k, v := range extra {
+		dims[k] = v
+	}
+	return dims
+}
+
+// Sink receives metrics
+type Sink interface {
+	Emit(dims Dimensions, metrics ...Metric)
+}
+
+// EMF writes each Emit as one Embedded Metric Format line
+type EMF struct {
+	Namespace string
+	W         io.Writer
+	Now       func() time.Time
+
+	mu sync.Mutex
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit,omitempty"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+func (e *EMF) Emit(dims Dimensions, metrics ...Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+
+	directive := emfDirective{Namespace: e.Namespace, Dimensions: [][]string{keys}}
+	line := map[string]interface{}{}
+	for k, v := range dims {
+		line[k] = v
+	}
+	for _, m := range metrics {
+		directive.Metrics = append(directive.Metrics, emfMetric{Name: m.Name, Unit: m.Unit})
+		line[m.Name] = m.Value
+	}
+	line["_aws"] = map[string]interface{}{
+		"Timestamp":         now().UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []emfDirective{directive},
+	}
+
+	js, err := json.Marshal(line)
+	if err != nil {
+		// only NaN or Inf values get here; CloudWatch would reject them anyway
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.W.Write(append(js, '\n'))
+}
+
+// Noop discards metrics
+type Noop struct{}
+
+func (Noop) Emit(dims Dimensions, metrics ...Metric) {}
+
+// Point is a metric a Recorder received with its dimensions
+type Point struct {
+	Dimensions Dimensions
+	Metric
+}
+
+// Recorder keeps every metric in memory, for tests
+type Recorder struct {
+	mu     sync.Mutex
+	points []Point
+}
+
+func (r *Recorder) Emit(dims Dimensions, metrics ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range metrics {
+		r.points = append(r.points, Point{Dimensions: dims.with(nil), Metric: m})
+	}
+}
+
+// Points returns the metrics named name whose dimensions include match
+func (r *Recorder) Points(name string, match Dimensions) []Point {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var points []Point
+	for _, p := range r.points {
+		if p.Name == name && includes(p.Dimensions, match) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// Sum adds up the values of Points(name, match)
+func (r *Recorder) Sum(name string, match Dimensions) float64 {
+	var sum float64
+	for _, p := range r.Points(name, match) {
+		sum += p.Value
+	}
+	return sum
+}
+
+func includes(dims Dimensions, match Dimensions) bool {
+	for k, v := range match {
+		if dims[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	defaultMu   sync.Mutex
+	defaultSink Sink = sinkFromEnv()
+)
+
+// sinkFromEnv writes EMF to stdout unless METRICS=off
+func sinkFromEnv() Sink {
+	if os.Getenv("METRICS") == "off" {
+		return Noop{}
+	}
+	return &EMF{Namespace: Namespace, W: os.Stdout}
+}
+
+// Default is the process-wide sink
+func Default() Sink {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultSink
+}
+
+// SetDefault replaces the process-wide sink, e.g. with a Recorder in tests
+func SetDefault(s Sink) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultSink = s
+}
+
+// Stage is the deployment stage from STAGE, "dev" when unset
+func Stage() string {
+	if stage := os.Getenv("STAGE"); stage != "" {
+		return stage
+	}
+	return "dev"
+}
+
+// Scope puts metrics with a fixed set of dimensions to the Default sink
+type Scope struct {
+	dims Dimensions
+}
+
+// NewScope returns a scope adding dims to every metric
+func NewScope(dims Dimensions) *Scope {
+	return &Scope{dims: dims.with(nil)}
+}
+
+// Put emits one value
+func (s *Scope) Put(name string, value float64, unit Unit) {
+	Default().Emit(s.dims, Metric{Name: name, Value: value, Unit: unit})
+}
+
+// Emit emits several values in one line, with extra dimensions added to the scope's
+func (s *Scope) Emit(extra Dimensions, metrics ...Metric) {
+	Default().Emit(s.dims.with(extra), metrics...)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying s
+func NewContext(ctx context.Context, s *Scope) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the context's scope, or one with only the stage outside a request
+func FromContext(ctx context.Context) *Scope {
+	if s, ok := ctx.Value(contextKey{}).(*Scope); ok {
+		return s
+	}
+	return NewScope(Dimensions{"Stage": Stage()})
+}
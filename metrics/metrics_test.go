@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEMFLine(t *testing.T) {
+	var buf bytes.Buffer
+	e := &EMF{Namespace: Namespace, W: &buf, Now: func() time.Time { return time.Unix(1634663045, 123e6) }}
+
+	e.Emit(Dimensions{"Stage": "dev", "Route": "GET /{userId}"},
+		Metric{Name: "Latency", Value: 12.5, Unit: Milliseconds},
+		Metric{Name: "Requests", Value: 1, Unit: Count},
+	)
+	e.Emit(Dimensions{"Stage": "dev"})
+
+	want := `{"Latency":12.5,"Requests":1,"Route":"GET /{userId}","Stage":"dev","_aws":{"CloudWatchMetrics":[{"Namespace":"FileManagementAPI","Dimensions":[["Route","Stage"]],"Metrics":[{"Name":"Latency","Unit":"Milliseconds"},{"Name":"Requests","Unit":"Count"}]}],"Timestamp":1634663045123}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got  %s\nwant %s", buf.String(), want)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScopeAndRecorder(t *testing.T) {
+	r := &Recorder{}
+	saved := Default()
+	SetDefault(r)
+	defer SetDefault(saved)
+
+	scope := NewScope(Dimensions{"Stage": "test", "Route": "POST /{userId}"})
+	ctx := NewContext(context.Background(), scope)
+	FromContext(ctx).Put("BytesUploaded", 100, Bytes)
+	FromContext(ctx).Put("BytesUploaded", 20, Bytes)
+	scope.Emit(Dimensions{"StatusCode": "200"}, Metric{Name: "Requests", Value: 1, Unit: Count})
+	FromContext(context.Background()).Put("BytesUploaded", 5, Bytes)
+
+	if sum := r.Sum("BytesUploaded", Dimensions{"Route": "POST /{userId}"}); sum != 120 {
+		t.Errorf("BytesUploaded for the route = %v, want 120", sum)
+	}
+	if sum := r.Sum("BytesUploaded", nil); sum != 125 {
+		t.Errorf("BytesUploaded = %v, want 125", sum)
+	}
+	points := r.Points("Requests", Dimensions{"StatusCode": "200"})
+	if len(points) != 1 || points[0].Dimensions["Stage"] != "test" {
+		t.Errorf("Requests points = %+v", points)
+	}
+	if len(scope.dims) != 2 {
+		t.Errorf("Emit changed the scope's dimensions: %v", scope.dims)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"log"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/router"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// Single-binary alternative to the per-route Lambdas, deployed with `make deploy-monolith`
+func main() {
+	if err := storage.Init(); err != nil {
+		log.Fatalf("storage: %v", err)
+	}
+
+	lambda.Start(router.LambdaHandler(router.Routes()))
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/object_created"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/scan"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	if err := storage.Init(); err != nil {
+		log.Fatalf("storage: %v", err)
+	}
+	if err := scan.Init(); err != nil {
+		log.Fatalf("scan: %v", err)
+	}
+
+	lambda.Start(object_created.Handler)
+}
@@ -0,0 +1,177 @@
+// Package openapi generates an OpenAPI 3 description of the API from the handlers'
+// request and response types, and validates request bodies against the same schemas.
+package openapi
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Version is the OpenAPI specification version documents are written against
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps lower-case HTTP methods to operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// SecuritySchemeName is the Cognito JWT authorizer, as named in serverless.yml
+const SecuritySchemeName = "cognitoJwt"
+
+// Endpoint is one route to document. Request, Response and Query are zero values of the
+// body, response and query option types (nil when the route has none); query options are
+// the fields tagged with query:"name".
+type Endpoint struct {
+	OperationID string
+	Method      string
+	Path        string
+	Summary     string
+	Request     interface{}
+	Response    interface{}
+	Query       interface{}
+	Public      bool // served without the JWT authorizer
+}
+
+// Build describes endpoints in a document. Every operation requires a Cognito bearer token
+// unless it is Public.
+func Build(title string, version string, endpoints []Endpoint) *Document {
+	g := &generator{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				SecuritySchemeName: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	for _, e := range endpoints {
+		op := &Operation{
+			OperationID: e.OperationID,
+			Summary:     e.Summary,
+			Responses:   map[string]Response{},
+		}
+
+		for _, segment := range strings.Split(e.Path, "/") {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				op.Parameters = append(op.Parameters, Parameter{
+					Name:     segment[1 : len(segment)-1],
+					In:       "path",
+					Required: true,
+					Schema:   &Schema{Type: "string"},
+				})
+			}
+		}
+		op.Parameters = append(op.Parameters, queryParameters(g, e.Query)...)
+
+		if e.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(g.schema(reflect.TypeOf(e.Request))),
+			}
+		}
+
+		ok := Response{Description: "OK"}
+		if e.Response != nil {
+			ok.Content = jsonContent(g.schema(reflect.TypeOf(e.Response)))
+		}
+		op.Responses["200"] = ok
+
+		if e.Request != nil || e.Query != nil {
+			op.Responses["400"] = Response{Description: "Malformed request"}
+		}
+		if !e.Public {
+			op.Security = []map[string][]string{{SecuritySchemeName: {}}}
+			op.Responses["401"] = Response{Description: "Missing or invalid token"}
+			op.Responses["403"] = Response{Description: "Caller may not act as this user"}
+		}
+		op.Responses["500"] = Response{Description: "Internal Server Error"}
+
+		item, found := doc.Paths[e.Path]
+		if !found {
+			item = PathItem{}
+			doc.Paths[e.Path] = item
+		}
+		item[strings.ToLower(e.Method)] = op
+	}
+
+	return doc
+}
+
+func queryParameters(g *generator, query interface{}) []Parameter {
+	if query == nil {
+		return nil
+	}
+
+	var params []Parameter
+	t := reflect.TypeOf(query)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("query")
+		if name == "" || name == "-" {
+			continue
+		}
+		params = append(params, Parameter{Name: name, In: "query", Schema: g.schema(f.Type)})
+	}
+
+	return params
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
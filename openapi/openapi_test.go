@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type inner struct {
+	Name string `json:"Name"`
+}
+
+type embedded struct {
+	Count int64 `json:"Count"`
+}
+
+type sample struct {
+	FileName string            `json:"FileName" openapi:"required,minLength=1,maxLength=5"`
+	FileSize int64             `json:"FileSize" openapi:"minimum=0"`
+	Ratio    float64           `json:"Ratio"`
+	Enabled  bool              `json:"Enabled,omitempty"`
+	Tags     []string          `json:"Tags"`
+	Labels   map[string]string `json:"Labels"`
+	Child    *inner            `json:"Child"`
+	Path     string            `json:"Path" openapi:"maxLength=filename.MaxLength"`
+	Skipped  string            `json:"-"`
+	hidden   string
+	embedded
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(sample{})
+
+	if s.Type != "object" || len(s.Required) != 1 || s.Required[0] != "FileName" {
+		t.Fatalf("schema = %+v", s)
+	}
+	for name, want := range map[string]string{
+		"FileName": "string", "FileSize": "integer", "Ratio": "number", "Enabled": "boolean",
+		"Tags": "array", "Labels": "object", "Child": "object", "Count": "integer",
+	} {
+		if p := s.Properties[name]; p == nil || p.Type != want {
+			t.Errorf("%v = %+v, want type %v", name, p, want)
+		}
+	}
+	for _, name := range []string{"Skipped", "hidden", "embedded"} {
+		if _, found := s.Properties[name]; found {
+			t.Errorf("%v should not be a property", name)
+		}
+	}
+	if p := s.Properties["FileName"]; *p.MinLength != 1 || *p.MaxLength != 5 {
+		t.Errorf("FileName constraints = %+v", p)
+	}
+	if p := s.Properties["Path"]; p.MaxLength == nil || *p.MaxLength != 1024 {
+		t.Errorf("Path constraints = %+v", p)
+	}
+	if !s.Properties["Child"].Nullable || s.Properties["Tags"].Items.Type != "string" {
+		t.Errorf("Child/Tags = %+v %+v", s.Properties["Child"], s.Properties["Tags"])
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		body  string
+		error string // substring, empty for success
+	}{
+		{`{"FileName":"a.txt","FileSize":3,"Tags":["x"],"Child":{"Name":"c"},"Count":2}`, ""},
+		{`{"FileName":"a.txt","Unknown":true}`, ""},
+		{`{"FileName":"a.txt","Child":null}`, ""},
+		{``, "is empty"},
+		{`not json`, "not valid JSON"},
+		{`{"FileName":"a.txt"} {}`, "after the JSON value"},
+		{`null`, "must not be null"},
+		{`[]`, "must be an object"},
+		{`{}`, "FileName is required"},
+		{`{"FileName":null}`, "FileName is required"},
+		{`{"FileName":""}`, "FileName must not be empty"},
+		{`{"FileName":"toolong"}`, "at most 5"},
+		{`{"FileName":7}`, "FileName must be a string"},
+		{`{"FileName":"a","FileSize":"3"}`, "FileSize must be a number"},
+		{`{"FileName":"a","FileSize":1.5}`, "FileSize must be an integer"},
+		{`{"FileName":"a","FileSize":-1}`, "FileSize must be at least 0"},
+		{`{"FileName":"a","Tags":["x",1]}`, "Tags[1] must be a string"},
+		{`{"FileName":"a","Child":{"Name":false}}`, "Child.Name must be a string"},
+		{`{"FileName":"a","Labels":{"k":1}}`, "Labels.k must be a string"},
+	}
+	for _, tt := range tests {
+		var v sample
+		err := Decode(tt.body, &v)
+		if tt.error == "" {
+			if err != nil {
+				t.Errorf("Decode(%q) = %v", tt.body, err)
+			}
+			continue
+		}
+		if _, ok := err.(*ValidationError); !ok || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("Decode(%q) = %v, want %q", tt.body, err, tt.error)
+		}
+	}
+
+	var v sample
+	if err := Decode(`{"FileName":"a.txt","FileSize":3,"Count":2}`, &v); err != nil || v.FileName != "a.txt" || v.FileSize != 3 || v.Count != 2 {
+		t.Errorf("decoded %+v, %v", v, err)
+	}
+}
+
+type otherSample struct {
+	Child inner `json:"Child"`
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build("test", "1", []Endpoint{
+		{OperationID: "create", Method: "POST", Path: "/{userId}", Request: sample{}, Response: []otherSample{}},
+		{OperationID: "list", Method: "GET", Path: "/", Query: struct {
+			UserID string `query:"userId"`
+			Other  string
+		}{}},
+		{OperationID: "spec", Method: "GET", Path: "/openapi.json", Public: true},
+	})
+
+	create := doc.Paths["/{userId}"]["post"]
+	if create == nil || len(create.Parameters) != 1 || create.Parameters[0].In != "path" || create.Parameters[0].Name != "userId" {
+		t.Fatalf("create = %+v", create)
+	}
+	if ref := create.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/sample" {
+		t.Errorf("request ref = %q", ref)
+	}
+	if items := create.Responses["200"].Content["application/json"].Schema.Items; items == nil || items.Ref != "#/components/schemas/otherSample" {
+		t.Errorf("response = %+v", create.Responses["200"])
+	}
+	if doc.Components.Schemas["otherSample"].Properties["Child"].Ref != "#/components/schemas/inner" {
+		t.Errorf("nested struct should be a component: %+v", doc.Components.Schemas["otherSample"])
+	}
+	if _, found := create.Responses["401"]; !found || len(create.Security) != 1 {
+		t.Errorf("create should require a token: %+v", create)
+	}
+
+	list := doc.Paths["/"]["get"]
+	if len(list.Parameters) != 1 || list.Parameters[0].Name != "userId" || list.Parameters[0].In != "query" {
+		t.Errorf("list parameters = %+v", list.Parameters)
+	}
+
+	spec := doc.Paths["/openapi.json"]["get"]
+	if _, found := spec.Responses["401"]; found || spec.Security != nil {
+		t.Errorf("public operation = %+v", spec)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/filename"
+)
+
+// Schema is the subset of the OpenAPI 3.0 Schema Object the API's types need
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+}
+
+// generator turns Go types into schemas. With components set, named struct types are
+// registered there once and referenced with $ref; otherwise every schema is inlined,
+// which is what validation works on.
+type generator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+// lengths are the limits a tag may name instead of a number, so each is defined once, where it
+// is enforced
+var lengths = map[string]int{
+	"filename.MaxLength":        filename.MaxLength,
+	"filename.MaxSegmentLength": filename.MaxSegmentLength,
+}
+
+// SchemaOf returns the inlined schema for v's type, following encoding/json's field rules.
+// Constraints come from an openapi struct tag, e.g.
+//
+//	FileName string `json:"FileName" openapi:"required,minLength=1,maxLength=filename.MaxLength"`
+//	FileSize int64  `json:"FileSize" openapi:"minimum=0"`
+func SchemaOf(v interface{}) *Schema {
+	return (&generator{}).schema(reflect.TypeOf(v))
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if g.components == nil || t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.register(t)}
+	}
+
+	// interfaces and anything else accept any value
+	return &Schema{}
+}
+
+// register adds a named struct to the components, qualifying the name with its package
+// when two packages declare types of the same name (e.g. both UploadFileRequests)
+func (g *generator) register(t reflect.Type) string {
+	if name, found := g.names[t]; found {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := g.components[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+
+	g.names[t] = name
+	// reserve the name before descending so recursive types terminate
+	g.components[name] = &Schema{}
+	*g.components[name] = *g.object(t)
+
+	return name
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+// fields adds t's JSON fields to s, flattening embedded structs as encoding/json does
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, s)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(ft)
+		if applyConstraints(prop, f.Tag.Get("openapi")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// applyConstraints reads an openapi tag into prop, reporting whether the field is required
+func applyConstraints(prop *Schema, tag string) bool {
+	required := false
+	for _, opt := range strings.Split(tag, ",") {
+		key, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			key, value = opt[:i], opt[i+1:]
+		}
+
+		switch key {
+		case "required":
+			required = true
+		case "minimum":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				prop.Minimum = &n
+			}
+		case "minLength":
+			if n, ok := length(value); ok {
+				prop.MinLength = &n
+			}
+		case "maxLength":
+			if n, ok := length(value); ok {
+				prop.MaxLength = &n
+			}
+		}
+	}
+
+	return required
+}
+
+// length reads a tag's length, a number or the name of one of lengths
+func length(value string) (int, bool) {
+	if n, found := lengths[value]; found {
+		return n, true
+	}
+	n, err := strconv.Atoi(value)
+
+	return n, err == nil
+}
@@ -0,0 +1,174 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationError describes why a request body does not match its schema
+type ValidationError struct {
+	Field   string // JSON path of the offending value, empty for the body itself
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return "invalid request body: " + e.Message
+	}
+
+	return fmt.Sprintf("invalid request body: %v %v", e.Field, e.Message)
+}
+
+var schemaCache sync.Map // reflect.Type -> *Schema
+
+// Decode validates a JSON request body against the schema of v's type and then unmarshals
+// it into v, which must be a pointer. Any failure is a *ValidationError, so handlers can
+// answer 400 rather than treating a bad body as an internal error.
+func Decode(body string, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic("openapi: Decode needs a pointer")
+	}
+
+	schema, found := schemaCache.Load(t.Elem())
+	if !found {
+		schema, _ = schemaCache.LoadOrStore(t.Elem(), (&generator{}).schema(t.Elem()))
+	}
+
+	if err := Validate(schema.(*Schema), []byte(body)); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		return &ValidationError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// Validate checks that data is a single JSON value matching s
+func Validate(s *Schema, data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &ValidationError{Message: "is empty"}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return &ValidationError{Message: "is not valid JSON: " + err.Error()}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &ValidationError{Message: "has data after the JSON value"}
+	}
+
+	if value == nil {
+		return &ValidationError{Message: "must not be null"}
+	}
+
+	// validate returns a *ValidationError, which must not become a non-nil error when nil
+	if err := validate(s, value, ""); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validate(s *Schema, value interface{}, path string) *ValidationError {
+	if value == nil {
+		// encoding/json leaves the Go zero value for null; only required fields must be present
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(path, "an object")
+		}
+		for _, name := range s.Required {
+			if v, found := obj[name]; !found || v == nil {
+				return &ValidationError{Field: join(path, name), Message: "is required"}
+			}
+		}
+		for name, v := range obj {
+			prop, found := s.Properties[name]
+			if !found {
+				prop = s.AdditionalProperties
+			}
+			if prop == nil {
+				// unknown fields are ignored, as encoding/json does
+				continue
+			}
+			if err := validate(prop, v, join(path, name)); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return typeError(path, "an array")
+		}
+		for i, v := range arr {
+			if err := validate(s.Items, v, fmt.Sprintf("%v[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeError(path, "a string")
+		}
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				return &ValidationError{Field: path, Message: "must not be empty"}
+			}
+			return &ValidationError{Field: path, Message: fmt.Sprintf("must be at least %d characters", *s.MinLength)}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return &ValidationError{Field: path, Message: fmt.Sprintf("must be at most %d characters", *s.MaxLength)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError(path, "a boolean")
+		}
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			return typeError(path, "a number")
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return typeError(path, "a number")
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return typeError(path, "an integer")
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return &ValidationError{Field: path, Message: fmt.Sprintf("must be at least %v", *s.Minimum)}
+		}
+	}
+
+	return nil
+}
+
+func typeError(path string, want string) *ValidationError {
+	return &ValidationError{Field: path, Message: "must be " + want}
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
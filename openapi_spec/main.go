@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/router"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// the document describes every route, so this is the one function that links them all
+func main() {
+	lambda.Start(instrument.Function("GET /openapi.json", router.SpecHandler))
+}
@@ -0,0 +1,146 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+)
+
+// Fallbacks when the stage does not set QUOTA_DEFAULT_MAX_BYTES / QUOTA_DEFAULT_MAX_FILES
+const (
+	FallbackMaxBytes int64 = 5 << 30 // 5 GiB
+	FallbackMaxFiles int64 = 1000
+)
+
+// Limits caps how much a single user may store
+type Limits struct {
+	MaxBytes int64 `json:"MaxBytes"`
+	MaxFiles int64 `json:"MaxFiles"`
+}
+
+// Usage is a user's current consumption alongside their effective limits
+type Usage struct {
+	UserID    string `json:"UserID"`
+	UsedBytes int64  `json:"UsedBytes"`
+	FileCount int64  `json:"FileCount"`
+	Limits
+}
+
+// DefaultLimits reads the stage defaults from the environment
+func DefaultLimits() Limits {
+	return Limits{
+		MaxBytes: envInt64("QUOTA_DEFAULT_MAX_BYTES", FallbackMaxBytes),
+		MaxFiles: envInt64("QUOTA_DEFAULT_MAX_FILES", FallbackMaxFiles),
+	}
+}
+
+// Effective applies admin overrides on top of the defaults. A zero override means use the default.
+func Effective(defaults Limits, maxBytes int64, maxFiles int64) Limits {
+	limits := defaults
+	if maxBytes > 0 {
+		limits.MaxBytes = maxBytes
+	}
+	if maxFiles > 0 {
+		limits.MaxFiles = maxFiles
+	}
+
+	return limits
+}
+
+// ExceededError describes which limit an upload would break and the HTTP status to report it with
+type ExceededError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"Error"`
+	Requested  int64  `json:"RequestedBytes"`
+	Usage
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// Check reports which limit storing one more file of size bytes would exceed, or nil if it fits.
+// Byte overruns are 413 Payload Too Large, file count overruns are 429 Too Many Requests.
+func Check(u Usage, size int64) *ExceededError {
+	if u.MaxBytes > 0 && u.UsedBytes+size > u.MaxBytes {
+		return &ExceededError{
+			StatusCode: 413,
+			Message: fmt.Sprintf("storage quota exceeded: %d of %d bytes used, upload needs %d",
+				u.UsedBytes, u.MaxBytes, size),
+			Requested: size,
+			Usage:     u,
+		}
+	}
+
+	if u.MaxFiles > 0 && u.FileCount+1 > u.MaxFiles {
+		return &ExceededError{
+			StatusCode: 429,
+			Message:    fmt.Sprintf("file quota exceeded: %d of %d files used", u.FileCount, u.MaxFiles),
+			Requested:  size,
+			Usage:      u,
+		}
+	}
+
+	return nil
+}
+
+// Current loads userID's counters from the quota table and resolves their effective limits
+func Current(ctx context.Context, tableName string, userID string) (*Usage, error) {
+	item, err := aws_usages.GetQuotaDynamoDB(ctx, tableName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{
+		UserID:    userID,
+		UsedBytes: item.UsedBytes,
+		FileCount: item.FileCount,
+		Limits:    Effective(DefaultLimits(), item.MaxBytes, item.MaxFiles),
+	}, nil
+}
+
+// Settle charges the owner of fileData for size, the size its stored content turned out to
+// have, instead of the size its upload declared. If the difference does not fit the owner's
+// byte limit it returns an *ExceededError and the declared size stays charged.
+func Settle(ctx context.Context, filesTable string, quotaTable string, fileData aws_usages.FileTableItem, size int64) error {
+	if size == fileData.FileSize {
+		return nil
+	}
+
+	usage, err := Current(ctx, quotaTable, fileData.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = aws_usages.SettleFileSizeDynamoDB(ctx, filesTable, quotaTable, fileData, size, usage.MaxBytes)
+	if err == aws_usages.ErrQuotaExceeded {
+		return &ExceededError{
+			StatusCode: 413,
+			Message: fmt.Sprintf("storage quota exceeded: %d of %d bytes used, content is %d bytes where %d were declared",
+				usage.UsedBytes, usage.MaxBytes, size, fileData.FileSize),
+			Requested: size - fileData.FileSize,
+			Usage:     *usage,
+		}
+	}
+
+	return err
+}
+
+func envInt64(name string, fallback int64) int64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v <= 0 {
+		logging.Default().Warn("ignoring invalid setting", "name", name, "value", raw)
+		return fallback
+	}
+
+	return v
+}
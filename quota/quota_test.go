@@ -0,0 +1,45 @@
+package quota
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEffective(t *testing.T) {
+	defaults := Limits{MaxBytes: 100, MaxFiles: 10}
+
+	if got := Effective(defaults, 0, 0); got != defaults {
+		t.Errorf("no override: got %+v", got)
+	}
+	if got := Effective(defaults, 500, 0); got.MaxBytes != 500 || got.MaxFiles != 10 {
+		t.Errorf("bytes override: got %+v", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	u := Usage{UserID: "user-1", UsedBytes: 90, FileCount: 9, Limits: Limits{MaxBytes: 100, MaxFiles: 10}}
+
+	if e := Check(u, 10); e != nil {
+		t.Errorf("upload filling quota exactly should pass: %v", e)
+	}
+	if e := Check(u, 11); e == nil || e.StatusCode != 413 {
+		t.Errorf("byte overrun: got %+v, want 413", e)
+	}
+
+	u.FileCount = 10
+	if e := Check(u, 1); e == nil || e.StatusCode != 429 {
+		t.Errorf("file overrun: got %+v, want 429", e)
+	}
+}
+
+func TestDefaultLimitsFromEnv(t *testing.T) {
+	os.Setenv("QUOTA_DEFAULT_MAX_BYTES", "2048")
+	os.Setenv("QUOTA_DEFAULT_MAX_FILES", "bogus")
+	defer os.Unsetenv("QUOTA_DEFAULT_MAX_BYTES")
+	defer os.Unsetenv("QUOTA_DEFAULT_MAX_FILES")
+
+	got := DefaultLimits()
+	if got.MaxBytes != 2048 || got.MaxFiles != FallbackMaxFiles {
+		t.Errorf("got %+v", got)
+	}
+}
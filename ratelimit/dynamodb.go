@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+)
+
+// maxConflicts bounds how often Allow re-reads a bucket another request updated first
+const maxConflicts = 5
+
+// DynamoDBLimiter keeps one token bucket item per user in a DynamoDB table.
+// Writes are conditioned on the version read, so concurrent Lambdas never spend the same
+// token, and each item carries a TTL so idle users' buckets expire once they would be full.
+type DynamoDBLimiter struct {
+	TableName string
+	Config    Config
+	Now       func() time.Time
+}
+
+// NewDynamoDBLimiter returns a limiter over tableName, which must have UserID as its hash key
+func NewDynamoDBLimiter(tableName string, cfg Config) *DynamoDBLimiter {
+	return &DynamoDBLimiter{TableName: tableName, Config: cfg}
+}
+
+func (l *DynamoDBLimiter) Allow(ctx context.Context, userID string) (bool, time.Duration, error) {
+	for i := 0; i < maxConflicts; i++ {
+		now := time.Now()
+		if l.Now != nil {
+			now = l.Now()
+		}
+
+		bucket, err := aws_usages.GetRateBucketDynamoDB(ctx, l.TableName, userID)
+		if err != nil {
+			return false, 0, err
+		}
+
+		var prevUpdated int64
+		tokens, last := l.Config.Burst, now
+		if bucket != nil {
+			prevUpdated = bucket.Updated
+			tokens, last = bucket.Tokens, time.Unix(0, bucket.Updated*int64(time.Millisecond))
+		}
+
+		tokens, wait := l.Config.take(tokens, last, now)
+		if wait > 0 {
+			// nothing spent, so there is nothing to write
+			return false, wait, nil
+		}
+
+		updated := now.UnixNano() / int64(time.Millisecond)
+		if updated <= prevUpdated {
+			updated = prevUpdated + 1
+		}
+
+		err = aws_usages.PutRateBucketDynamoDB(ctx, l.TableName, aws_usages.RateBucketItem{
+			UserID:    userID,
+			Tokens:    tokens,
+			Updated:   updated,
+			ExpiresAt: now.Add(l.Config.fullAfter()).Unix() + 1,
+		}, prevUpdated)
+		if err == aws_usages.ErrRateBucketConflict {
+			continue
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		return true, 0, nil
+	}
+
+	return false, 0, fmt.Errorf("rate bucket for userId: %v kept changing underneath us", userID)
+}
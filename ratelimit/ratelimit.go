@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+)
+
+// Limiter decides whether a user may make another signing request.
+// When the request is refused, retryAfter is how long until a token is available.
+type Limiter interface {
+	Allow(ctx context.Context, userID string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Config describes a token bucket: Burst tokens at most, refilled at PerMinute tokens per minute
+type Config struct {
+	Burst     float64
+	PerMinute float64
+}
+
+// Fallbacks when the stage does not set RATE_LIMIT_BURST / RATE_LIMIT_PER_MINUTE
+const (
+	FallbackBurst     = 20
+	FallbackPerMinute = 60
+)
+
+// ConfigFromEnv reads RATE_LIMIT_BURST and RATE_LIMIT_PER_MINUTE
+func ConfigFromEnv() Config {
+	return Config{
+		Burst:     envFloat("RATE_LIMIT_BURST", FallbackBurst),
+		PerMinute: envFloat("RATE_LIMIT_PER_MINUTE", FallbackPerMinute),
+	}
+}
+
+// take refills a bucket holding tokens as of last up to now and tries to spend one token.
+// It returns the new token count and, if no token was available, the wait until one is.
+func (c Config) take(tokens float64, last time.Time, now time.Time) (float64, time.Duration) {
+	perSecond := c.PerMinute / 60
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(c.Burst, tokens+elapsed*perSecond)
+	}
+
+	if tokens >= 1 {
+		return tokens - 1, 0
+	}
+
+	wait := time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	return tokens, wait
+}
+
+// fullAfter is how long an empty bucket takes to refill, used for the DynamoDB TTL
+func (c Config) fullAfter() time.Duration {
+	return time.Duration(c.Burst / (c.PerMinute / 60) * float64(time.Second))
+}
+
+// RetryAfterHeader formats a wait for the Retry-After header, in whole seconds rounded up
+func RetryAfterHeader(wait time.Duration) string {
+	secs := int64(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+
+	return strconv.FormatInt(secs, 10)
+}
+
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory. It is meant for tests and the local server;
+// Lambda instances do not share memory, so deployed handlers use DynamoDBLimiter.
+type MemoryLimiter struct {
+	Config Config
+	Now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+// NewMemoryLimiter returns an in-memory limiter with the given bucket shape
+func NewMemoryLimiter(cfg Config) *MemoryLimiter {
+	return &MemoryLimiter{Config: cfg, buckets: map[string]*memoryBucket{}}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, userID string) (bool, time.Duration, error) {
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[userID]
+	if !found {
+		b = &memoryBucket{tokens: l.Config.Burst, last: now}
+		l.buckets[userID] = b
+	}
+
+	tokens, wait := l.Config.take(b.tokens, b.last, now)
+	b.tokens, b.last = tokens, now
+
+	return wait == 0, wait, nil
+}
+
+func envFloat(name string, fallback float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v <= 0 {
+		logging.Default().Warn("ignoring invalid setting", "name", name, "value", raw)
+		return fallback
+	}
+
+	return v
+}
+
+// Check asks l whether userID may proceed and returns the Retry-After value when they may not.
+// Limiter errors fail open: an outage of the throttling table should not take signing down with it.
+func Check(ctx context.Context, l Limiter, userID string) (retryAfter string, limited bool) {
+	allowed, wait, err := l.Allow(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("rate limiter failed, allowing the request", "userId", userID, "error", err)
+		return "", false
+	}
+	if allowed {
+		return "", false
+	}
+
+	return RetryAfterHeader(wait), true
+}
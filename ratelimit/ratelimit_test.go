@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1600000000, 0)
+	l := NewMemoryLimiter(Config{Burst: 2, PerMinute: 60})
+	l.Now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := l.Allow(ctx, "user-1"); !ok {
+			t.Fatalf("request %d within burst refused", i)
+		}
+	}
+
+	ok, wait, _ := l.Allow(ctx, "user-1")
+	if ok {
+		t.Fatal("request past burst allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v, want 1s", wait)
+	}
+
+	if ok, _, _ := l.Allow(ctx, "user-2"); !ok {
+		t.Error("buckets should be per user")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _, _ := l.Allow(ctx, "user-1"); !ok {
+		t.Error("request after refill refused")
+	}
+}
+
+func TestTakeCapsAtBurst(t *testing.T) {
+	c := Config{Burst: 5, PerMinute: 60}
+	start := time.Unix(0, 0)
+
+	tokens, wait := c.take(0, start, start.Add(time.Hour))
+	if wait != 0 || tokens != 4 {
+		t.Errorf("tokens = %v, wait = %v; want 4, 0", tokens, wait)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                       "1",
+		300 * time.Millisecond:  "1",
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+	}
+	for wait, want := range tests {
+		if got := RetryAfterHeader(wait); got != want {
+			t.Errorf("RetryAfterHeader(%v) = %v, want %v", wait, got, want)
+		}
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string) (bool, time.Duration, error) {
+	return false, 0, errors.New("table unavailable")
+}
+
+func TestCheckFailsOpen(t *testing.T) {
+	if _, limited := Check(context.Background(), failingLimiter{}, "user-1"); limited {
+		t.Error("limiter errors should not throttle")
+	}
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// maxBodyBytes matches the API Gateway payload limit
+const maxBodyBytes = 10 << 20
+
+// HTTPHandler serves a route table over net/http, translating each request into the
+// events.APIGatewayProxyRequest API Gateway would have sent the Lambda, and the response back
+type HTTPHandler struct {
+	Routes []Route
+	// Wrap, when set, is applied to every non-Public route handler, e.g. auth.Verifier.Middleware
+	Wrap  func(HandlerFunc) HandlerFunc
+	Stage string
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		// serverless.yml sets cors: true on every route
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Correlation-ID")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	route, params, found := Match(h.Routes, r.Method, r.URL.EscapedPath())
+	if !found {
+		writeJSONMessage(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	request, err := h.proxyRequest(r, route, params)
+	if err != nil {
+		writeJSONMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	handler := route.Handler
+	if h.Wrap != nil && !route.Public {
+		handler = h.Wrap(handler)
+	}
+	handler = instrument.Route(route.RouteKey(), handler)
+
+	resp, err := handler(r.Context(), request)
+	if err != nil {
+		// API Gateway hides Lambda errors behind a bare 500; instrument.Route has logged it
+		writeJSONMessage(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	writeProxyResponse(w, resp)
+}
+
+func (h *HTTPHandler) proxyRequest(r *http.Request, route Route, params map[string]string) (events.APIGatewayProxyRequest, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, fmt.Errorf("failed to read body: %v", err)
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Resource:                        route.Path,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         map[string]string{},
+		MultiValueHeaders:               map[string][]string{},
+		QueryStringParameters:           map[string]string{},
+		MultiValueQueryStringParameters: map[string][]string{},
+		PathParameters:                  params,
+		Body:                            string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:        uuid.New().String(),
+			Stage:            h.Stage,
+			ResourcePath:     route.Path,
+			HTTPMethod:       r.Method,
+			Protocol:         r.Proto,
+			RequestTimeEpoch: time.Now().UnixNano() / int64(time.Millisecond),
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  sourceIP(r),
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+
+	if !utf8.Valid(body) {
+		request.Body = base64.StdEncoding.EncodeToString(body)
+		request.IsBase64Encoded = true
+	}
+
+	for k, v := range r.Header {
+		// HTTP APIs deliver header names lower-cased
+		name := strings.ToLower(k)
+		request.Headers[name] = strings.Join(v, ",")
+		request.MultiValueHeaders[name] = v
+	}
+
+	for k, v := range r.URL.Query() {
+		request.QueryStringParameters[k] = strings.Join(v, ",")
+		request.MultiValueQueryStringParameters[k] = v
+	}
+
+	return request, nil
+}
+
+func writeProxyResponse(w http.ResponseWriter, resp events.APIGatewayProxyResponse) {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	for k, vs := range resp.MultiValueHeaders {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			writeJSONMessage(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		body = decoded
+	}
+
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeJSONMessage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "{\"message\":%q}", message)
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// routingFields are the parts of an HTTP API event that identify the route. Payload 2.0
+// carries routeKey, rawPath and requestContext.http.method, none of which
+// events.APIGatewayProxyRequest has; payload 1.0 carries resource, path and httpMethod.
+type routingFields struct {
+	RouteKey       string `json:"routeKey"`
+	RawPath        string `json:"rawPath"`
+	RequestContext struct {
+		HTTP struct {
+			Method string `json:"method"`
+			Path   string `json:"path"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// LambdaHandler returns the entry point for the single-binary deployment: one Lambda
+// behind every httpApi route that dispatches to the same handlers the per-function
+// binaries run, so clients and the URL signer are initialized once and shared.
+func LambdaHandler(routes []Route) func(ctx context.Context, payload json.RawMessage) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, payload json.RawMessage) (events.APIGatewayProxyResponse, error) {
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500}, fmt.Errorf("failed to unmarshal event: %v", err)
+		}
+
+		var fields routingFields
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500}, fmt.Errorf("failed to unmarshal event: %v", err)
+		}
+
+		route, request, found := dispatch(routes, fields, request)
+		if !found {
+			return events.APIGatewayProxyResponse{StatusCode: 404, Body: `{"message":"Not Found"}`}, nil
+		}
+
+		return instrument.Flushing(instrument.Route(route.RouteKey(), route.Handler))(ctx, request)
+	}
+}
+
+// dispatch picks the route for an event: by routeKey when API Gateway supplied one, then by
+// resource and method, and finally by matching the method and path against the table.
+// The request is returned with HTTPMethod, Path and any missing path parameters filled in.
+func dispatch(routes []Route, fields routingFields, request events.APIGatewayProxyRequest) (Route, events.APIGatewayProxyRequest, bool) {
+	if request.HTTPMethod == "" {
+		request.HTTPMethod = fields.RequestContext.HTTP.Method
+	}
+	if request.Path == "" {
+		request.Path = fields.RawPath
+	}
+	if request.Path == "" {
+		request.Path = fields.RequestContext.HTTP.Path
+	}
+
+	for _, route := range routes {
+		if fields.RouteKey != "" && fields.RouteKey == route.RouteKey() {
+			return route, request, true
+		}
+	}
+
+	for _, route := range routes {
+		if request.Resource != "" && request.Resource == route.Path && strings.EqualFold(request.HTTPMethod, route.Method) {
+			return route, request, true
+		}
+	}
+
+	route, params, found := Match(routes, request.HTTPMethod, request.Path)
+	if !found {
+		return Route{}, request, false
+	}
+
+	if request.PathParameters == nil {
+		request.PathParameters = map[string]string{}
+	}
+	for k, v := range params {
+		if _, ok := request.PathParameters[k]; !ok {
+			request.PathParameters[k] = v
+		}
+	}
+
+	return route, request, true
+}
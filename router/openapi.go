@@ -0,0 +1,59 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/openapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// APIVersion is reported in the info block of the OpenAPI document
+const APIVersion = "1.0.0"
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+	specErr  error
+)
+
+// Spec describes routes as an OpenAPI 3 document
+func Spec(routes []Route) *openapi.Document {
+	endpoints := make([]openapi.Endpoint, 0, len(routes))
+	for _, route := range routes {
+		endpoints = append(endpoints, openapi.Endpoint{
+			OperationID: route.Function,
+			Method:      route.Method,
+			Path:        route.Path,
+			Summary:     route.Summary,
+			Request:     route.Request,
+			Response:    route.Response,
+			Query:       route.Query,
+			Public:      route.Public,
+		})
+	}
+
+	return openapi.Build("file-management-api", APIVersion, endpoints)
+}
+
+// SpecHandler serves GET /openapi.json, the document for Routes()
+func SpecHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	specOnce.Do(func() {
+		specJSON, specErr = json.MarshalIndent(Spec(Routes()), "", "  ")
+	})
+	if specErr != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, fmt.Errorf("failed to marshal openapi document: %v", specErr)
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		IsBase64Encoded: false,
+		Headers: map[string]string{
+			"Access-Control-Allow-Origin": "*",
+			"Content-Type":                "application/json",
+		},
+		Body: string(specJSON),
+	}, nil
+}
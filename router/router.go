@@ -0,0 +1,312 @@
+package router
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/copy_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/delete_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/delete_webhook"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/download_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/get_thumbnail"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/get_usage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_all_files"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_files"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_webhook_deliveries"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/list_webhooks"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/overwrite_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/query_audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/register_webhook"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/rename_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/responses"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/update_quota"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/handlers/upload_file"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/instrument"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/quota"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/webhooks"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerFunc is a handler with its package Response type converted back to the API Gateway one
+type HandlerFunc = instrument.HandlerFunc
+
+// Route is one httpApi event from serverless.yml
+type Route struct {
+	Function string // function name in serverless.yml
+	Method   string
+	Path     string // httpApi path, e.g. /{userId}/{fileId}
+	Handler  HandlerFunc
+
+	// Summary, Request, Response and Query describe the route in the OpenAPI document;
+	// Request, Response and Query are zero values of the types involved, nil if none
+	Summary  string
+	Request  interface{}
+	Response interface{}
+	Query    interface{}
+	// Public routes have no authorizer in serverless.yml, so HTTPHandler does not Wrap them
+	Public bool
+}
+
+// RouteKey is the route as API Gateway names it, e.g. "GET /{userId}/{fileId}"
+func (r Route) RouteKey() string {
+	return r.Method + " " + r.Path
+}
+
+// Routes mirrors the functions and httpApi events declared in serverless.yml
+func Routes() []Route {
+	return []Route{
+		{
+			Function: "uploadFile",
+			Method:   "POST",
+			Path:     "/{userId}",
+			Summary:  "Create a file record and get a URL to upload its content to",
+			Request:  upload_file.UploadFileRequest{},
+			Response: upload_file.UploadFileReturn{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := upload_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "downloadFile",
+			Method:   "GET",
+			Path:     "/{userId}/{fileId}",
+			Summary:  "Get a URL to download a file from",
+			Response: download_file.DownloadReturn{},
+			Query:    download_file.DownloadOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := download_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "deleteFile",
+			Method:   "DELETE",
+			Path:     "/{userId}/{fileId}",
+			Summary:  "Delete a file and get a URL to remove its content with",
+			Response: delete_file.DeleteReturn{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := delete_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "listUserFiles",
+			Method:   "GET",
+			Path:     "/{userId}",
+			Summary:  "List a user's files",
+			Response: []responses.File{},
+			Query:    list_files.ListFilesOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := list_files.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "listAllFiles",
+			Method:   "GET",
+			Path:     "/",
+			Summary:  "List every file (Admin only)",
+			Response: []responses.File{},
+			Query:    list_all_files.ListAllFilesOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := list_all_files.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "overwriteFile",
+			Method:   "PATCH",
+			Path:     "/{userId}/{fileId}",
+			Summary:  "Rename a file and get a URL to upload new content to",
+			Request:  overwrite_file.UploadFileRequest{},
+			Response: overwrite_file.PatchFileReturn{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := overwrite_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "renameFile",
+			Method:   "POST",
+			Path:     "/{userId}/{fileId}/rename",
+			Summary:  "Rename or move a file without changing its content",
+			Request:  rename_file.RenameFileRequest{},
+			Response: aws_usages.FileTableItem{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := rename_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "copyFile",
+			Method:   "POST",
+			Path:     "/{userId}/{fileId}/copy",
+			Summary:  "Copy a file, possibly into another user's space, without re-uploading it",
+			Request:  copy_file.CopyFileRequest{},
+			Response: aws_usages.FileTableItem{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := copy_file.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "getThumbnail",
+			Method:   "GET",
+			Path:     "/{userId}/{fileId}/thumbnail",
+			Summary:  "Get a URL to download a thumbnail of an image file from",
+			Response: get_thumbnail.ThumbnailReturn{},
+			Query:    get_thumbnail.ThumbnailOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := get_thumbnail.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "getUsage",
+			Method:   "GET",
+			Path:     "/{userId}/usage",
+			Summary:  "Get a user's storage usage and limits",
+			Response: quota.Usage{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := get_usage.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "updateQuota",
+			Method:   "PUT",
+			Path:     "/{userId}/usage",
+			Summary:  "Override a user's storage limits (Admin only)",
+			Request:  update_quota.UpdateQuotaRequest{},
+			Response: quota.Usage{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := update_quota.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "queryAudit",
+			Method:   "GET",
+			Path:     "/audit",
+			Summary:  "List the audit entries for a user's files or one file, or export them as JSON Lines (Admin only)",
+			Response: []audit.Entry{},
+			Query:    query_audit.AuditOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := query_audit.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "registerWebhook",
+			Method:   "POST",
+			Path:     "/{userId}/webhooks",
+			Summary:  "Register an endpoint to be sent the user's file events, signed with the returned secret",
+			Request:  register_webhook.RegisterWebhookRequest{},
+			Response: register_webhook.RegisterWebhookReturn{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := register_webhook.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "listWebhooks",
+			Method:   "GET",
+			Path:     "/{userId}/webhooks",
+			Summary:  "List a user's webhooks",
+			Response: []webhooks.Webhook{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := list_webhooks.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "deleteWebhook",
+			Method:   "DELETE",
+			Path:     "/{userId}/webhooks/{webhookId}",
+			Summary:  "Remove a webhook",
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := delete_webhook.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "listWebhookDeliveries",
+			Method:   "GET",
+			Path:     "/{userId}/webhooks/{webhookId}/deliveries",
+			Summary:  "List a webhook's delivery attempts, newest first",
+			Response: []webhooks.Attempt{},
+			Query:    list_webhook_deliveries.DeliveriesOptions{},
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				resp, err := list_webhook_deliveries.Handler(ctx, r)
+				return events.APIGatewayProxyResponse(resp), err
+			},
+		},
+		{
+			Function: "openapi",
+			Method:   "GET",
+			Path:     "/openapi.json",
+			Summary:  "This document",
+			Handler:  SpecHandler,
+			Public:   true,
+		},
+	}
+}
+
+// Match finds the route for method and an escaped request path, returning the raw path
+// parameters. Like API Gateway, literal segments win over {param} segments, so
+// GET /{userId}/usage is preferred to GET /{userId}/{fileId}.
+func Match(routes []Route, method string, path string) (Route, map[string]string, bool) {
+	segments := splitPath(path)
+
+	var best Route
+	var bestParams map[string]string
+	bestLiterals := -1
+	for _, route := range routes {
+		if !strings.EqualFold(route.Method, method) {
+			continue
+		}
+
+		params, literals, ok := matchPath(splitPath(route.Path), segments)
+		if ok && literals > bestLiterals {
+			best, bestParams, bestLiterals = route, params, literals
+		}
+	}
+
+	return best, bestParams, bestLiterals >= 0
+}
+
+func matchPath(pattern []string, segments []string) (map[string]string, int, bool) {
+	if len(pattern) != len(segments) {
+		return nil, 0, false
+	}
+
+	params := map[string]string{}
+	literals := 0
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			params[p[1:len(p)-1]] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+
+	return params, literals, true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
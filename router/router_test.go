@@ -0,0 +1,244 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestMatchPrefersLiteralSegments(t *testing.T) {
+	routes := Routes()
+
+	tests := []struct {
+		method, path, function string
+		params                 map[string]string
+	}{
+		{"GET", "/", "listAllFiles", map[string]string{}},
+		{"GET", "/user-1", "listUserFiles", map[string]string{"userId": "user-1"}},
+		{"POST", "/user-1/", "uploadFile", map[string]string{"userId": "user-1"}},
+		{"GET", "/user-1/usage", "getUsage", map[string]string{"userId": "user-1"}},
+		{"GET", "/user-1/abc123", "downloadFile", map[string]string{"userId": "user-1", "fileId": "abc123"}},
+		{"patch", "/user-1/abc123", "overwriteFile", map[string]string{"userId": "user-1", "fileId": "abc123"}},
+		{"POST", "/user-1/abc123/rename", "renameFile", map[string]string{"userId": "user-1", "fileId": "abc123"}},
+		{"POST", "/user-1/abc123/copy", "copyFile", map[string]string{"userId": "user-1", "fileId": "abc123"}},
+		{"GET", "/user-1/abc123/thumbnail", "getThumbnail", map[string]string{"userId": "user-1", "fileId": "abc123"}},
+		{"GET", "/audit", "queryAudit", map[string]string{}},
+		{"POST", "/user-1/webhooks", "registerWebhook", map[string]string{"userId": "user-1"}},
+		{"GET", "/user-1/webhooks", "listWebhooks", map[string]string{"userId": "user-1"}},
+		{"DELETE", "/user-1/webhooks/hook1", "deleteWebhook", map[string]string{"userId": "user-1", "webhookId": "hook1"}},
+		{"GET", "/user-1/webhooks/hook1/deliveries", "listWebhookDeliveries", map[string]string{"userId": "user-1", "webhookId": "hook1"}},
+		{"GET", "/openapi.json", "openapi", map[string]string{}},
+	}
+	for _, tt := range tests {
+		route, params, found := Match(routes, tt.method, tt.path)
+		if !found || route.Function != tt.function {
+			t.Errorf("%v %v: matched %q (found %v), want %q", tt.method, tt.path, route.Function, found, tt.function)
+			continue
+		}
+		for k, v := range tt.params {
+			if params[k] != v {
+				t.Errorf("%v %v: param %v = %q, want %q", tt.method, tt.path, k, params[k], v)
+			}
+		}
+	}
+
+	if _, _, found := Match(routes, "POST", "/user-1/abc123"); found {
+		t.Error("POST /{userId}/{fileId} should not match")
+	}
+	if _, _, found := Match(routes, "GET", "/a/b/c"); found {
+		t.Error("GET /a/b/c should not match")
+	}
+}
+
+func TestHTTPHandlerTranslatesRequest(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	h := &HTTPHandler{
+		Stage: "test",
+		Routes: []Route{{
+			Function: "echo",
+			Method:   "POST",
+			Path:     "/{userId}",
+			Handler: func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				got = r
+				return events.APIGatewayProxyResponse{
+					StatusCode: 201,
+					Headers:    map[string]string{"X-Test": "yes"},
+					Body:       `{"ok":true}`,
+				}, nil
+			},
+		}},
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/user%401?verbose=1", strings.NewReader(`{"FileName":"a.txt"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != 201 || resp.Header.Get("X-Test") != "yes" || string(body) != `{"ok":true}` {
+		t.Errorf("response = %v %v %s", resp.StatusCode, resp.Header, body)
+	}
+	if got.PathParameters["userId"] != "user%401" {
+		t.Errorf("userId = %q, want raw escaped segment", got.PathParameters["userId"])
+	}
+	if got.Headers["authorization"] != "Bearer token" {
+		t.Errorf("headers = %v", got.Headers)
+	}
+	if got.QueryStringParameters["verbose"] != "1" || got.Body != `{"FileName":"a.txt"}` {
+		t.Errorf("request = %+v", got)
+	}
+	if got.Resource != "/{userId}" || got.RequestContext.Stage != "test" || got.RequestContext.RequestID == "" {
+		t.Errorf("request context = %+v", got.RequestContext)
+	}
+}
+
+func TestHTTPHandlerNotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&HTTPHandler{}).ServeHTTP(rec, httptest.NewRequest("GET", "/nope", nil))
+
+	var msg map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if rec.Code != 404 || msg["message"] != "Not Found" {
+		t.Errorf("got %v %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLambdaHandlerDispatch(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	record := func(name string) HandlerFunc {
+		return func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			got = r
+			return events.APIGatewayProxyResponse{StatusCode: 200, Body: name}, nil
+		}
+	}
+	routes := []Route{
+		{Function: "download", Method: "GET", Path: "/{userId}/{fileId}", Handler: record("download")},
+		{Function: "usage", Method: "GET", Path: "/{userId}/usage", Handler: record("usage")},
+		{Function: "delete", Method: "DELETE", Path: "/{userId}/{fileId}", Handler: record("delete")},
+	}
+	h := LambdaHandler(routes)
+
+	tests := []struct {
+		name, payload, want string
+	}{
+		{"payload 2.0 routeKey", `{"routeKey":"GET /{userId}/usage","rawPath":"/u1/usage","pathParameters":{"userId":"u1"}}`, "usage"},
+		{"payload 1.0 resource", `{"resource":"/{userId}/{fileId}","httpMethod":"DELETE","path":"/u1/f1"}`, "delete"},
+		{"path only", `{"requestContext":{"http":{"method":"GET","path":"/u1/f1"}}}`, "download"},
+		{"no route", `{"routeKey":"POST /nowhere","rawPath":"/nowhere"}`, `{"message":"Not Found"}`},
+	}
+	for _, tt := range tests {
+		resp, err := h(context.Background(), json.RawMessage(tt.payload))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.Body != tt.want {
+			t.Errorf("%s: dispatched to %q, want %q", tt.name, resp.Body, tt.want)
+		}
+	}
+
+	h(context.Background(), json.RawMessage(`{"requestContext":{"http":{"method":"GET","path":"/u1/f1"}}}`))
+	if got.HTTPMethod != "GET" || got.PathParameters["userId"] != "u1" || got.PathParameters["fileId"] != "f1" {
+		t.Errorf("request not filled in from path: %+v", got)
+	}
+}
+
+func TestSpecServedWithoutWrap(t *testing.T) {
+	wrapped := 0
+	h := &HTTPHandler{
+		Routes: Routes(),
+		Wrap: func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				wrapped++
+				return events.APIGatewayProxyResponse{StatusCode: 401}, nil
+			}
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rec.Code != 200 || wrapped != 0 {
+		t.Fatalf("GET /openapi.json = %v, wrapped %v times", rec.Code, wrapped)
+	}
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range Routes() {
+		if _, found := doc.Paths[route.Path][strings.ToLower(route.Method)]; !found {
+			t.Errorf("%v is not documented", route.RouteKey())
+		}
+	}
+	for _, name := range []string{"UploadFileRequest", "UploadFileReturn", "overwrite_file.UploadFileRequest", "PatchFileReturn", "DownloadReturn", "DeleteReturn", "FileTableItem"} {
+		if _, found := doc.Components.Schemas[name]; !found {
+			t.Errorf("schema %v is missing", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/user-1", nil))
+	if rec.Code != 401 || wrapped != 1 {
+		t.Errorf("GET /user-1 = %v, wrapped %v times", rec.Code, wrapped)
+	}
+}
+
+// TestFunctionMains checks that every per-function binary serves a route of the table under
+// its route key, and that only the OpenAPI one links the router and with it every handler
+func TestFunctionMains(t *testing.T) {
+	keys := map[string]bool{}
+	for _, route := range Routes() {
+		keys[route.RouteKey()] = true
+	}
+
+	mains, err := filepath.Glob("../*/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := map[string]string{}
+	for _, path := range mains {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := regexp.MustCompile(`instrument\.Function\("([^"]+)"`).FindSubmatch(src)
+		if m == nil {
+			continue
+		}
+		key := string(m[1])
+		if !keys[key] {
+			t.Errorf("%v serves %q, which is not in Routes", path, key)
+		}
+		if other, found := served[key]; found {
+			t.Errorf("%v and %v both serve %q", path, other, key)
+		}
+		served[key] = path
+		if strings.Contains(string(src), "file-management-api/router\"") && key != "GET /openapi.json" {
+			t.Errorf("%v imports the router", path)
+		}
+	}
+	for key := range keys {
+		if _, found := served[key]; !found {
+			t.Errorf("no per-function binary serves %q", key)
+		}
+	}
+}
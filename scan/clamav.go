@@ -0,0 +1,186 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamAV scans with a clamd daemon, streaming content over its socket with INSTREAM.
+// clamd refuses streams longer than its StreamMaxLength (25MB by default); content over
+// MaxBytes is not sent at all, and either way Scan returns ErrTooLarge.
+type ClamAV struct {
+	Network string // "tcp" or "unix"
+	Address string
+	// Timeout bounds a whole scan when the context has no earlier deadline
+	Timeout time.Duration
+	// MaxBytes should match clamd's StreamMaxLength; zero leaves the limit to clamd
+	MaxBytes int64
+}
+
+// DefaultMaxBytes is clamd's default StreamMaxLength
+const DefaultMaxBytes int64 = 25 << 20
+
+// chunkSize is how much content goes in each INSTREAM chunk
+const chunkSize = 64 * 1024
+
+// NewClamAV returns a scanner for the clamd at address: a unix socket path (optionally
+// prefixed unix:) or host:port
+func NewClamAV(address string) *ClamAV {
+	c := &ClamAV{Network: "tcp", Address: address, Timeout: 2 * time.Minute, MaxBytes: DefaultMaxBytes}
+	if strings.HasPrefix(address, "unix:") || strings.HasPrefix(address, "/") {
+		c.Network = "unix"
+		c.Address = strings.TrimPrefix(address, "unix:")
+	}
+
+	return c
+}
+
+// Scan sends r to clamd as a stream and reads its verdict: "stream: OK" or
+// "stream: <signature> FOUND"
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("clamd: %v", err)
+	}
+
+	if err := sendChunks(conn, r, c.MaxBytes); err != nil {
+		if err == ErrTooLarge {
+			return Result{}, err
+		}
+		// clamd hangs up on streams over its limit, having written why
+		if reply, replyErr := readReply(conn); replyErr == nil && strings.HasSuffix(reply, "ERROR") {
+			return Result{}, replyError(reply)
+		}
+		return Result{}, err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %v", err)
+	}
+
+	return parseReply(reply)
+}
+
+// Ping checks clamd is up and answering
+func (c *ClamAV) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("clamd: %v", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return fmt.Errorf("clamd: %v", err)
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply to PING: %q", reply)
+	}
+
+	return nil
+}
+
+func (c *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	if _, found := ctx.Deadline(); !found && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: %v", err)
+	}
+
+	deadline, found := ctx.Deadline()
+	if !found {
+		deadline = time.Now().Add(c.Timeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("clamd: %v", err)
+	}
+
+	return conn, nil
+}
+
+// sendChunks frames r as INSTREAM chunks, each a big-endian length then that many bytes,
+// ending with a zero length. It returns ErrTooLarge, without ending the stream, once r runs
+// past maxBytes, unless that is zero.
+func sendChunks(w io.Writer, r io.Reader, maxBytes int64) error {
+	buf := make([]byte, 4+chunkSize)
+	var sent int64
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		sent += int64(n)
+		if maxBytes > 0 && sent > maxBytes {
+			return ErrTooLarge
+		}
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("clamd: %v", werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading content: %v", err)
+		}
+	}
+
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("clamd: %v", err)
+	}
+
+	return nil
+}
+
+// readReply reads one reply, which the z prefix on commands terminates with a NUL
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", err
+	}
+
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+func parseReply(reply string) (Result, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+
+	return Result{}, replyError(reply)
+}
+
+// replyError reports an error reply, recognising clamd's refusal of an oversized stream
+func replyError(reply string) error {
+	if strings.Contains(reply, "size limit exceeded") {
+		return fmt.Errorf("%w: clamd: %v", ErrTooLarge, reply)
+	}
+
+	return fmt.Errorf("clamd: %v", reply)
+}
@@ -0,0 +1,41 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// EICAR is the industry standard test file every scanner detects, for exercising quarantine
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// EICARSignature is the name Fake reports for content containing EICAR, as clamd does
+const EICARSignature = "Win.Test.EICAR_HDB-1"
+
+// Fake is a Scanner for tests and the local server: content containing EICAR is infected,
+// anything else clean. A non-nil Err is returned instead of a verdict, and ErrTooLarge for
+// content over a non-zero MaxBytes.
+type Fake struct {
+	Err      error
+	MaxBytes int64
+}
+
+func (f Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if f.MaxBytes > 0 && int64(len(content)) > f.MaxBytes {
+		return Result{}, ErrTooLarge
+	}
+	if bytes.Contains(content, []byte(EICAR)) {
+		return Result{Infected: true, Signature: EICARSignature}, nil
+	}
+
+	return Result{}, nil
+}
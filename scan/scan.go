@@ -0,0 +1,156 @@
+// Package scan checks file contents for viruses. When an upload's content is stored, the
+// object-created trigger marks the file scanning and File streams the content to the Scanner
+// and marks it clean or, when something is found, quarantined, or too_large when the Scanner
+// does not accept that much.
+// download_file and copy_file only serve clean files.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ErrTooLarge is returned by a Scanner for content longer than it accepts. The file is marked
+// too_large, which is a verdict: scanning it again would only fail the same way.
+var ErrTooLarge = errors.New("content is too large to scan")
+
+// Result is a Scanner's verdict; Signature names what was found in infected content
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner inspects content for viruses. An error means no verdict was reached.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// DefaultScanner is the clamd at CLAMD_ADDRESS, or with SCAN_DISABLED=true a scanner that
+// finds nothing; tests and the local server swap it out
+var DefaultScanner Scanner = scannerFromEnv()
+
+func scannerFromEnv() Scanner {
+	if address := os.Getenv("CLAMD_ADDRESS"); address != "" {
+		c := NewClamAV(address)
+		if raw := os.Getenv("SCAN_MAX_BYTES"); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n <= 0 {
+				logging.Default().Warn("ignoring invalid setting", "name", "SCAN_MAX_BYTES", "value", raw)
+			} else {
+				c.MaxBytes = n
+			}
+		}
+		return c
+	}
+	if os.Getenv("SCAN_DISABLED") == "true" {
+		return Disabled{}
+	}
+
+	return unconfigured{}
+}
+
+// Init checks a scanner is configured, so that a stage without one fails the function at
+// startup rather than leaving every upload scanning, never to be served
+func Init() error {
+	switch DefaultScanner.(type) {
+	case unconfigured:
+		return errNotConfigured
+	case Disabled:
+		logging.Default().Warn("virus scanning disabled, uploads are marked clean unscanned")
+	}
+
+	return nil
+}
+
+var errNotConfigured = fmt.Errorf("no virus scanner configured, set CLAMD_ADDRESS, or SCAN_DISABLED=true to mark uploads clean without scanning")
+
+type unconfigured struct{}
+
+func (unconfigured) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, errNotConfigured
+}
+
+// Disabled is the explicit opt-out from scanning: it finds nothing in any content
+type Disabled struct{}
+
+func (Disabled) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// File scans the stored content of fileID, which the caller has marked scanning, and records
+// the verdict, returning the file's new scan status. On error the file is left scanning, so
+// it is still not served, and File can be run again. It returns aws_usages.ErrFileNotFound for a file deleted in the meantime.
+func File(ctx context.Context, fileID string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "scan.File")
+	defer span.End()
+	span.SetAttributes(attribute.String("app.file_id", fileID))
+
+	status, err := scanFile(ctx, fileID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.String("app.scan_status", status))
+
+	return status, err
+}
+
+func scanFile(ctx context.Context, fileID string) (string, error) {
+	content, err := storage.Default().Open(ctx, fileID)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		// deleted between being stored and scanned; its record goes with it
+		return aws_usages.ScanStatusScanning, fmt.Errorf("%w: no content to scan", aws_usages.ErrFileNotFound)
+	}
+	if err != nil {
+		return aws_usages.ScanStatusScanning, err
+	}
+	defer content.Close()
+
+	start := time.Now()
+	result, err := DefaultScanner.Scan(ctx, content)
+	if errors.Is(err, ErrTooLarge) {
+		logging.FromContext(ctx).Warn("file too large to scan", "fileId", fileID)
+		metrics.FromContext(ctx).Emit(metrics.Dimensions{"Outcome": aws_usages.ScanStatusTooLarge},
+			metrics.Metric{Name: "FilesScanned", Value: 1, Unit: metrics.Count})
+		scanned := time.Now().UTC().Format(time.RFC3339)
+		if err := aws_usages.SetScanStatusDynamoDB(ctx, "dev-files", fileID, aws_usages.ScanStatusTooLarge, "", scanned); err != nil {
+			return aws_usages.ScanStatusScanning, err
+		}
+		return aws_usages.ScanStatusTooLarge, nil
+	}
+	if err != nil {
+		metrics.FromContext(ctx).Emit(metrics.Dimensions{"Outcome": "error"},
+			metrics.Metric{Name: "FilesScanned", Value: 1, Unit: metrics.Count})
+		return aws_usages.ScanStatusScanning, fmt.Errorf("scanning %v: %v", fileID, err)
+	}
+
+	status := aws_usages.ScanStatusClean
+	if result.Infected {
+		status = aws_usages.ScanStatusQuarantined
+		logging.FromContext(ctx).Warn("quarantined file", "fileId", fileID, "signature", result.Signature)
+	}
+	metrics.FromContext(ctx).Emit(metrics.Dimensions{"Outcome": status},
+		metrics.Metric{Name: "FilesScanned", Value: 1, Unit: metrics.Count},
+		metrics.Metric{Name: "ScanLatency", Value: float64(time.Since(start)) / float64(time.Millisecond), Unit: metrics.Milliseconds},
+	)
+
+	scanned := time.Now().UTC().Format(time.RFC3339)
+	if err := aws_usages.SetScanStatusDynamoDB(ctx, "dev-files", fileID, status, result.Signature, scanned); err != nil {
+		return aws_usages.ScanStatusScanning, err
+	}
+
+	return status, nil
+}
@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeClamd answers INSTREAM and PING as clamd does, finding EICAR and refusing streams
+// longer than maxLength
+func fakeClamd(t *testing.T, maxLength int) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxLength)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func serveClamd(conn net.Conn, maxLength int) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if content.Len()+int(size) > maxLength {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				// clamd hangs up here; reading on keeps the test from racing the reset
+				io.Copy(ioutil.Discard, r)
+				return
+			}
+			if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+				return
+			}
+		}
+
+		if strings.Contains(content.String(), EICAR) {
+			conn.Write([]byte("stream: " + EICARSignature + " FOUND\x00"))
+		} else {
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClamAV(t *testing.T) {
+	address, stop := fakeClamd(t, 200*1024)
+	defer stop()
+	ctx := context.Background()
+	clamav := NewClamAV(address)
+
+	if err := clamav.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	// spans several chunks
+	clean := strings.Repeat("a", chunkSize*2+10)
+	if result, err := clamav.Scan(ctx, strings.NewReader(clean)); err != nil || result.Infected {
+		t.Errorf("clean content: %+v, %v", result, err)
+	}
+
+	infected := strings.Repeat("a", chunkSize-10) + EICAR
+	result, err := clamav.Scan(ctx, strings.NewReader(infected))
+	if err != nil || !result.Infected || result.Signature != EICARSignature {
+		t.Errorf("infected content: %+v, %v", result, err)
+	}
+
+	// clamd's limit is lower than the one the scanner was told
+	if _, err := clamav.Scan(ctx, strings.NewReader(strings.Repeat("a", 300*1024))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("content over clamd's limit: %v", err)
+	}
+	clamav.MaxBytes = 100 * 1024
+	if _, err := clamav.Scan(ctx, strings.NewReader(strings.Repeat("a", 150*1024))); err != ErrTooLarge {
+		t.Errorf("content over MaxBytes: %v", err)
+	}
+	if _, err := clamav.Scan(ctx, strings.NewReader(strings.Repeat("a", 100*1024))); err != nil {
+		t.Errorf("content of MaxBytes: %v", err)
+	}
+
+	stop()
+	if _, err := clamav.Scan(ctx, strings.NewReader(clean)); err == nil {
+		t.Error("scan succeeded without clamd")
+	}
+}
+
+func TestNewClamAV(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		path    string
+	}{
+		{"clamd:3310", "tcp", "clamd:3310"},
+		{"/var/run/clamav/clamd.ctl", "unix", "/var/run/clamav/clamd.ctl"},
+		{"unix:/tmp/clamd.sock", "unix", "/tmp/clamd.sock"},
+	}
+	for _, tt := range tests {
+		c := NewClamAV(tt.address)
+		if c.Network != tt.network || c.Address != tt.path {
+			t.Errorf("NewClamAV(%q) = %v %v", tt.address, c.Network, c.Address)
+		}
+	}
+}
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+
+	if result, err := (Fake{}).Scan(ctx, strings.NewReader("hello")); err != nil || result.Infected {
+		t.Errorf("clean: %+v, %v", result, err)
+	}
+	if result, err := (Fake{}).Scan(ctx, strings.NewReader("x"+EICAR+"x")); err != nil || !result.Infected {
+		t.Errorf("EICAR: %+v, %v", result, err)
+	}
+	if _, err := (Fake{Err: io.ErrClosedPipe}).Scan(ctx, strings.NewReader("hello")); err != io.ErrClosedPipe {
+		t.Errorf("Err: %v", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	saved := DefaultScanner
+	defer func() { DefaultScanner = saved }()
+
+	os.Setenv("CLAMD_ADDRESS", "")
+	os.Setenv("SCAN_DISABLED", "")
+	DefaultScanner = scannerFromEnv()
+	if err := Init(); err == nil {
+		t.Error("Init succeeded without a scanner")
+	}
+
+	os.Setenv("SCAN_DISABLED", "true")
+	defer os.Setenv("SCAN_DISABLED", "")
+	DefaultScanner = scannerFromEnv()
+	if err := Init(); err != nil {
+		t.Errorf("Init with scanning disabled = %v", err)
+	}
+	if result, err := DefaultScanner.Scan(context.Background(), strings.NewReader(EICAR)); err != nil || result.Infected {
+		t.Errorf("disabled scan = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+)
+
+// CloudFrontDomain fronts the FilesBucket bucket
+const (
+	CloudFrontDomain = "https://d3kp1rtsk23gz0.cloudfront.net"
+	FilesBucket      = "dev-files"
+)
+
+// CloudFront signs URLs for the distribution with the key pair in Secrets Manager.
+// Objects are keyed by FileID in Bucket, which Copy, Open, Put and Remove work on directly.
+type CloudFront struct {
+	Domain string
+	Bucket string
+}
+
+func NewCloudFront(domain string) *CloudFront {
+	return &CloudFront{Domain: domain, Bucket: FilesBucket}
+}
+
+// UploadURL signs the distribution root; the upload is routed to its object at the edge
+func (c *CloudFront) UploadURL(ctx context.Context, fileID string) (string, error) {
+	return aws_usages.SignURL(ctx, c.Domain+"/")
+}
+
+// DownloadURL passes opts as S3's response-* query parameters. The distribution must forward
+// them to the origin; the canned policy signs the whole URL, so they cannot be altered.
+func (c *CloudFront) DownloadURL(ctx context.Context, fileID string, opts DownloadOptions) (string, error) {
+	rawURL := fmt.Sprintf("%s/%s", c.Domain, fileID)
+	if query := opts.query(); len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+
+	return aws_usages.SignURL(ctx, rawURL)
+}
+
+func (c *CloudFront) DeleteURL(ctx context.Context, fileID string) (string, error) {
+	return aws_usages.SignURL(ctx, fmt.Sprintf("%s/%s", c.Domain, fileID))
+}
+
+func (c *CloudFront) Copy(ctx context.Context, srcFileID string, dstFileID string) error {
+	return aws_usages.CopyObjectS3(ctx, c.Bucket, srcFileID, dstFileID)
+}
+
+func (c *CloudFront) Open(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return aws_usages.GetObjectS3(ctx, c.Bucket, fileID)
+}
+
+func (c *CloudFront) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	return aws_usages.PutObjectS3(ctx, c.Bucket, key, content, contentType)
+}
+
+func (c *CloudFront) Remove(ctx context.Context, key string) error {
+	return aws_usages.DeleteObjectS3(ctx, c.Bucket, key)
+}
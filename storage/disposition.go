@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Query parameters a download URL carries to override the response headers. S3 honours
+// them on signed requests and Local applies them itself; either way they are covered by
+// the URL's signature, so they cannot be changed without invalidating it.
+const (
+	ContentDispositionParam = "response-content-disposition"
+	ContentTypeParam        = "response-content-type"
+)
+
+// DownloadOptions override headers of the response to a download URL; empty fields leave
+// the stored object's headers alone
+type DownloadOptions struct {
+	ContentDisposition string
+	ContentType        string
+}
+
+func (opts DownloadOptions) query() url.Values {
+	query := url.Values{}
+	if opts.ContentDisposition != "" {
+		query.Set(ContentDispositionParam, opts.ContentDisposition)
+	}
+	if opts.ContentType != "" {
+		query.Set(ContentTypeParam, opts.ContentType)
+	}
+
+	return query
+}
+
+// previewable are the types a browser can show inline without running anything
+var previewable = map[string]bool{
+	"application/pdf": true,
+	"text/plain":      true,
+	"image/gif":       true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wav":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// ContentType is the MIME type for fileName's extension, "" if unknown
+func ContentType(fileName string) string {
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(path.Ext(fileName))))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// Previewable reports whether a file of contentType is safe to display inline. HTML, SVG
+// and the like are not, since they would run script on the CDN's origin.
+func Previewable(contentType string) bool {
+	return previewable[contentType]
+}
+
+// AttachmentOptions make the download save as fileName's base name, or display inline when
+// inline is set and the file's type is previewable
+func AttachmentOptions(fileName string, inline bool) DownloadOptions {
+	opts := DownloadOptions{ContentDisposition: ContentDisposition("attachment", path.Base(fileName))}
+
+	if inline && Previewable(ContentType(fileName)) {
+		opts.ContentDisposition = ContentDisposition("inline", path.Base(fileName))
+		// with parameters, e.g. the charset of text/plain
+		opts.ContentType = mime.TypeByExtension(strings.ToLower(path.Ext(fileName)))
+	}
+
+	return opts
+}
+
+// ContentDisposition formats a Content-Disposition header with the RFC 5987 filename*
+// parameter, which carries any UTF-8 name
+func ContentDisposition(dispositionType string, fileName string) string {
+	return dispositionType + "; filename*=UTF-8''" + encodeExtValue(fileName)
+}
+
+// encodeExtValue percent-encodes everything but RFC 5987 attr-chars
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package storage
+
+import "testing"
+
+func TestAttachmentOptions(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		inline      bool
+		disposition string
+		contentType string
+	}{
+		{"report.pdf", false, "attachment; filename*=UTF-8''report.pdf", ""},
+		{"docs/report.pdf", true, "inline; filename*=UTF-8''report.pdf", "application/pdf"},
+		{"photo.JPG", true, "inline; filename*=UTF-8''photo.JPG", "image/jpeg"},
+		{"page.html", true, "attachment; filename*=UTF-8''page.html", ""},
+		{"drawing.svg", true, "attachment; filename*=UTF-8''drawing.svg", ""},
+		{"notes.txt", true, "inline; filename*=UTF-8''notes.txt", "text/plain; charset=utf-8"},
+		{"no-extension", true, "attachment; filename*=UTF-8''no-extension", ""},
+		{"naïve \"quote\";.txt", false, "attachment; filename*=UTF-8''na%C3%AFve%20%22quote%22%3B.txt", ""},
+		{"日本.txt", false, "attachment; filename*=UTF-8''%E6%97%A5%E6%9C%AC.txt", ""},
+	}
+	for _, tt := range tests {
+		opts := AttachmentOptions(tt.fileName, tt.inline)
+		if opts.ContentDisposition != tt.disposition || opts.ContentType != tt.contentType {
+			t.Errorf("AttachmentOptions(%q, %v) = %+v", tt.fileName, tt.inline, opts)
+		}
+	}
+}
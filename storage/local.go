@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPathPrefix is where the local server mounts a Local backend
+const LocalPathPrefix = "/_storage/"
+
+var validFileID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Local keeps objects as files in Dir and issues HMAC-SHA256 signed, expiring URLs that
+// only its own ServeHTTP accepts, standing in for S3 and CloudFront during offline development.
+// A signature covers the method, the FileID, the expiry and any response header overrides,
+// so a download URL cannot be replayed as an upload, pointed at another file or given
+// another Content-Disposition.
+type Local struct {
+	Dir     string
+	BaseURL string
+	TTL     time.Duration
+	Now     func() time.Time
+
+	secret []byte
+}
+
+// NewLocal creates a backend storing under dir and signing URLs rooted at baseURL.
+// dir defaults to a directory under os.TempDir, baseURL to http://localhost:8080/_storage,
+// and an empty secret is replaced with a random one, valid for this process only.
+func NewLocal(dir string, baseURL string, secret string) (*Local, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "file-management-api")
+	}
+	if baseURL == "" {
+		baseURL = "http://localhost:8080" + strings.TrimSuffix(LocalPathPrefix, "/")
+	}
+
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate local storage secret: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage dir %v: %v", dir, err)
+	}
+
+	return &Local{
+		Dir:     dir,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		TTL:     time.Hour,
+		secret:  key,
+	}, nil
+}
+
+func (l *Local) UploadURL(ctx context.Context, fileID string) (string, error) {
+	return l.signedURL(http.MethodPut, fileID, DownloadOptions{})
+}
+
+func (l *Local) DownloadURL(ctx context.Context, fileID string, opts DownloadOptions) (string, error) {
+	return l.signedURL(http.MethodGet, fileID, opts)
+}
+
+func (l *Local) DeleteURL(ctx context.Context, fileID string) (string, error) {
+	return l.signedURL(http.MethodDelete, fileID, DownloadOptions{})
+}
+
+func (l *Local) Copy(ctx context.Context, srcFileID string, dstFileID string) error {
+	if !validFileID.MatchString(srcFileID) || !validFileID.MatchString(dstFileID) {
+		return fmt.Errorf("invalid fileId: %v or %v", srcFileID, dstFileID)
+	}
+
+	src, err := os.Open(l.Path(srcFileID))
+	if os.IsNotExist(err) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open object: %v", err)
+	}
+	defer src.Close()
+
+	return l.write(dstFileID, src)
+}
+
+func (l *Local) Open(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	if !validFileID.MatchString(fileID) {
+		return nil, fmt.Errorf("invalid fileId: %v", fileID)
+	}
+
+	f, err := os.Open(l.Path(fileID))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %v", err)
+	}
+
+	return f, nil
+}
+
+// Put stores content under key; its type is sniffed again when served
+func (l *Local) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if !validFileID.MatchString(key) {
+		return fmt.Errorf("invalid key: %v", key)
+	}
+
+	return l.write(key, bytes.NewReader(content))
+}
+
+func (l *Local) Remove(ctx context.Context, key string) error {
+	if !validFileID.MatchString(key) {
+		return fmt.Errorf("invalid key: %v", key)
+	}
+
+	if err := os.Remove(l.Path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove object: %v", err)
+	}
+
+	return nil
+}
+
+// Path is where the object for fileID is kept on disk
+func (l *Local) Path(fileID string) string {
+	return filepath.Join(l.Dir, fileID)
+}
+
+func (l *Local) signedURL(method string, fileID string, opts DownloadOptions) (string, error) {
+	if !validFileID.MatchString(fileID) {
+		return "", fmt.Errorf("invalid fileId: %v", fileID)
+	}
+
+	expires := strconv.FormatInt(l.now().Add(l.TTL).Unix(), 10)
+	query := opts.query()
+	query.Set("method", method)
+	query.Set("expires", expires)
+	query.Set("signature", l.signature(method, fileID, expires, opts))
+
+	return fmt.Sprintf("%s/%s?%s", l.BaseURL, fileID, query.Encode()), nil
+}
+
+func (l *Local) signature(method string, fileID string, expires string, opts DownloadOptions) string {
+	mac := hmac.New(sha256.New, l.secret)
+	io.WriteString(mac, method+"\n"+fileID+"\n"+expires+"\n"+opts.query().Encode())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// overrides reads the response header overrides from a signed URL's query
+func overrides(query url.Values) DownloadOptions {
+	return DownloadOptions{
+		ContentDisposition: query.Get(ContentDispositionParam),
+		ContentType:        query.Get(ContentTypeParam),
+	}
+}
+
+// Verify checks that a URL signed for method and fileID has not been tampered with or expired
+func (l *Local) Verify(method string, fileID string, query url.Values) error {
+	if query.Get("method") != method {
+		return fmt.Errorf("url was not signed for %v", method)
+	}
+
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expires")
+	}
+
+	want := l.signature(method, fileID, expires, overrides(query))
+	if !hmac.Equal([]byte(want), []byte(query.Get("signature"))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if l.now().After(time.Unix(unix, 0)) {
+		return fmt.Errorf("url expired")
+	}
+
+	return nil
+}
+
+// ServeHTTP answers the signed URLs: PUT stores the request body, GET and HEAD return the
+// object, DELETE removes it. The FileID is the last path segment.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fileID := path.Base(r.URL.Path)
+	if !validFileID.MatchString(fileID) {
+		http.Error(w, "invalid fileId", http.StatusBadRequest)
+		return
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if err := l.Verify(method, fileID, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if err := l.write(fileID, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		f, err := os.Open(l.Path(fileID))
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		opts := overrides(r.URL.Query())
+		if opts.ContentDisposition != "" {
+			w.Header().Set("Content-Disposition", opts.ContentDisposition)
+		}
+		if opts.ContentType != "" {
+			w.Header().Set("Content-Type", opts.ContentType)
+		}
+		http.ServeContent(w, r, fileID, info.ModTime(), f)
+	case http.MethodDelete:
+		if err := os.Remove(l.Path(fileID)); err != nil && !os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// write stores the object through a temp file so readers never see a partial upload
+func (l *Local) write(fileID string, body io.Reader) error {
+	tmp, err := ioutil.TempFile(l.Dir, "."+fileID+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object: %v", err)
+	}
+
+	return os.Rename(tmp.Name(), l.Path(fileID))
+}
+
+func (l *Local) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
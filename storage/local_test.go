@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ctx = context.Background()
+
+func newTestLocal(t *testing.T) (*Local, *httptest.Server) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	l, err := NewLocal(t.TempDir(), srv.URL+strings.TrimSuffix(LocalPathPrefix, "/"), "test-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle(LocalPathPrefix, l)
+
+	return l, srv
+}
+
+func do(t *testing.T, method string, rawURL string, body string) (int, string) {
+	req, err := http.NewRequest(method, rawURL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	upload, _ := l.UploadURL(ctx, "file1")
+	if code, body := do(t, "PUT", upload, "hello"); code != 200 {
+		t.Fatalf("PUT: %v %v", code, body)
+	}
+
+	download, _ := l.DownloadURL(ctx, "file1", DownloadOptions{})
+	if code, body := do(t, "GET", download, ""); code != 200 || body != "hello" {
+		t.Fatalf("GET: %v %q", code, body)
+	}
+
+	del, _ := l.DeleteURL(ctx, "file1")
+	if code, _ := do(t, "DELETE", del, ""); code != 204 {
+		t.Fatalf("DELETE: %v", code)
+	}
+	if code, _ := do(t, "GET", download, ""); code != 404 {
+		t.Errorf("GET after delete: %v, want 404", code)
+	}
+}
+
+func TestLocalRejectsBadURLs(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	download, _ := l.DownloadURL(ctx, "file1", DownloadOptions{})
+	if code, _ := do(t, "PUT", download, "x"); code != 403 {
+		t.Errorf("download URL used for PUT: %v, want 403", code)
+	}
+
+	other := strings.Replace(download, "/file1?", "/file2?", 1)
+	if code, _ := do(t, "GET", other, ""); code != 403 {
+		t.Errorf("signature moved to another file: %v, want 403", code)
+	}
+
+	l.Now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	expired, _ := l.DownloadURL(ctx, "file1", DownloadOptions{})
+	l.Now = nil
+	if code, _ := do(t, "GET", expired, ""); code != 403 {
+		t.Errorf("expired URL: %v, want 403", code)
+	}
+
+	if _, err := l.UploadURL(ctx, "../etc/passwd"); err == nil {
+		t.Error("expected invalid fileId to be refused")
+	}
+}
+
+func TestLocalCopy(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	upload, _ := l.UploadURL(ctx, "original")
+	do(t, "PUT", upload, "contents")
+
+	if err := l.Copy(ctx, "original", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	download, _ := l.DownloadURL(ctx, "duplicate", DownloadOptions{})
+	if code, body := do(t, "GET", download, ""); code != 200 || body != "contents" {
+		t.Errorf("GET copy: %v %q", code, body)
+	}
+
+	if err := l.Copy(ctx, "missing", "other"); err != ErrObjectNotFound {
+		t.Errorf("copy of missing object = %v, want ErrObjectNotFound", err)
+	}
+	if err := l.Copy(ctx, "original", "../escape"); err == nil {
+		t.Error("copy to an invalid fileId succeeded")
+	}
+}
+
+func TestLocalOpen(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	upload, _ := l.UploadURL(ctx, "file1")
+	do(t, "PUT", upload, "contents")
+
+	r, err := l.Open(ctx, "file1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "contents" {
+		t.Errorf("Open read %q", data)
+	}
+
+	if _, err := l.Open(ctx, "missing"); err != ErrObjectNotFound {
+		t.Errorf("open of missing object = %v, want ErrObjectNotFound", err)
+	}
+	if _, err := l.Open(ctx, "../escape"); err == nil {
+		t.Error("open of an invalid fileId succeeded")
+	}
+}
+
+func TestLocalPutRemove(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	if err := l.Put(ctx, "file1_thumb_small", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	download, _ := l.DownloadURL(ctx, "file1_thumb_small", DownloadOptions{})
+	if status, body := do(t, "GET", download, ""); status != 200 || body != "png" {
+		t.Errorf("GET of put object = %v %q", status, body)
+	}
+
+	if err := l.Remove(ctx, "file1_thumb_small"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Open(ctx, "file1_thumb_small"); err != ErrObjectNotFound {
+		t.Errorf("open after Remove = %v, want ErrObjectNotFound", err)
+	}
+	if err := l.Remove(ctx, "file1_thumb_small"); err != nil {
+		t.Errorf("removing a missing object: %v", err)
+	}
+
+	if err := l.Put(ctx, "../escape", nil, ""); err == nil {
+		t.Error("put of an invalid key succeeded")
+	}
+}
+
+func TestLocalDownloadOverrides(t *testing.T) {
+	l, srv := newTestLocal(t)
+	defer srv.Close()
+
+	upload, _ := l.UploadURL(ctx, "file1")
+	do(t, "PUT", upload, "%PDF-")
+
+	download, _ := l.DownloadURL(ctx, "file1", AttachmentOptions("reports/Q1 résumé.pdf", true))
+	resp, err := http.Get(download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Disposition"); got != "inline; filename*=UTF-8''Q1%20r%C3%A9sum%C3%A9.pdf" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// the overrides are signed, so they cannot be swapped for others
+	tampered := strings.Replace(download, "inline", "attachment", 1)
+	if code, _ := do(t, "GET", tampered, ""); code != 403 {
+		t.Errorf("GET with altered disposition: %v, want 403", code)
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+)
+
+// Storage issues the signed URLs clients use to move file contents, so API handlers never
+// touch object bytes themselves; only background work like virus scanning and thumbnailing
+// reads and writes them.
+// Keys are opaque strings to a backend, which stores and signs whatever it is given. They
+// come in three shapes: a FileID for a file's own content, blob_<uuid> for content shared by
+// a user's files with one digest (dedup.NewKey), and <fileID>_thumb_<size> for a thumbnail,
+// where the prefix is the FileID or blob key of the content it was rendered from
+// (thumbnail.Key). Where a method names its key fileID, any of the three is accepted.
+type Storage interface {
+	// UploadURL is where the client PUTs the contents of a new or overwritten file
+	UploadURL(ctx context.Context, fileID string) (string, error)
+	// DownloadURL is where the client GETs the file's contents, with opts applied to the response
+	DownloadURL(ctx context.Context, fileID string, opts DownloadOptions) (string, error)
+	// DeleteURL is where the client sends DELETE to remove the file's contents
+	DeleteURL(ctx context.Context, fileID string) (string, error)
+	// Copy duplicates the contents of srcFileID as dstFileID on the server side,
+	// returning ErrObjectNotFound if srcFileID has no contents
+	Copy(ctx context.Context, srcFileID string, dstFileID string) error
+	// Open reads the contents of fileID, returning ErrObjectNotFound if it has none.
+	// Callers must close the reader.
+	Open(ctx context.Context, fileID string) (io.ReadCloser, error)
+	// Put stores content the API generated itself, such as a thumbnail, under key
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	// Remove deletes the object under key, succeeding if there is none
+	Remove(ctx context.Context, key string) error
+}
+
+// ErrObjectNotFound is returned by Copy and Open when the file has no contents
+var ErrObjectNotFound = aws_usages.ErrObjectNotFound
+
+var (
+	defaultMu      sync.Mutex
+	defaultStorage Storage
+)
+
+// Init builds the process-wide backend from the environment unless one is already set, so
+// that a misconfiguration fails the function at startup rather than in a request
+func Init() error {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultStorage != nil {
+		return nil
+	}
+	s, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	defaultStorage = s
+
+	return nil
+}
+
+// Default returns the process-wide backend, built from the environment on first use. If the
+// environment is misconfigured every call on it fails with the configuration error; FromEnv
+// only fails on a misconfigured local backend, and we refuse to fall back to AWS behind the
+// developer's back.
+func Default() Storage {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultStorage == nil {
+		s, err := FromEnv()
+		if err != nil {
+			return unavailable{err}
+		}
+		defaultStorage = s
+	}
+
+	return defaultStorage
+}
+
+// SetDefault replaces the process-wide backend, e.g. in tests
+func SetDefault(s Storage) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultStorage = s
+}
+
+// FromEnv selects the backend named by STORAGE_BACKEND: "cloudfront" (the default) or "local".
+// The local backend reads LOCAL_STORAGE_DIR, LOCAL_STORAGE_URL and LOCAL_STORAGE_SECRET.
+func FromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "cloudfront":
+		return NewCloudFront(CloudFrontDomain), nil
+	case "local":
+		return NewLocal(os.Getenv("LOCAL_STORAGE_DIR"), os.Getenv("LOCAL_STORAGE_URL"), os.Getenv("LOCAL_STORAGE_SECRET"))
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %v", backend)
+	}
+}
+
+// unavailable is the backend of a misconfigured environment
+type unavailable struct {
+	err error
+}
+
+func (u unavailable) UploadURL(ctx context.Context, fileID string) (string, error) {
+	return "", u.err
+}
+
+func (u unavailable) DownloadURL(ctx context.Context, fileID string, opts DownloadOptions) (string, error) {
+	return "", u.err
+}
+
+func (u unavailable) DeleteURL(ctx context.Context, fileID string) (string, error) {
+	return "", u.err
+}
+
+func (u unavailable) Copy(ctx context.Context, srcFileID string, dstFileID string) error {
+	return u.err
+}
+
+func (u unavailable) Open(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return nil, u.err
+}
+
+func (u unavailable) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	return u.err
+}
+
+func (u unavailable) Remove(ctx context.Context, key string) error {
+	return u.err
+}
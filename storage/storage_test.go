@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMisconfiguredDefault(t *testing.T) {
+	defer os.Unsetenv("STORAGE_BACKEND")
+	os.Setenv("STORAGE_BACKEND", "floppy")
+	SetDefault(nil)
+	defer SetDefault(nil)
+
+	if err := Init(); err == nil || !strings.Contains(err.Error(), "floppy") {
+		t.Errorf("Init() = %v", err)
+	}
+
+	// a request that gets this far fails rather than panicking
+	if _, err := Default().UploadURL(ctx, "abc"); err == nil || !strings.Contains(err.Error(), "floppy") {
+		t.Errorf("UploadURL on a misconfigured backend = %v", err)
+	}
+}
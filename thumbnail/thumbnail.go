@@ -0,0 +1,275 @@
+// Package thumbnail renders small previews of image files. Once an upload's content has
+// passed its virus scan, Render decodes it (JPEG, PNG, GIF or WebP, in pure Go), scales it to
+// fit each of Sizes, stores the renditions beside the file's content and records them on its
+// item. Other content gets no thumbnails. PDF previews were asked for with image thumbnails
+// but are out of scope: rasterizing a PDF needs a renderer such as pdfium or MuPDF, which is
+// cgo or a separate binary, and the functions are built as pure Go.
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers decoders with image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/storage"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Size is a rendition's name and the box it is scaled to fit, keeping its aspect ratio.
+// Images smaller than the box are not enlarged.
+type Size struct {
+	Name string
+	Max  int
+}
+
+// Sizes are the renditions generated for every image, smallest first
+var Sizes = []Size{
+	{Name: "small", Max: 128},
+	{Name: "medium", Max: 512},
+	{Name: "large", Max: 1024},
+}
+
+// DefaultSize is served when no size is asked for
+const DefaultSize = "medium"
+
+// Limits on what is decoded, so one upload cannot exhaust objectCreated's 1024 MB. At the
+// limits the source (50 MiB), a 16-bit PNG decoded at 8 bytes a pixel (192 MB) and the
+// scaler's intermediate for the large rendition (up to 1024 x 4899 x 32 bytes, 160 MB) come
+// to about 400 MB, leaving room for the garbage collector. Keep them in step with memorySize.
+const (
+	MaxSourceBytes  = 50 << 20
+	MaxSourcePixels = 24 * 1000 * 1000
+)
+
+// JPEGQuality is used for opaque images; images with transparency are rendered as PNG
+const JPEGQuality = 80
+
+// ErrNotImage is returned by Generate for content it cannot decode as an image
+var ErrNotImage = errors.New("not a supported image")
+
+// Lookup returns the size named name
+func Lookup(name string) (Size, bool) {
+	for _, size := range Sizes {
+		if size.Name == name {
+			return size, true
+		}
+	}
+
+	return Size{}, false
+}
+
+// Key is where the rendition of fileID at size is stored
+func Key(fileID string, size string) string {
+	return fileID + "_thumb_" + size
+}
+
+// Rendition is one generated thumbnail
+type Rendition struct {
+	aws_usages.Thumbnail
+	Content []byte
+}
+
+// Generate decodes an image and renders it at each of Sizes
+func Generate(content []byte) ([]Rendition, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxSourcePixels {
+		return nil, fmt.Errorf("image of %vx%v pixels is too large to thumbnail", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	var renditions []Rendition
+	for _, size := range Sizes {
+		rendition, err := render(src, size)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+func render(src image.Image, size Size) (Rendition, error) {
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), size.Max)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	rendition := Rendition{Thumbnail: aws_usages.Thumbnail{Size: size.Name, Width: width, Height: height}}
+	var buf bytes.Buffer
+	if dst.Opaque() {
+		rendition.ContentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return rendition, fmt.Errorf("failed to encode %v thumbnail: %v", size.Name, err)
+		}
+	} else {
+		rendition.ContentType = "image/png"
+		if err := png.Encode(&buf, dst); err != nil {
+			return rendition, fmt.Errorf("failed to encode %v thumbnail: %v", size.Name, err)
+		}
+	}
+	rendition.Content = buf.Bytes()
+
+	return rendition, nil
+}
+
+// fit scales width x height down to fit within max x max, keeping at least one pixel a side
+func fit(width int, height int, max int) (int, int) {
+	if width <= max && height <= max {
+		return width, height
+	}
+
+	if width >= height {
+		height = height * max / width
+		width = max
+	} else {
+		width = width * max / height
+		height = max
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	return width, height
+}
+
+// Render generates and stores the thumbnails of fileID's content, replacing any it had, and
+// records them on its item. Content that is not an image leaves the file without thumbnails.
+func Render(ctx context.Context, fileID string) ([]aws_usages.Thumbnail, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "thumbnail.Render")
+	defer span.End()
+	span.SetAttributes(attribute.String("app.file_id", fileID))
+
+	thumbnails, err := renderFile(ctx, fileID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("app.thumbnails", len(thumbnails)))
+
+	return thumbnails, err
+}
+
+func renderFile(ctx context.Context, fileID string) ([]aws_usages.Thumbnail, error) {
+	reader, err := storage.Default().Open(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(reader, MaxSourceBytes+1))
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %v", err)
+	}
+
+	if len(content) > MaxSourceBytes {
+		return nil, clearAfter(ctx, fileID, fmt.Errorf("content over %v bytes is too large to thumbnail", MaxSourceBytes))
+	}
+
+	start := time.Now()
+	renditions, err := Generate(content)
+	if err == ErrNotImage {
+		// the file may have been an image before being overwritten
+		return nil, Clear(ctx, fileID)
+	}
+	if err != nil {
+		return nil, clearAfter(ctx, fileID, err)
+	}
+	metrics.FromContext(ctx).Emit(nil,
+		metrics.Metric{Name: "ThumbnailsRendered", Value: float64(len(renditions)), Unit: metrics.Count},
+		metrics.Metric{Name: "ThumbnailLatency", Value: float64(time.Since(start)) / float64(time.Millisecond), Unit: metrics.Milliseconds},
+	)
+
+	var thumbnails []aws_usages.Thumbnail
+	for _, rendition := range renditions {
+		if err := storage.Default().Put(ctx, Key(fileID, rendition.Size), rendition.Content, rendition.ContentType); err != nil {
+			return nil, fmt.Errorf("failed to store %v thumbnail: %v", rendition.Size, err)
+		}
+		thumbnails = append(thumbnails, rendition.Thumbnail)
+	}
+
+	if err := aws_usages.SetThumbnailsDynamoDB(ctx, "dev-files", fileID, thumbnails); err != nil {
+		return nil, err
+	}
+
+	return thumbnails, nil
+}
+
+// Clear removes fileID's thumbnails from its item, then deletes the stored renditions
+func Clear(ctx context.Context, fileID string) error {
+	if err := aws_usages.SetThumbnailsDynamoDB(ctx, "dev-files", fileID, nil); err != nil {
+		return err
+	}
+
+	Remove(ctx, fileID)
+	return nil
+}
+
+// clearAfter clears fileID's thumbnails, which no longer match its content, and returns err
+func clearAfter(ctx context.Context, fileID string, err error) error {
+	if clearErr := Clear(ctx, fileID); clearErr != nil {
+		return fmt.Errorf("%v, and clearing thumbnails: %v", err, clearErr)
+	}
+
+	return err
+}
+
+// Copy stores the renditions listed in thumbnails, rendered from the content under srcKey, as
+// fileID's. On failure the renditions already copied are removed again.
+func Copy(ctx context.Context, srcKey string, fileID string, thumbnails []aws_usages.Thumbnail) error {
+	for _, t := range thumbnails {
+		if err := storage.Default().Copy(ctx, Key(srcKey, t.Size), Key(fileID, t.Size)); err != nil {
+			Remove(ctx, fileID)
+			return fmt.Errorf("failed to copy %v thumbnail: %v", t.Size, err)
+		}
+	}
+
+	return nil
+}
+
+// Remove deletes any stored thumbnails of fileID, logging rather than returning failures;
+// a leftover rendition is unreachable once no item lists it
+func Remove(ctx context.Context, fileID string) {
+	for _, size := range Sizes {
+		if err := storage.Default().Remove(ctx, Key(fileID, size.Name)); err != nil {
+			logging.FromContext(ctx).Error("failed to remove thumbnail", "fileId", fileID, "size", size.Name, "error", err)
+		}
+	}
+}
+
+// IsKey reports whether an object key is a thumbnail's rather than a file's content
+func IsKey(key string) bool {
+	for _, size := range Sizes {
+		if strings.HasSuffix(key, "_thumb_"+size.Name) {
+			return true
+		}
+	}
+
+	return false
+}
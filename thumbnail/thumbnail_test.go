@@ -0,0 +1,132 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func gradient(width int, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: alpha})
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, format string, img image.Image) []byte {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		// the rendition at each of Sizes
+		widths, heights []int
+	}{
+		{"jpeg", encode(t, "jpeg", gradient(2048, 1024, 255)), "image/jpeg", []int{128, 512, 1024}, []int{64, 256, 512}},
+		{"png portrait", encode(t, "png", gradient(300, 600, 255)), "image/jpeg", []int{64, 256, 300}, []int{128, 512, 600}},
+		{"gif", encode(t, "gif", gradient(100, 50, 255)), "image/jpeg", []int{100, 100, 100}, []int{50, 50, 50}},
+		{"transparent png", encode(t, "png", gradient(256, 256, 100)), "image/png", []int{128, 256, 256}, []int{128, 256, 256}},
+	}
+	for _, tt := range tests {
+		renditions, err := Generate(tt.content)
+		if err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if len(renditions) != len(Sizes) {
+			t.Errorf("%v: %v renditions, want %v", tt.name, len(renditions), len(Sizes))
+			continue
+		}
+
+		for i, r := range renditions {
+			if r.Size != Sizes[i].Name || r.Width != tt.widths[i] || r.Height != tt.heights[i] || r.ContentType != tt.contentType {
+				t.Errorf("%v: rendition %v = %v %vx%v %v, want %v %vx%v %v", tt.name, i,
+					r.Size, r.Width, r.Height, r.ContentType, Sizes[i].Name, tt.widths[i], tt.heights[i], tt.contentType)
+			}
+
+			decoded, format, err := image.Decode(bytes.NewReader(r.Content))
+			if err != nil || "image/"+format != r.ContentType {
+				t.Errorf("%v: rendition %v decodes as %v: %v", tt.name, i, format, err)
+				continue
+			}
+			if b := decoded.Bounds(); b.Dx() != r.Width || b.Dy() != r.Height {
+				t.Errorf("%v: rendition %v is %vx%v, recorded as %vx%v", tt.name, i, b.Dx(), b.Dy(), r.Width, r.Height)
+			}
+		}
+	}
+}
+
+func TestGenerateRejects(t *testing.T) {
+	for _, content := range [][]byte{nil, []byte("%PDF-1.4"), []byte("plain text")} {
+		if _, err := Generate(content); err != ErrNotImage {
+			t.Errorf("Generate(%q) = %v, want ErrNotImage", content, err)
+		}
+	}
+
+	// a header claiming more pixels than MaxSourcePixels is refused before decoding
+	for _, dims := range [][2]uint32{{65536, 65536}, {6000, 4001}} {
+		var buf bytes.Buffer
+		png.Encode(&buf, gradient(1, 1, 255))
+		huge := buf.Bytes()
+		binary.BigEndian.PutUint32(huge[16:20], dims[0])
+		binary.BigEndian.PutUint32(huge[20:24], dims[1])
+		binary.BigEndian.PutUint32(huge[29:33], crc32.ChecksumIEEE(huge[12:29]))
+		if _, err := Generate(huge); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("Generate of a %vx%v image = %v", dims[0], dims[1], err)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct{ width, height, max, wantWidth, wantHeight int }{
+		{100, 50, 128, 100, 50},
+		{1000, 500, 100, 100, 50},
+		{500, 1000, 100, 50, 100},
+		{5000, 1, 100, 100, 1},
+	}
+	for _, tt := range tests {
+		if w, h := fit(tt.width, tt.height, tt.max); w != tt.wantWidth || h != tt.wantHeight {
+			t.Errorf("fit(%v, %v, %v) = %v, %v, want %v, %v", tt.width, tt.height, tt.max, w, h, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for _, size := range Sizes {
+		if !IsKey(Key("abc123", size.Name)) {
+			t.Errorf("IsKey(%q) = false", Key("abc123", size.Name))
+		}
+	}
+	if IsKey("abc123") || IsKey("abc123_thumb_huge") {
+		t.Error("IsKey matched a file's key")
+	}
+	if _, found := Lookup(DefaultSize); !found {
+		t.Errorf("DefaultSize %q is not one of Sizes", DefaultSize)
+	}
+}
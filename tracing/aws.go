@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DynamoDBKeyKey lists the keys of the items a DynamoDB call reads or writes, as name=value pairs
+const DynamoDBKeyKey = attribute.Key("aws.dynamodb.key")
+
+// DynamoDBCapacityUnitsKey is the total capacity a DynamoDB call consumed, which is easier
+// to sum and chart than the per-table JSON of aws.dynamodb.consumed_capacity
+const DynamoDBCapacityUnitsKey = attribute.Key("aws.dynamodb.consumed_capacity_units")
+
+type awsSpanKey struct{}
+
+// AWS opens a child span for every call of an AWS client it is added to, retries included,
+// under the span in the call's context:
+//
+//	tracing.AWS(&svc.Handlers)
+//
+// DynamoDB spans carry the tables and keys involved and the capacity consumed, which the
+// calls are made to return while the span is being recorded.
+func AWS(handlers *request.Handlers) {
+	handlers.Validate.PushFrontNamed(request.NamedHandler{Name: "tracing.StartAWSSpan", Fn: startAWSSpan})
+	handlers.Complete.PushBackNamed(request.NamedHandler{Name: "tracing.EndAWSSpan", Fn: endAWSSpan})
+}
+
+func startAWSSpan(r *request.Request) {
+	service := r.ClientInfo.ServiceID
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("aws-api"),
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(r.Operation.Name),
+		semconv.CloudRegionKey.String(aws.StringValue(r.Config.Region)),
+	}
+
+	ctx, span := Tracer().Start(r.Context(), service+"."+r.Operation.Name,
+		trace.WithSpanKind(trace.SpanKindClient))
+	if span.IsRecording() {
+		attrs = append(attrs, paramAttributes(r.Params)...)
+	}
+	span.SetAttributes(attrs...)
+
+	r.SetContext(context.WithValue(ctx, awsSpanKey{}, span))
+}
+
+func endAWSSpan(r *request.Request) {
+	span, ok := r.Context().Value(awsSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if r.RequestID != "" {
+		span.SetAttributes(attribute.String("aws.request_id", r.RequestID))
+	}
+	if r.HTTPResponse != nil {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.HTTPResponse.StatusCode))
+	}
+	if r.Error == nil {
+		span.SetAttributes(capacityAttributes(r.Data)...)
+	} else {
+		span.RecordError(r.Error)
+		span.SetStatus(codes.Error, r.Error.Error())
+	}
+
+	span.End()
+}
+
+// paramAttributes describes what a call acts on. For DynamoDB it also asks for the consumed
+// capacity, since the response only carries it when the request does.
+func paramAttributes(params interface{}) []attribute.KeyValue {
+	var tables, keys []string
+	total := aws.String(dynamodb.ReturnConsumedCapacityTotal)
+
+	switch in := params.(type) {
+	case *dynamodb.GetItemInput:
+		in.ReturnConsumedCapacity = total
+		tables, keys = []string{aws.StringValue(in.TableName)}, []string{formatKey(in.Key)}
+	case *dynamodb.PutItemInput:
+		in.ReturnConsumedCapacity = total
+		tables = []string{aws.StringValue(in.TableName)}
+	case *dynamodb.UpdateItemInput:
+		in.ReturnConsumedCapacity = total
+		tables, keys = []string{aws.StringValue(in.TableName)}, []string{formatKey(in.Key)}
+	case *dynamodb.DeleteItemInput:
+		in.ReturnConsumedCapacity = total
+		tables, keys = []string{aws.StringValue(in.TableName)}, []string{formatKey(in.Key)}
+	case *dynamodb.ScanInput:
+		in.ReturnConsumedCapacity = total
+		tables = []string{aws.StringValue(in.TableName)}
+	case *dynamodb.TransactWriteItemsInput:
+		in.ReturnConsumedCapacity = total
+		for _, item := range in.TransactItems {
+			switch {
+			case item.Put != nil:
+				tables = append(tables, aws.StringValue(item.Put.TableName))
+			case item.Update != nil:
+				tables = append(tables, aws.StringValue(item.Update.TableName))
+				keys = append(keys, formatKey(item.Update.Key))
+			case item.Delete != nil:
+				tables = append(tables, aws.StringValue(item.Delete.TableName))
+				keys = append(keys, formatKey(item.Delete.Key))
+			case item.ConditionCheck != nil:
+				tables = append(tables, aws.StringValue(item.ConditionCheck.TableName))
+				keys = append(keys, formatKey(item.ConditionCheck.Key))
+			}
+		}
+	case *s3.CopyObjectInput:
+		return []attribute.KeyValue{
+			attribute.String("aws.s3.bucket", aws.StringValue(in.Bucket)),
+			attribute.String("aws.s3.key", aws.StringValue(in.Key)),
+			attribute.String("aws.s3.copy_source", aws.StringValue(in.CopySource)),
+		}
+	default:
+		return nil
+	}
+
+	attrs := []attribute.KeyValue{semconv.AWSDynamoDBTableNamesKey.StringSlice(tables)}
+	if len(keys) > 0 {
+		attrs = append(attrs, DynamoDBKeyKey.StringSlice(keys))
+	}
+	return attrs
+}
+
+// formatKey renders an item key as FileID=abc123, with composite keys' parts sorted by name
+func formatKey(key map[string]*dynamodb.AttributeValue) string {
+	parts := make([]string, 0, len(key))
+	for name, value := range key {
+		switch {
+		case value.S != nil:
+			parts = append(parts, name+"="+*value.S)
+		case value.N != nil:
+			parts = append(parts, name+"="+*value.N)
+		default:
+			parts = append(parts, fmt.Sprintf("%s=%v", name, value))
+		}
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+// capacityAttributes reads the consumed capacity off a DynamoDB response
+func capacityAttributes(data interface{}) []attribute.KeyValue {
+	var consumed []*dynamodb.ConsumedCapacity
+
+	switch out := data.(type) {
+	case *dynamodb.GetItemOutput:
+		consumed = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.PutItemOutput:
+		consumed = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.UpdateItemOutput:
+		consumed = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.DeleteItemOutput:
+		consumed = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.ScanOutput:
+		consumed = []*dynamodb.ConsumedCapacity{out.ConsumedCapacity}
+	case *dynamodb.TransactWriteItemsOutput:
+		consumed = out.ConsumedCapacity
+	default:
+		return nil
+	}
+
+	var total float64
+	var encoded []string
+	for _, c := range consumed {
+		if c == nil {
+			continue
+		}
+		total += aws.Float64Value(c.CapacityUnits)
+		if b, err := json.Marshal(c); err == nil {
+			encoded = append(encoded, string(b))
+		}
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	return []attribute.KeyValue{
+		semconv.AWSDynamoDBConsumedCapacityKey.StringSlice(encoded),
+		DynamoDBCapacityUnitsKey.Float64(total),
+	}
+}
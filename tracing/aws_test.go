@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAWSSpans(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	saved := Default()
+	SetDefault(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	defer SetDefault(saved)
+
+	var sent map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		if sent["Key"].(map[string]interface{})["FileID"].(map[string]interface{})["S"] == "missing" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"no table"}`))
+			return
+		}
+		w.Write([]byte(`{"Item":{},"ConsumedCapacity":{"TableName":"dev-files","CapacityUnits":0.5}}`))
+	}))
+	defer srv.Close()
+
+	svc := dynamodb.New(session.New(), aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(srv.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithMaxRetries(0))
+	AWS(&svc.Handlers)
+
+	ctx, parent := Tracer().Start(context.Background(), "GET /{userId}/{fileId}")
+	for _, fileID := range []string{"abc123", "missing"} {
+		svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String("dev-files"),
+			Key:       map[string]*dynamodb.AttributeValue{"FileID": {S: aws.String(fileID)}},
+		})
+	}
+	parent.End()
+
+	if sent["ReturnConsumedCapacity"] != "TOTAL" {
+		t.Errorf("request did not ask for consumed capacity: %v", sent)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("ended %v spans", len(ended))
+	}
+	ok, failed := ended[0], ended[1]
+	if ok.Name() != "DynamoDB.GetItem" || ok.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %v is not a child of the request span", ok.Name())
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range ok.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if tables := attrs["aws.dynamodb.table_names"].AsStringSlice(); len(tables) != 1 || tables[0] != "dev-files" {
+		t.Errorf("tables = %v", tables)
+	}
+	if keys := attrs[DynamoDBKeyKey].AsStringSlice(); len(keys) != 1 || keys[0] != "FileID=abc123" {
+		t.Errorf("keys = %v", keys)
+	}
+	if units := attrs[DynamoDBCapacityUnitsKey].AsFloat64(); units != 0.5 {
+		t.Errorf("consumed capacity = %v", units)
+	}
+	if ok.Status().Code == codes.Error {
+		t.Errorf("successful call marked failed: %v", ok.Status())
+	}
+
+	if failed.Status().Code != codes.Error || len(failed.Events()) == 0 {
+		t.Errorf("failed call status = %v, events = %v", failed.Status(), failed.Events())
+	}
+}
+
+func TestFormatKey(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{
+		"UserID":  {S: aws.String("user-1")},
+		"Version": {N: aws.String("3")},
+	}
+	if got := formatKey(key); got != "UserID=user-1,Version=3" {
+		t.Errorf("formatKey = %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator reads the W3C traceparent header, so a caller that traces its own work can
+// make the request's span a child of its own
+var propagator = propagation.TraceContext{}
+
+// headerCarrier reads API Gateway headers, whose names keep the case the client sent
+type headerCarrier map[string]string
+
+func (h headerCarrier) Get(key string) string {
+	for name, value := range h {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (h headerCarrier) Set(key string, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for name := range h {
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// StartRequest opens the root span of a request to route, continuing the caller's trace when
+// it sent a traceparent header. Inside Lambda the span carries the invocation's request ID.
+func StartRequest(ctx context.Context, request events.APIGatewayProxyRequest, route string) (context.Context, trace.Span) {
+	ctx = propagator.Extract(ctx, headerCarrier(request.Headers))
+
+	attrs := []attribute.KeyValue{
+		semconv.FaaSTriggerHTTP,
+		semconv.HTTPMethodKey.String(request.HTTPMethod),
+		semconv.HTTPRouteKey.String(route),
+		semconv.HTTPTargetKey.String(request.Path),
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		attrs = append(attrs,
+			semconv.FaaSExecutionKey.String(lc.AwsRequestID),
+			semconv.FaaSIDKey.String(lc.InvokedFunctionArn),
+		)
+	}
+	if ip := request.RequestContext.Identity.SourceIP; ip != "" {
+		attrs = append(attrs, semconv.HTTPClientIPKey.String(ip))
+	}
+	if id := request.RequestContext.RequestID; id != "" {
+		attrs = append(attrs, attribute.String("apigateway.request_id", id))
+	}
+	if userID := request.PathParameters["userId"]; userID != "" {
+		attrs = append(attrs, attribute.String("app.user_id", userID))
+	}
+	if fileID := request.PathParameters["fileId"]; fileID != "" {
+		attrs = append(attrs, attribute.String("app.file_id", fileID))
+	}
+
+	return Tracer().Start(ctx, route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// EndRequest records the response status on a span from StartRequest and ends it. Only 5xx
+// responses and handler errors mark the span as failed; 4xx are the client's mistakes.
+func EndRequest(span trace.Span, status int, err error) {
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if status >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+	span.End()
+}
@@ -0,0 +1,119 @@
+// Package tracing records OpenTelemetry spans: a root span for every request, opened by
+// router.Instrument, and a child span for every AWS call made with the request's context.
+//
+// OTEL_TRACES_EXPORTER picks where spans go:
+//
+//	none    the default; spans are not recorded
+//	otlp    OTLP over HTTP, to OTEL_EXPORTER_OTLP_ENDPOINT (e.g. http://localhost:4318 for a
+//	        local collector, or the ADOT Lambda layer's collector)
+//	stdout  one JSON object per span on stdout
+//
+// Lambda freezes the process between invocations, so the Lambda entry points call Flush
+// before returning instead of relying on the batcher's timer.
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies the API's spans in the tracing backend
+const ServiceName = "file-management-api"
+
+const instrumentationName = "github.com/CMPE281-Project1-GabrielChen/file-management-api/tracing"
+
+var (
+	defaultMu       sync.Mutex
+	defaultProvider trace.TracerProvider
+)
+
+// providerFromEnv builds the provider OTEL_TRACES_EXPORTER asks for. An exporter that cannot
+// be set up is logged and tracing stays off rather than failing the request.
+func providerFromEnv() trace.TracerProvider {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	switch name {
+	case "", "none":
+		return trace.NewNoopTracerProvider()
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		logging.Default().Warn("unknown OTEL_TRACES_EXPORTER, tracing disabled", "exporter", name)
+		return trace.NewNoopTracerProvider()
+	}
+	if err != nil {
+		logging.Default().Error("failed to create span exporter, tracing disabled", "exporter", name, "error", err)
+		return trace.NewNoopTracerProvider()
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(serviceResource()),
+	)
+}
+
+// serviceResource describes the process the spans come from
+func serviceResource() *resource.Resource {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(ServiceName),
+		semconv.DeploymentEnvironmentKey.String(metrics.Stage()),
+	}
+	if function := os.Getenv("AWS_LAMBDA_FUNCTION_NAME"); function != "" {
+		attrs = append(attrs, semconv.FaaSNameKey.String(function))
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		attrs = append(attrs, semconv.CloudRegionKey.String(region))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...)
+}
+
+// Default is the process-wide provider, built from the environment on first use
+func Default() trace.TracerProvider {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultProvider == nil {
+		defaultProvider = providerFromEnv()
+	}
+	return defaultProvider
+}
+
+// SetDefault replaces the process-wide provider, e.g. with one feeding a
+// tracetest.SpanRecorder in tests
+func SetDefault(tp trace.TracerProvider) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultProvider = tp
+}
+
+// Tracer starts the API's spans
+func Tracer() trace.Tracer {
+	return Default().Tracer(instrumentationName)
+}
+
+// Flush exports the spans the provider is still holding, when it holds any
+func Flush(ctx context.Context) {
+	flusher, ok := Default().(interface{ ForceFlush(context.Context) error })
+	if !ok {
+		return
+	}
+	if err := flusher.ForceFlush(ctx); err != nil {
+		logging.FromContext(ctx).Warn("failed to flush spans", "error", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/auth"
 	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
 	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
 	"github.com/aws/aws-lambda-go/events"
@@ -48,23 +49,32 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		value, err := url.QueryUnescape(userIdRaw)
 		if nil != err {
 			return Response{StatusCode: 500},
-				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v\n", userIdRaw, err)
+				fmt.Errorf("failed to unescape userIdRaw: %v, error: %v", userIdRaw, err)
 		}
 
 		userId = value
 	} else {
-		return Response{StatusCode: 500}, fmt.Errorf("no userId found???\n")
+		return Response{StatusCode: 500}, fmt.Errorf("no userId found???")
+	}
+
+	principal, err := auth.Authenticate(ctx, request)
+	if err != nil {
+		return Response{StatusCode: 401}, nil
+	}
+
+	if !principal.CanActAs(userId) {
+		return Response{StatusCode: 403}, nil
 	}
 
 	var body UploadFileRequest
-	err := json.Unmarshal([]byte(request.Body), &body)
+	err = json.Unmarshal([]byte(request.Body), &body)
 	if err != nil {
-		return Response{StatusCode: 500}, fmt.Errorf("failed to unmarshall body\n")
+		return Response{StatusCode: 500}, fmt.Errorf("failed to unmarshall body")
 	}
 
-	signedUrl, err := aws_usages.SignURL("https://d3kp1rtsk23gz0.cloudfront.net/")
+	signedUrl, err := aws_usages.SignURL(ctx, "https://d3kp1rtsk23gz0.cloudfront.net/")
 	if err != nil {
-		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url\n")
+		return Response{StatusCode: 500}, fmt.Errorf("failed to sign url")
 	}
 
 	uuidWithHyphen := uuid.New()
@@ -80,10 +90,12 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		FileName:  body.FileName,
 		Modified:  t,
 		Uploaded:  t,
+
+		ScanStatus: aws_usages.ScanStatusUnscanned,
 	}
 
-	if err := aws_usages.PutDynamoDB("dev-files", item); err != nil {
-		return Response{StatusCode: 500}, fmt.Errorf("uploadFile failed: %v\n", err)
+	if err := aws_usages.PutDynamoDB(ctx, "dev-files", item); err != nil {
+		return Response{StatusCode: 500}, fmt.Errorf("uploadFile failed: %v", err)
 	}
 
 	// resp := UploadFileReturn{
@@ -93,7 +105,7 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 
 	// js, err := json.Marshal(resp)
 	// if err != nil {
-	// 	return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL\n")
+	// 	return Response{StatusCode: 500}, fmt.Errorf("failed to marshal signedURL")
 	// }
 
 	return Response{
@@ -0,0 +1,359 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/metrics"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" and the hex HMAC-SHA256, keyed
+// with the webhook's secret, of the timestamp, a ".", and the body; see Verify.
+const (
+	WebhookIDHeader  = "X-Webhook-ID"
+	EventHeader      = "X-Webhook-Event"
+	DeliveryHeader   = "X-Webhook-Delivery"
+	TimestampHeader  = "X-Webhook-Timestamp"
+	SignatureHeader  = "X-Webhook-Signature"
+	signaturePrefix  = "sha256="
+	maxResponseBytes = 64 << 10
+)
+
+// Retry policy: a failed attempt is retried after BaseDelay, doubling each time up to MaxDelay,
+// until MaxAttempts attempts have failed and the delivery is dead-lettered
+const (
+	MaxAttempts = 8
+	BaseDelay   = 30 * time.Second
+	MaxDelay    = aws_usages.MaxSQSDelaySeconds * time.Second
+)
+
+// Outcomes of an attempt, as the delivery history shows them
+const (
+	OutcomeDelivered    = "delivered"
+	OutcomeRetrying     = "retrying"
+	OutcomeDeadLettered = "dead-lettered"
+)
+
+// HistoryTTL is how long attempts stay in the delivery history
+const HistoryTTL = 30 * 24 * time.Hour
+
+// Delivery is one event on its way to one webhook, as it travels through the queue.
+// Payload is the event's JSON, fixed when it is queued so every attempt signs the same bytes.
+type Delivery struct {
+	DeliveryID string `json:"DeliveryID"`
+	WebhookID  string `json:"WebhookID"`
+	UserID     string `json:"UserID"`
+	EventID    string `json:"EventID"`
+	EventType  string `json:"EventType"`
+	Payload    string `json:"Payload"`
+	Attempt    int    `json:"Attempt"` // 1 for the first
+}
+
+// Attempt is one entry of a webhook's delivery history
+type Attempt struct {
+	DeliveryID string `json:"DeliveryID"`
+	EventID    string `json:"EventID"`
+	EventType  string `json:"EventType"`
+	Attempt    int    `json:"Attempt"`
+	Outcome    string `json:"Outcome"`
+	StatusCode int    `json:"StatusCode,omitempty"` // the endpoint's, 0 if it was not reached
+	Error      string `json:"Error,omitempty"`
+	DurationMs int64  `json:"DurationMs"`
+	Timestamp  string `json:"Timestamp"`
+	NextRetry  string `json:"NextRetry,omitempty"`
+}
+
+// ErrInvalidPageToken is returned by History for a pageToken it did not issue
+var ErrInvalidPageToken = aws_usages.ErrInvalidPageToken
+
+// History returns a page of a webhook's delivery attempts, newest first, and the token for the
+// next page, "" after the last. The caller checks the webhook belongs to the user asking.
+func History(ctx context.Context, webhookID string, limit int64, pageToken string) ([]Attempt, string, error) {
+	items, next, err := aws_usages.QueryWebhookAttemptsDynamoDB(ctx, DeliveriesTableName, webhookID, limit, pageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	attempts := make([]Attempt, 0, len(items))
+	for _, item := range items {
+		attempts = append(attempts, Attempt{
+			DeliveryID: item.DeliveryID,
+			EventID:    item.EventID,
+			EventType:  item.EventType,
+			Attempt:    item.Attempt,
+			Outcome:    item.Outcome,
+			StatusCode: item.StatusCode,
+			Error:      item.Error,
+			DurationMs: item.DurationMs,
+			Timestamp:  item.Timestamp,
+			NextRetry:  item.NextRetry,
+		})
+	}
+
+	return attempts, next, nil
+}
+
+// Queue holds deliveries until they are due
+type Queue interface {
+	Send(ctx context.Context, delivery Delivery, delay time.Duration) error
+}
+
+// SQSQueue sends deliveries to an SQS queue whose consumer runs a Deliverer
+type SQSQueue struct {
+	URL string
+}
+
+func (q *SQSQueue) Send(ctx context.Context, delivery Delivery, delay time.Duration) error {
+	if q.URL == "" {
+		return fmt.Errorf("no webhook queue configured, set WEBHOOK_QUEUE_URL")
+	}
+
+	js, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery: %v", err)
+	}
+
+	return aws_usages.SendMessageSQS(ctx, q.URL, string(js), int64(delay/time.Second))
+}
+
+// LocalQueue hands deliveries to its Deliverer in this process once they are due, standing in
+// for SQS in the local server. Deliveries still waiting are lost when the process exits.
+type LocalQueue struct {
+	Deliverer *Deliverer
+}
+
+// NewLocalQueue returns a queue whose Deliverer sends its retries back to it
+func NewLocalQueue() *LocalQueue {
+	q := &LocalQueue{}
+	q.Deliverer = NewDeliverer(q)
+	return q
+}
+
+func (q *LocalQueue) Send(ctx context.Context, delivery Delivery, delay time.Duration) error {
+	time.AfterFunc(delay, func() {
+		if err := q.Deliverer.Deliver(context.Background(), delivery); err != nil {
+			logging.Default().Error("webhook delivery failed", "delivery", delivery.DeliveryID, "error", err)
+		}
+	})
+
+	return nil
+}
+
+// DefaultQueue receives the deliveries Notify creates; tests and the local server swap it out
+var DefaultQueue Queue = &SQSQueue{URL: os.Getenv("WEBHOOK_QUEUE_URL")}
+
+// Sign returns the signature header value for body sent at timestamp (unix seconds)
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, timestamp+".")
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery as a receiver would: the signature must match the body and
+// timestamp, and the timestamp be within tolerance of now, so captured deliveries cannot be
+// replayed later
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %v", TimestampHeader)
+	}
+
+	want := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(want), []byte(header.Get(SignatureHeader))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+
+	return nil
+}
+
+// Backoff is the wait before retrying a delivery whose attempt'th attempt failed
+func Backoff(attempt int) time.Duration {
+	delay := BaseDelay
+	for i := 1; i < attempt && delay < MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxDelay {
+		delay = MaxDelay
+	}
+
+	return delay
+}
+
+// Deliverer makes delivery attempts, queueing retries on Queue
+type Deliverer struct {
+	Client *http.Client
+	Queue  Queue // nil for DefaultQueue
+	Now    func() time.Time
+}
+
+// NewDeliverer returns a deliverer that gives endpoints 10 seconds to answer, does not follow
+// redirects, and only connects to public addresses. It never uses a proxy, which would hide
+// the address the endpoint's name resolved to.
+func NewDeliverer(queue Queue) *Deliverer {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: dialControl,
+	}
+
+	return &Deliverer{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Queue: queue,
+	}
+}
+
+func (d *Deliverer) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+func (d *Deliverer) queue() Queue {
+	if d.Queue != nil {
+		return d.Queue
+	}
+	return DefaultQueue
+}
+
+// Deliver makes one attempt at a delivery. A 2xx answer delivers it; anything else, including
+// no answer, queues the next attempt after Backoff, or after the last attempt records a dead
+// letter. Every attempt is added to the webhook's history. An error means the retry or dead
+// letter could not be stored, and the queue should offer the delivery again; endpoints should
+// therefore expect, and ignore by X-Webhook-Delivery, the occasional repeat.
+func (d *Deliverer) Deliver(ctx context.Context, delivery Delivery) error {
+	logger := logging.FromContext(ctx).With("webhookId", delivery.WebhookID, "delivery", delivery.DeliveryID, "attempt", delivery.Attempt)
+
+	hook, err := aws_usages.GetWebhookDynamoDB(ctx, TableName, delivery.UserID, delivery.WebhookID)
+	if err == aws_usages.ErrWebhookNotFound {
+		logger.Info("dropping delivery to a removed webhook")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	start := d.now()
+	status, sendErr := d.send(ctx, hook, delivery, start)
+	elapsed := d.now().Sub(start)
+
+	attempt := aws_usages.WebhookAttemptItem{
+		WebhookID:  delivery.WebhookID,
+		AttemptID:  start.UTC().Format(audit.TimestampFormat) + "/" + delivery.DeliveryID + "/" + strconv.Itoa(delivery.Attempt),
+		DeliveryID: delivery.DeliveryID,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		Attempt:    delivery.Attempt,
+		Outcome:    OutcomeDelivered,
+		StatusCode: status,
+		DurationMs: int64(elapsed / time.Millisecond),
+		Timestamp:  start.UTC().Format(audit.TimestampFormat),
+		ExpiresAt:  start.Add(HistoryTTL).Unix(),
+	}
+
+	switch {
+	case sendErr == nil:
+	case delivery.Attempt < MaxAttempts:
+		attempt.Outcome, attempt.Error = OutcomeRetrying, sendErr.Error()
+		delay := Backoff(delivery.Attempt)
+		attempt.NextRetry = start.Add(delay).UTC().Format(audit.TimestampFormat)
+
+		retry := delivery
+		retry.Attempt++
+		if err := d.queue().Send(ctx, retry, delay); err != nil {
+			return fmt.Errorf("failed to queue retry: %v", err)
+		}
+	default:
+		attempt.Outcome, attempt.Error = OutcomeDeadLettered, sendErr.Error()
+
+		err := aws_usages.PutWebhookDeadLetterDynamoDB(ctx, DeadLettersTableName, aws_usages.WebhookDeadLetterItem{
+			WebhookID:  delivery.WebhookID,
+			DeliveryID: delivery.DeliveryID,
+			UserID:     delivery.UserID,
+			EventID:    delivery.EventID,
+			EventType:  delivery.EventType,
+			Payload:    delivery.Payload,
+			Attempts:   delivery.Attempt,
+			LastError:  sendErr.Error(),
+			Timestamp:  attempt.Timestamp,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store dead letter: %v", err)
+		}
+	}
+
+	metrics.FromContext(ctx).Emit(metrics.Dimensions{"Outcome": attempt.Outcome},
+		metrics.Metric{Name: "WebhookAttempts", Value: 1, Unit: metrics.Count},
+		metrics.Metric{Name: "WebhookLatency", Value: float64(elapsed) / float64(time.Millisecond), Unit: metrics.Milliseconds},
+	)
+
+	// the attempt has been made either way; a gap in the history beats sending it again
+	if err := aws_usages.PutWebhookAttemptDynamoDB(ctx, DeliveriesTableName, attempt); err != nil {
+		logger.Error("failed to record webhook attempt", "outcome", attempt.Outcome, "error", err)
+	}
+	logger.Info("webhook attempt", "outcome", attempt.Outcome, "status", status, "durationMs", elapsed)
+
+	return nil
+}
+
+// send POSTs the payload, returning the endpoint's status code and an error unless it was 2xx
+func (d *Deliverer) send(ctx context.Context, hook *aws_usages.WebhookTableItem, delivery Delivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "file-management-api-webhooks")
+	req.Header.Set(WebhookIDHeader, hook.WebhookID)
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.DeliveryID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %v", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
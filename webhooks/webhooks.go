@@ -0,0 +1,340 @@
+// Package webhooks tells users' own services about changes to their files. A user registers
+// endpoints with a secret; Notify queues a Delivery of each event to every endpoint subscribed
+// to it, and the Deliverer, run from the queue, POSTs the event signed with the endpoint's
+// secret, retrying with exponential backoff and dead-lettering what never succeeds.
+// Every attempt is kept in the delivery history the user can list.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/audit"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/aws_usages"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/logging"
+	"github.com/CMPE281-Project1-GabrielChen/file-management-api/uuid"
+)
+
+// Event types. Created is a new file record, from an upload or a copy; committed is its
+// content being stored, which for uploads and overwrites happens when the client's PUT lands.
+const (
+	EventFileCreated     = "file.created"
+	EventFileCommitted   = "file.committed"
+	EventFileOverwritten = "file.overwritten"
+	EventFileDeleted     = "file.deleted"
+)
+
+// EventTypes lists every event type a webhook can subscribe to
+var EventTypes = []string{EventFileCreated, EventFileCommitted, EventFileOverwritten, EventFileDeleted}
+
+// Tables webhooks, their delivery history and dead letters are kept in
+const (
+	TableName            = "dev-webhooks"
+	DeliveriesTableName  = "dev-webhook-deliveries"
+	DeadLettersTableName = "dev-webhook-deadletters"
+)
+
+// MaxWebhooks caps the endpoints one user can register
+const MaxWebhooks = 10
+
+// Secrets are generated when not supplied, and otherwise must be this long
+const (
+	MinSecretLength = 16
+	MaxSecretLength = 128
+)
+
+// AllowHTTP lets endpoints use plain http and loopback or private addresses, for testing
+// against local servers; otherwise only https endpoints on public hosts are accepted.
+// Set from WEBHOOK_ALLOW_HTTP=true.
+var AllowHTTP = os.Getenv("WEBHOOK_ALLOW_HTTP") == "true"
+
+// Event is the JSON payload POSTed to webhooks
+type Event struct {
+	EventID   string `json:"EventID"`
+	Type      string `json:"Type"`
+	Timestamp string `json:"Timestamp"` // audit.TimestampFormat
+	UserID    string `json:"UserID"`
+	FileID    string `json:"FileID"`
+	FileName  string `json:"FileName,omitempty"`
+	FileSize  int64  `json:"FileSize,omitempty"`
+}
+
+// Webhook is a registered endpoint as its owner sees it; the secret is only shown on registration
+type Webhook struct {
+	WebhookID string   `json:"WebhookID"`
+	UserID    string   `json:"UserID"`
+	URL       string   `json:"URL"`
+	Events    []string `json:"Events"` // empty for every event type
+	Created   string   `json:"Created"`
+}
+
+func webhookFromItem(item aws_usages.WebhookTableItem) Webhook {
+	events := item.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return Webhook{
+		WebhookID: item.WebhookID,
+		UserID:    item.UserID,
+		URL:       item.URL,
+		Events:    events,
+		Created:   item.Created,
+	}
+}
+
+// Subscribed reports whether the webhook receives events of eventType
+func (w Webhook) Subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateURL checks an endpoint is an absolute https URL without credentials in it. Hosts given
+// as loopback, private or link-local addresses are refused unless AllowHTTP is set. A name is
+// only checked when it is resolved, as the Deliverer connects; see dialControl.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL: %q", raw)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && AllowHTTP) {
+		return fmt.Errorf("webhook URL must use https: %q", raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("webhook URL must not contain credentials")
+	}
+	if !AllowHTTP && internalHost(u.Hostname()) {
+		return fmt.Errorf("webhook URL must not point at a private address: %q", raw)
+	}
+
+	return nil
+}
+
+// privateNets are the ranges besides loopback, link-local, multicast and unspecified
+// addresses that endpoints may not be in: RFC 1918, carrier-grade NAT (which VPC endpoints can
+// use), "this network", IETF protocol assignments, benchmarking, the reserved 240/4 (with
+// broadcast) and IPv6 unique local addresses. NAT64, 6to4 and Teredo addresses embed an IPv4
+// address a gateway may forward to, such as 64:ff9b::a9fe:a9fe for 169.254.169.254, so those
+// prefixes are refused whole.
+var privateNets = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16",
+	"198.18.0.0/15", "240.0.0.0/4",
+	"fc00::/7", "64:ff9b::/96", "64:ff9b:1::/48", "2002::/16", "2001::/32",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("webhooks: bad CIDR %v: %v", cidr, err))
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+func internalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	return internalIP(ip)
+}
+
+func internalIP(ip net.IP) bool {
+	// ::ffff:169.254.169.254 reaches the metadata service as surely as 169.254.169.254
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range privateNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialControl refuses connections to internal addresses unless AllowHTTP is set. It runs
+// after the endpoint's name is resolved, so a public name pointing at the metadata service or
+// a private network, or one re-pointed there after registration, is caught too.
+func dialControl(network string, address string, c syscall.RawConn) error {
+	if AllowHTTP {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || internalIP(ip) {
+		return fmt.Errorf("webhook endpoint resolved to a private address %v", host)
+	}
+
+	return nil
+}
+
+// ValidateEvents checks every entry names an event type
+func ValidateEvents(events []string) error {
+	for _, e := range events {
+		known := false
+		for _, t := range EventTypes {
+			known = known || e == t
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q, must be one of %v", e, strings.Join(EventTypes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// ValidateSecret checks a caller supplied secret; "" asks for a generated one
+func ValidateSecret(secret string) error {
+	if secret != "" && (len(secret) < MinSecretLength || len(secret) > MaxSecretLength) {
+		return fmt.Errorf("secret must be %v to %v characters", MinSecretLength, MaxSecretLength)
+	}
+
+	return nil
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// Register stores a new webhook for userID, returning it with its generated WebhookID
+func Register(ctx context.Context, userID string, endpoint string, secret string, events []string) (Webhook, error) {
+	item := aws_usages.WebhookTableItem{
+		UserID:    userID,
+		WebhookID: strings.Replace(uuid.New().String(), "-", "", -1),
+		URL:       endpoint,
+		Secret:    secret,
+		Events:    events,
+		Created:   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if err := aws_usages.PutWebhookDynamoDB(ctx, TableName, item); err != nil {
+		return Webhook{}, err
+	}
+
+	return webhookFromItem(item), nil
+}
+
+// List returns userID's webhooks
+func List(ctx context.Context, userID string) ([]Webhook, error) {
+	items, err := aws_usages.ListWebhooksDynamoDB(ctx, TableName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := make([]Webhook, 0, len(items))
+	for _, item := range items {
+		hooks = append(hooks, webhookFromItem(item))
+	}
+
+	return hooks, nil
+}
+
+// ErrNotFound is returned for a webhook the user has not registered
+var ErrNotFound = aws_usages.ErrWebhookNotFound
+
+// Get returns one of userID's webhooks, or ErrNotFound
+func Get(ctx context.Context, userID string, webhookID string) (Webhook, error) {
+	item, err := aws_usages.GetWebhookDynamoDB(ctx, TableName, userID, webhookID)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return webhookFromItem(*item), nil
+}
+
+// Delete removes one of userID's webhooks, or returns ErrNotFound. Deliveries already queued
+// for it are dropped; its history stays until it expires.
+func Delete(ctx context.Context, userID string, webhookID string) error {
+	return aws_usages.DeleteWebhookDynamoDB(ctx, TableName, userID, webhookID)
+}
+
+// Notify queues event for every webhook of event.UserID subscribed to its type, filling in
+// EventID and Timestamp when unset. A failure is logged rather than returned: like audit
+// entries, events describe an operation that has already happened.
+func Notify(ctx context.Context, event Event) {
+	if err := notify(ctx, event); err != nil {
+		logging.FromContext(ctx).Error("failed to queue webhook deliveries", "event", event, "error", err)
+	}
+}
+
+func notify(ctx context.Context, event Event) error {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(audit.TimestampFormat)
+	}
+
+	hooks, err := List(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Subscribed(event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to marshal event: %v", err)
+			}
+		}
+
+		delivery := Delivery{
+			DeliveryID: uuid.New().String(),
+			WebhookID:  hook.WebhookID,
+			UserID:     event.UserID,
+			EventID:    event.EventID,
+			EventType:  event.Type,
+			Payload:    string(payload),
+			Attempt:    1,
+		}
+		if err := DefaultQueue.Send(ctx, delivery, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}